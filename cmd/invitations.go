@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	kuura "github.com/kymppi/kuura/internal"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/spf13/cobra"
+)
+
+func usersInvite(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "invite",
+		Aliases: []string{"invites", "invitations"},
+		Short:   "Manage invitation links, the invited user chooses their own password",
+	}
+
+	cmd.AddCommand(usersInviteCreate(logger, config))
+	cmd.AddCommand(usersInviteList(logger, config))
+	cmd.AddCommand(usersInviteRevoke(logger, config))
+
+	return cmd
+}
+
+func usersInviteCreate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	var (
+		roles      []string
+		serviceIds []string
+		expiresIn  time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a single-use invitation link",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			var services []uuid.UUID
+			for _, serviceId := range serviceIds {
+				id, err := uuid.Parse(serviceId)
+				if err != nil {
+					cmd.PrintErrf("Failed to parse service id '%s': %s", serviceId, err)
+					return
+				}
+				services = append(services, id)
+			}
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			token, invitation, err := userService.CreateInvitation(ctx, roles, services, expiresIn)
+			if err != nil {
+				cmd.PrintErrf("Failed to create invitation: %s", err)
+				return
+			}
+
+			cmd.Printf("Invitation %s created, it works once until %s:\n", invitation.Id, invitation.ExpiresAt.Format(time.RFC3339))
+			cmd.Printf("https://%s/register?invitation=%s\n", config.PUBLIC_KUURA_DOMAIN, token)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&roles, "role", nil, "role the invited user gets in every --service, can be repeated")
+	cmd.Flags().StringSliceVar(&serviceIds, "service", nil, "id of a service in the allowlist mode whose allowlist the invited user is added to, can be repeated")
+	cmd.Flags().DurationVar(&expiresIn, "expires", 7*24*time.Hour, "how long the invitation can be used")
+
+	return cmd
+}
+
+func usersInviteList(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List invitations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			invitations, err := userService.GetInvitations(ctx)
+			if err != nil {
+				cmd.PrintErrf("Failed to list invitations: %s", err)
+				return
+			}
+
+			if len(invitations) == 0 {
+				cmd.Println("No invitations found.")
+				return
+			}
+
+			writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+			defer writer.Flush()
+
+			fmt.Fprintln(writer, "ID\tSTATUS\tROLES\tSERVICES\tEXPIRES AT")
+			for _, invitation := range invitations {
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+					invitation.Id,
+					invitationStatus(invitation),
+					strings.Join(invitation.Roles, ","),
+					invitationServices(invitation),
+					invitation.ExpiresAt.Format(time.RFC3339),
+				)
+			}
+		},
+	}
+}
+
+func usersInviteRevoke(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke [invitation id]",
+		Short: "Revoke an unused invitation",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			id, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse invitation id: %s", err)
+				return
+			}
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			if err := userService.RevokeInvitation(ctx, id); err != nil {
+				cmd.PrintErrf("Failed to revoke invitation: %s", err)
+				return
+			}
+
+			cmd.Printf("Invitation %s revoked.\n", id)
+		},
+	}
+}
+
+func invitationStatus(invitation *models.UserInvitation) string {
+	switch {
+	case invitation.UsedBy != nil:
+		return "used by " + *invitation.UsedBy
+	case invitation.UsedAt != nil:
+		return "used"
+	case time.Now().After(invitation.ExpiresAt):
+		return "expired"
+	default:
+		return "pending"
+	}
+}
+
+func invitationServices(invitation *models.UserInvitation) string {
+	if len(invitation.Services) == 0 {
+		return "-"
+	}
+
+	ids := make([]string, 0, len(invitation.Services))
+	for _, id := range invitation.Services {
+		ids = append(ids, id.String())
+	}
+
+	return strings.Join(ids, ",")
+}
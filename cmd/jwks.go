@@ -2,16 +2,23 @@ package cmd
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"log/slog"
 	"os"
 	"sort"
+	"time"
 
 	"github.com/google/uuid"
 	kuura "github.com/kymppi/kuura/internal"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/kek"
+	"github.com/kymppi/kuura/internal/services"
+	"github.com/kymppi/kuura/internal/settings"
 	"github.com/spf13/cobra"
 )
 
@@ -25,6 +32,10 @@ func runJwks(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 	jwksCmd.AddCommand(jwkCreate(logger, config))
 	jwksCmd.AddCommand(jwkExport(logger, config))
 	jwksCmd.AddCommand(jwkStatus(logger, config))
+	jwksCmd.AddCommand(jwkRotate(logger, config))
+	jwksCmd.AddCommand(jwkPolicy(logger, config))
+	jwksCmd.AddCommand(jwkRewrap(logger, config))
+	jwksCmd.AddCommand(jwkGenerateKEK(logger, config))
 
 	return jwksCmd
 }
@@ -100,14 +111,14 @@ func jwkExport(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 				return
 			}
 
-			var privateKey ecdsa.PrivateKey
+			var privateKey any
 			err = privateJWK.Raw(&privateKey)
 			if err != nil {
 				cmd.PrintErrf("Failed to get private key from JWK: %v\n", err)
 				return
 			}
 
-			err = exportPKCS8PrivateKeyToStdout(&privateKey)
+			err = exportPKCS8PrivateKeyToStdout(privateKey)
 			if err != nil {
 				cmd.PrintErrf("Failed to export private key to PEM: %v", err)
 				return
@@ -116,7 +127,8 @@ func jwkExport(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 	}
 }
 
-func exportPKCS8PrivateKeyToStdout(privateKey *ecdsa.PrivateKey) error {
+// privateKey is *ecdsa.PrivateKey, *rsa.PrivateKey or ed25519.PrivateKey
+func exportPKCS8PrivateKeyToStdout(privateKey any) error {
 	privBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
 	if err != nil {
 		return fmt.Errorf("failed to marshal private key into PKCS#8 format: %v", err)
@@ -194,3 +206,264 @@ func jwkStatus(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 		},
 	}
 }
+
+func jwkRotate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate [service-id]",
+		Short: "Promote the upcoming key to current and pre-create the next one",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			serviceId, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse serviceId: %s", err)
+				return
+			}
+
+			queries, cleanup, err := kuura.InitializeDatabaseConnection(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize database: %s", err)
+				return
+			}
+			defer cleanup()
+
+			jwkManager, err := kuura.InitializeJWKManager(ctx, logger, config, queries)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize jwk manager: %s", err)
+				return
+			}
+
+			var keyID string
+			err = jwks.WithRotationLock(ctx, queries, func() error {
+				keyID, err = jwkManager.Rotate(ctx, serviceId)
+				return err
+			})
+			if err != nil {
+				cmd.PrintErrf("Failed to rotate keys for service ID %s: %v\n", serviceId.String(), err)
+				return
+			}
+
+			cmd.Printf("Key %s is now current for service %s\n", keyID, serviceId)
+		},
+	}
+}
+
+func jwkPolicy(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	var (
+		rotationInterval time.Duration
+		retirementPeriod time.Duration
+		algorithm        string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "policy [service-id]",
+		Short: "View or change how often the keys of a service are rotated automatically",
+		Long: `View or change the automatic key rotation policy of a service.
+
+Without flags the current policy is printed. Automatic rotation is disabled until a rotation interval
+is set, an interval of 0 disables it again.
+Retired keys are deleted once both the retirement period and the longest token lifetime have passed.
+A new algorithm only applies to keys created afterwards, run "kuura jwks rotate" to switch immediately.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			serviceId, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse serviceId: %s", err)
+				return
+			}
+
+			queries, cleanup, err := kuura.InitializeDatabaseConnection(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize database: %s", err)
+				return
+			}
+			defer cleanup()
+
+			settingsService := settings.NewSettingsService(logger, queries)
+			serviceManager := services.NewServiceManager(logger, queries, settingsService)
+
+			service, err := serviceManager.GetService(ctx, serviceId)
+			if err != nil {
+				cmd.PrintErrf("Failed to get service: %s", err)
+				return
+			}
+
+			if cmd.Flags().Changed("rotation-interval") || cmd.Flags().Changed("retirement-period") {
+				if !cmd.Flags().Changed("rotation-interval") {
+					rotationInterval = service.JWKRotationInterval
+				}
+				if !cmd.Flags().Changed("retirement-period") {
+					retirementPeriod = service.JWKRetirementPeriod
+				}
+
+				if err := serviceManager.SetJWKRotationPolicy(ctx, serviceId, rotationInterval, retirementPeriod); err != nil {
+					cmd.PrintErrf("Failed to update key rotation policy: %s", err)
+					return
+				}
+
+				service.JWKRotationInterval = rotationInterval
+				service.JWKRetirementPeriod = retirementPeriod
+			}
+
+			if cmd.Flags().Changed("algorithm") {
+				alg, err := jwks.ParseAlgorithm(algorithm)
+				if err != nil {
+					cmd.PrintErrf("Invalid algorithm: %s", err)
+					return
+				}
+
+				if err := serviceManager.SetJWKAlgorithm(ctx, serviceId, alg.String()); err != nil {
+					cmd.PrintErrf("Failed to update key algorithm: %s", err)
+					return
+				}
+
+				service.JWKAlgorithm = alg.String()
+			}
+
+			if service.JWKRotationInterval == 0 {
+				cmd.Println("Rotation interval: disabled")
+			} else {
+				cmd.Printf("Rotation interval: %s\n", service.JWKRotationInterval)
+			}
+			cmd.Printf("Retirement period: %s\n", service.JWKRetirementPeriod)
+			cmd.Printf("Algorithm: %s\n", service.JWKAlgorithm)
+		},
+	}
+
+	cmd.Flags().DurationVar(&rotationInterval, "rotation-interval", 0, "How often a new key is promoted, e.g. 720h (0 disables automatic rotation)")
+	cmd.Flags().DurationVar(&retirementPeriod, "retirement-period", 0, "How long a retired key stays published, e.g. 168h")
+	cmd.Flags().StringVar(&algorithm, "algorithm", "", "Algorithm of new keys: ES256, ES384, RS256 or EdDSA")
+
+	return cmd
+}
+
+func jwkRewrap(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	var (
+		kekId     string
+		kekSource string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rewrap",
+		Short: "Re-encrypt every private key and TOTP secret with a new key encryption key",
+		Long: `Re-encrypt every private key and TOTP secret with a new key encryption key (KEK).
+Both are rewrapped in one transaction, nothing is changed unless all of them move.
+
+The current KEK (JWK_KEK_ID, JWK_KEK) and any KEKs listed in JWK_PREVIOUS_KEKS are used
+to decrypt the keys. Running instances keep working as long as they know the new KEK,
+so add it to JWK_PREVIOUS_KEKS of every instance before rewrapping.
+
+A KEK source is a file path, file:<path>, env:<variable>, systemd:<credential> or transit:<ciphertext>.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			if kekId == "" || kekSource == "" {
+				cmd.PrintErrln("Both --kek-id and --kek are required")
+				return
+			}
+
+			newKek, err := kuura.LoadKey(ctx, config, kekSource)
+			if err != nil {
+				cmd.PrintErrf("Failed to load new key encryption key: %s", err)
+				return
+			}
+
+			queries, cleanup, err := kuura.InitializeDatabaseConnection(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize database: %s", err)
+				return
+			}
+			defer cleanup()
+
+			var rewrapped, rewrappedSecrets int
+
+			// one transaction so the keys and the TOTP secrets never end up under different KEKs,
+			// the rewraps run in savepoints of it
+			err = queries.InTx(ctx, func(tx *db_gen.Queries) error {
+				jwkManager, err := kuura.InitializeJWKManager(ctx, logger, config, tx)
+				if err != nil {
+					return fmt.Errorf("failed to initialize jwk manager: %w", err)
+				}
+
+				settingsService := settings.NewSettingsService(logger, tx)
+				serviceManager := services.NewServiceManager(logger, tx, settingsService)
+				userService, err := kuura.InitializeUserService(ctx, logger, config, tx, jwkManager, serviceManager)
+				if err != nil {
+					return fmt.Errorf("failed to initialize user service: %w", err)
+				}
+
+				if rewrapped, err = jwkManager.RewrapKeys(ctx, kekId, newKek); err != nil {
+					return fmt.Errorf("failed to rewrap keys: %w", err)
+				}
+
+				if rewrappedSecrets, err = userService.RewrapTOTPSecrets(ctx, kekId, newKek); err != nil {
+					return fmt.Errorf("failed to rewrap TOTP secrets: %w", err)
+				}
+
+				return nil
+			})
+			if err != nil {
+				cmd.PrintErrf("Nothing was changed: %s\n", err)
+				return
+			}
+
+			cmd.Printf("Rewrapped %d keys and %d TOTP secrets with key encryption key %s\n", rewrapped, rewrappedSecrets, kekId)
+			cmd.Printf("Set JWK_KEK_ID=%s and JWK_KEK=%s, then remove the old key encryption key once every instance has been restarted\n", kekId, kekSource)
+		},
+	}
+
+	cmd.Flags().StringVar(&kekId, "kek-id", "", "Identifier stored with each key, e.g. 2025")
+	cmd.Flags().StringVar(&kekSource, "kek", "", "Source of the new key encryption key, e.g. /var/kuura/.kek-2025 or env:KUURA_KEK_2025")
+
+	return cmd
+}
+
+func jwkGenerateKEK(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	var transit bool
+
+	cmd := &cobra.Command{
+		Use:   "generate-kek",
+		Short: "Generate a new key encryption key",
+		Long: `Generate a new key encryption key (KEK).
+
+Prints the key base64 encoded for env: sources, or with --transit wrapped by the
+Vault transit compatible API (VAULT_ADDR, VAULT_TOKEN) for transit: sources.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			if !transit {
+				key := make([]byte, kek.KeySize)
+				if _, err := rand.Read(key); err != nil {
+					cmd.PrintErrf("Failed to generate key: %s", err)
+					return
+				}
+
+				cmd.Println(base64.StdEncoding.EncodeToString(key))
+				return
+			}
+
+			client := kuura.TransitClient(config)
+			if client == nil {
+				cmd.PrintErrln("VAULT_ADDR is not set")
+				return
+			}
+
+			ciphertext, err := client.GenerateWrapped(ctx)
+			if err != nil {
+				cmd.PrintErrf("Failed to generate wrapped key: %s", err)
+				return
+			}
+
+			cmd.Printf("transit:%s\n", ciphertext)
+		},
+	}
+
+	cmd.Flags().BoolVar(&transit, "transit", false, "Wrap the key with the transit API instead of printing it")
+
+	return cmd
+}
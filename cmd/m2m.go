@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
 	kuura "github.com/kymppi/kuura/internal"
@@ -19,10 +20,25 @@ func runM2M(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 
 	m2mCmd.AddCommand(m2mRoleTemplateCreate(logger, config))
 	m2mCmd.AddCommand(m2mRoleTemplateList(logger, config))
+	m2mCmd.AddCommand(runM2MClients(logger, config))
 
 	return m2mCmd
 }
 
+func runM2MClients(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	clientsCmd := &cobra.Command{
+		Use:     "clients",
+		Aliases: []string{"client"},
+		Short:   "Manage OAuth2 client_credentials clients",
+	}
+
+	clientsCmd.AddCommand(m2mClientCreate(logger, config))
+	clientsCmd.AddCommand(m2mClientList(logger, config))
+	clientsCmd.AddCommand(m2mClientDelete(logger, config))
+
+	return clientsCmd
+}
+
 func m2mRoleTemplateCreate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 	return &cobra.Command{
 		Use:   "create [service-id] [template-name] [...roles]",
@@ -52,7 +68,7 @@ func m2mRoleTemplateCreate(logger *slog.Logger, config *kuura.Config) *cobra.Com
 				return
 			}
 
-			m2mService := m2m.NewM2MService(queries, config.JWT_ISSUER, jwkManager)
+			m2mService := m2m.NewM2MService(logger, queries, config.JWT_ISSUER, jwkManager)
 
 			if err := m2mService.CreateRoleTemplate(ctx, serviceId, templateId, roles); err != nil {
 				cmd.PrintErrf("Failed to create role template: %s", err)
@@ -91,7 +107,7 @@ func m2mRoleTemplateList(logger *slog.Logger, config *kuura.Config) *cobra.Comma
 				return
 			}
 
-			m2mService := m2m.NewM2MService(queries, config.JWT_ISSUER, jwkManager)
+			m2mService := m2m.NewM2MService(logger, queries, config.JWT_ISSUER, jwkManager)
 
 			templates, err := m2mService.GetRoleTemplates(ctx, serviceId)
 			if err != nil {
@@ -111,3 +127,131 @@ func m2mRoleTemplateList(logger *slog.Logger, config *kuura.Config) *cobra.Comma
 		},
 	}
 }
+
+func m2mClientCreate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "create [service-id] [template-name] [subject-id]",
+		Short: "Create a new client, the secret is only shown once",
+		Args:  cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			serviceId, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse serviceId: %s", err)
+				return
+			}
+
+			queries, cleanup, err := kuura.InitializeDatabaseConnection(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize database: %s", err)
+				return
+			}
+			defer cleanup()
+
+			jwkManager, err := kuura.InitializeJWKManager(ctx, logger, config, queries)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize jwk manager: %s", err)
+				return
+			}
+
+			m2mService := m2m.NewM2MService(logger, queries, config.JWT_ISSUER, jwkManager)
+
+			clientId, clientSecret, err := m2mService.CreateClient(ctx, serviceId, args[2], args[1])
+			if err != nil {
+				cmd.PrintErrf("Failed to create client: %s", err)
+				return
+			}
+
+			cmd.Printf("Client created successfully!\n")
+			cmd.Printf("Client ID:     %s\n", clientId)
+			cmd.Printf("Client Secret: %s\n", clientSecret)
+		},
+	}
+}
+
+func m2mClientList(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [service-id]",
+		Short: "List all clients of a service",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			serviceId, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse serviceId: %s", err)
+				return
+			}
+
+			queries, cleanup, err := kuura.InitializeDatabaseConnection(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize database: %s", err)
+				return
+			}
+			defer cleanup()
+
+			jwkManager, err := kuura.InitializeJWKManager(ctx, logger, config, queries)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize jwk manager: %s", err)
+				return
+			}
+
+			m2mService := m2m.NewM2MService(logger, queries, config.JWT_ISSUER, jwkManager)
+
+			clients, err := m2mService.GetClients(ctx, serviceId)
+			if err != nil {
+				cmd.PrintErrf("Failed to list clients: %s", err)
+				return
+			}
+
+			if len(clients) == 0 {
+				cmd.Println("No clients found.")
+				return
+			}
+
+			cmd.Println("Clients:")
+			for _, client := range clients {
+				lastUsed := "never"
+				if client.LastUsedAt != nil {
+					lastUsed = client.LastUsedAt.Format(time.RFC3339)
+				}
+
+				cmd.Printf(" - %s: subject=%s template=%s last used=%s\n", client.Id, client.SubjectId, client.TemplateId, lastUsed)
+			}
+		},
+	}
+}
+
+func m2mClientDelete(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete [client-id]",
+		Short: "Delete a client, it can no longer request new access tokens",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			queries, cleanup, err := kuura.InitializeDatabaseConnection(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize database: %s", err)
+				return
+			}
+			defer cleanup()
+
+			jwkManager, err := kuura.InitializeJWKManager(ctx, logger, config, queries)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize jwk manager: %s", err)
+				return
+			}
+
+			m2mService := m2m.NewM2MService(logger, queries, config.JWT_ISSUER, jwkManager)
+
+			if err := m2mService.DeleteClient(ctx, args[0]); err != nil {
+				cmd.PrintErrf("Failed to delete client: %s", err)
+				return
+			}
+
+			cmd.Printf("Client %s deleted successfully\n", args[0])
+		},
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+
+	kuura "github.com/kymppi/kuura/internal"
+	"github.com/spf13/cobra"
+)
+
+// managementTokenSize is the amount of random bytes in a generated management token
+const managementTokenSize = 32
+
+func runManagement(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	managementCmd := &cobra.Command{
+		Use:   "management",
+		Short: "Manage the management API",
+	}
+
+	managementCmd.AddCommand(managementGenerateToken(logger, config))
+
+	return managementCmd
+}
+
+func managementGenerateToken(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "generate-token",
+		Short: "Generate a new management API token",
+		Long: `Generate a new bearer token for the authenticated management endpoints.
+
+Prints the token base64 encoded, store it in an env: source referenced by
+MANAGEMENT_TOKEN and send it as "Authorization: Bearer <token>". Never reuse a
+key encryption key as the token, kuura refuses to start with one.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			token := make([]byte, managementTokenSize)
+			if _, err := rand.Read(token); err != nil {
+				cmd.PrintErrf("Failed to generate token: %s", err)
+				return
+			}
+
+			cmd.Println(base64.StdEncoding.EncodeToString(token))
+		},
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	kuura "github.com/kymppi/kuura/internal"
+	"github.com/spf13/cobra"
+)
+
+func usersRoles(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "roles",
+		Short: "Manage the roles users get in the access tokens of each service",
+	}
+
+	cmd.AddCommand(usersRolesList(logger, config))
+	cmd.AddCommand(usersRolesAdd(logger, config))
+	cmd.AddCommand(usersRolesRemove(logger, config))
+
+	return cmd
+}
+
+func usersRolesList(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [username]",
+		Short: "List the roles of a user in every service",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[0], err)
+				return
+			}
+
+			services, err := userService.GetAllRoles(ctx, uid)
+			if err != nil {
+				cmd.PrintErrf("Failed to get roles: %s", err)
+				return
+			}
+
+			if len(services) == 0 {
+				cmd.Printf("User '%s' has no roles.\n", args[0])
+				return
+			}
+
+			cmd.Printf("Roles of user '%s':\n", args[0])
+			for _, service := range services {
+				cmd.Printf(" - %s (%s): %s\n", service.ServiceName, service.ServiceId, strings.Join(service.Roles, ", "))
+			}
+		},
+	}
+}
+
+func usersRolesAdd(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	var serviceId string
+
+	cmd := &cobra.Command{
+		Use:   "add [username] [...roles]",
+		Short: "Give roles to a user in a service, they appear in access tokens issued after the change",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			service, err := uuid.Parse(serviceId)
+			if err != nil {
+				cmd.PrintErrf("Failed to parse service id: %s", err)
+				return
+			}
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[0], err)
+				return
+			}
+
+			roles, err := userService.AddRoles(ctx, uid, service, args[1:])
+			if err != nil {
+				cmd.PrintErrf("Failed to add roles: %s", err)
+				return
+			}
+
+			printRoles(cmd, args[0], service, roles)
+		},
+	}
+
+	cmd.Flags().StringVar(&serviceId, "service", "", "id of the service the roles are granted in")
+	cmd.MarkFlagRequired("service")
+
+	return cmd
+}
+
+func usersRolesRemove(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	var serviceId string
+
+	cmd := &cobra.Command{
+		Use:   "remove [username] [...roles]",
+		Short: "Take roles away from a user in a service, access tokens already issued keep them until they expire",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			service, err := uuid.Parse(serviceId)
+			if err != nil {
+				cmd.PrintErrf("Failed to parse service id: %s", err)
+				return
+			}
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[0], err)
+				return
+			}
+
+			roles, err := userService.RemoveRoles(ctx, uid, service, args[1:])
+			if err != nil {
+				cmd.PrintErrf("Failed to remove roles: %s", err)
+				return
+			}
+
+			printRoles(cmd, args[0], service, roles)
+		},
+	}
+
+	cmd.Flags().StringVar(&serviceId, "service", "", "id of the service the roles are removed from")
+	cmd.MarkFlagRequired("service")
+
+	return cmd
+}
+
+func printRoles(cmd *cobra.Command, username string, serviceId uuid.UUID, roles []string) {
+	if len(roles) == 0 {
+		cmd.Printf("User '%s' has no roles in service %s.\n", username, serviceId)
+		return
+	}
+
+	cmd.Printf("Roles of user '%s' in service %s: %s\n", username, serviceId, strings.Join(roles, ", "))
+}
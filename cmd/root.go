@@ -42,6 +42,7 @@ func NewRootCommand(config *kuura.Config, logger *slog.Logger, frontendFS embed.
 	rootCmd.AddCommand(runJwks(logger, config))
 	rootCmd.AddCommand(runM2M(logger, config))
 	rootCmd.AddCommand(runUsers(logger, config))
+	rootCmd.AddCommand(runManagement(logger, config))
 
 	return rootCmd
 }
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	kuura "github.com/kymppi/kuura/internal"
+	"github.com/kymppi/kuura/internal/users"
+	"github.com/spf13/cobra"
+)
+
+func serviceAccess(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "access",
+		Short: "Manage which users may log into a service",
+		Long: `Services are open to every user by default. The allowlist mode only lets in the users
+added with 'allow', the roles mode only lets in users who have every required role in the service.`,
+	}
+
+	cmd.AddCommand(serviceAccessShow(logger, config))
+	cmd.AddCommand(serviceAccessSet(logger, config))
+	cmd.AddCommand(serviceAccessAllow(logger, config))
+	cmd.AddCommand(serviceAccessDisallow(logger, config))
+
+	return cmd
+}
+
+func serviceAccessShow(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show [service id]",
+		Short: "Show the access policy and allowlist of a service",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			serviceId, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse service id: %s", err)
+				return
+			}
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			policy, err := userService.GetServiceAccessPolicy(ctx, serviceId)
+			if err != nil {
+				cmd.PrintErrf("Failed to get access policy: %s", err)
+				return
+			}
+
+			cmd.Printf("Mode: %s\n", policy.Mode)
+			if len(policy.RequiredRoles) > 0 {
+				cmd.Printf("Required roles: %s\n", strings.Join(policy.RequiredRoles, ", "))
+			}
+
+			if len(policy.AllowedUsers) == 0 {
+				cmd.Println("Allowlist: empty")
+				return
+			}
+
+			cmd.Println("Allowlist:")
+			for _, username := range policy.AllowedUsers {
+				cmd.Printf(" - %s\n", username)
+			}
+		},
+	}
+}
+
+func serviceAccessSet(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	var roles []string
+
+	cmd := &cobra.Command{
+		Use:   "set [service id] [open|allowlist|roles]",
+		Short: "Choose who may log into a service, sessions of users who lose access end at their next token refresh",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			serviceId, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse service id: %s", err)
+				return
+			}
+
+			mode, err := users.ParseServiceAccessMode(args[1])
+			if err != nil {
+				cmd.PrintErrf("%s\n", err)
+				return
+			}
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			if err := userService.SetServiceAccessPolicy(ctx, serviceId, mode, roles); err != nil {
+				cmd.PrintErrf("Failed to set access policy: %s", err)
+				return
+			}
+
+			cmd.Printf("Access to service %s set to %s.\n", serviceId, mode)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&roles, "role", nil, "role required by the roles mode, can be repeated, users need every one of them")
+
+	return cmd
+}
+
+func serviceAccessAllow(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "allow [service id] [username]",
+		Short: "Add a user to the allowlist of a service",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			serviceId, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse service id: %s", err)
+				return
+			}
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[1])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[1], err)
+				return
+			}
+
+			if err := userService.AllowServiceUser(ctx, serviceId, uid); err != nil {
+				cmd.PrintErrf("Failed to allow user: %s", err)
+				return
+			}
+
+			cmd.Printf("User '%s' added to the allowlist of service %s.\n", args[1], serviceId)
+		},
+	}
+}
+
+func serviceAccessDisallow(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:     "disallow [service id] [username]",
+		Aliases: []string{"deny"},
+		Short:   "Remove a user from the allowlist of a service, their sessions end at the next token refresh",
+		Args:    cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			serviceId, err := uuid.Parse(args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to parse service id: %s", err)
+				return
+			}
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[1])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[1], err)
+				return
+			}
+
+			if err := userService.DisallowServiceUser(ctx, serviceId, uid); err != nil {
+				cmd.PrintErrf("Failed to disallow user: %s", err)
+				return
+			}
+
+			cmd.Printf("User '%s' removed from the allowlist of service %s.\n", args[1], serviceId)
+		},
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/google/uuid"
 	kuura "github.com/kymppi/kuura/internal"
+	"github.com/kymppi/kuura/internal/jwks"
 	"github.com/kymppi/kuura/internal/models"
 	"github.com/kymppi/kuura/internal/services"
 	"github.com/kymppi/kuura/internal/settings"
@@ -30,6 +31,7 @@ func runServices(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 	servicesCmd.AddCommand(serviceList(logger, config))
 	servicesCmd.AddCommand(serviceCreate(logger, config))
 	servicesCmd.AddCommand(serviceDelete(logger, config))
+	servicesCmd.AddCommand(serviceAccess(logger, config))
 
 	return servicesCmd
 }
@@ -39,6 +41,7 @@ func serviceCreate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 		name          string
 		audience      string
 		loginRedirect string
+		algorithm     string
 	)
 
 	cmd := &cobra.Command{
@@ -47,6 +50,12 @@ func serviceCreate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			ctx := context.Background()
 
+			alg, err := jwks.ParseAlgorithm(algorithm)
+			if err != nil {
+				logger.Error("Invalid key algorithm", slog.String("error", err.Error()))
+				return
+			}
+
 			queries, cleanup, err := kuura.InitializeDatabaseConnection(ctx, logger, config)
 			if err != nil {
 				logger.Error("Failed to initialize database", slog.String("error", err.Error()))
@@ -63,6 +72,11 @@ func serviceCreate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 				return
 			}
 
+			if err := serviceManager.SetJWKAlgorithm(ctx, *id, alg.String()); err != nil {
+				logger.Error("Failed to set key algorithm", slog.String("error", err.Error()))
+				return
+			}
+
 			cmd.Println("Service created successfully:")
 			cmd.Printf("ID: %v\n", id)
 			cmd.Printf("Name: %s\n", name)
@@ -72,6 +86,7 @@ func serviceCreate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 	cmd.Flags().StringVarP(&name, "name", "n", "", "Name of the service")
 	cmd.Flags().StringVarP(&audience, "audience", "a", "", "JWT audience for the service")
 	cmd.Flags().StringVarP(&loginRedirect, "loginRedirect", "r", "", "The full url of the page where user should be redirect to.")
+	cmd.Flags().StringVar(&algorithm, "algorithm", jwks.DefaultAlgorithm.String(), "Algorithm of the service's signing keys: ES256, ES384, RS256 or EdDSA")
 
 	cmd.MarkFlagRequired("name")
 	cmd.MarkFlagRequired("audience")
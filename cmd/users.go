@@ -9,6 +9,7 @@ import (
 	kuura "github.com/kymppi/kuura/internal"
 	"github.com/kymppi/kuura/internal/services"
 	"github.com/kymppi/kuura/internal/settings"
+	"github.com/kymppi/kuura/internal/users"
 	"github.com/manifoldco/promptui"
 	"github.com/opencoff/go-srp"
 	"github.com/spf13/cobra"
@@ -22,6 +23,13 @@ func runUsers(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 	}
 
 	usersCmd.AddCommand(usersCreate(logger, config))
+	usersCmd.AddCommand(usersResetTOTP(logger, config))
+	usersCmd.AddCommand(usersRegenerateRecoveryCodes(logger, config))
+	usersCmd.AddCommand(usersRegistration(logger, config))
+	usersCmd.AddCommand(usersInvite(logger, config))
+	usersCmd.AddCommand(usersDisable(logger, config))
+	usersCmd.AddCommand(usersEnable(logger, config))
+	usersCmd.AddCommand(usersRoles(logger, config))
 
 	return usersCmd
 }
@@ -90,6 +98,219 @@ func usersCreate(logger *slog.Logger, config *kuura.Config) *cobra.Command {
 	}
 }
 
+func usersResetTOTP(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "reset-totp [username]",
+		Short: "Remove a user's authenticator app so they can log in with their password and enroll again",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[0], err)
+				return
+			}
+
+			reset, err := userService.ResetTOTP(ctx, uid)
+			if err != nil {
+				cmd.PrintErrf("Failed to reset TOTP: %s", err)
+				return
+			}
+
+			if !reset {
+				cmd.Printf("User '%s' has no authenticator app set up.\n", args[0])
+				return
+			}
+
+			cmd.Printf("Authenticator app of user '%s' removed.\n", args[0])
+		},
+	}
+}
+
+func usersRegenerateRecoveryCodes(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "regenerate-recovery-codes [username]",
+		Short: "Replace a user's recovery codes, the earlier codes stop working",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[0], err)
+				return
+			}
+
+			codes, err := userService.RegenerateRecoveryCodes(ctx, uid)
+			if err != nil {
+				cmd.PrintErrf("Failed to regenerate recovery codes: %s", err)
+				return
+			}
+
+			cmd.Printf("New recovery codes of user '%s', each works once:\n", args[0])
+			for _, code := range codes {
+				cmd.Println(code)
+			}
+		},
+	}
+}
+
+func usersDisable(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "disable [username]",
+		Short: "Block a user from logging in and end their sessions, issued access tokens work until they expire",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[0], err)
+				return
+			}
+
+			if err := userService.DisableUser(ctx, uid); err != nil {
+				cmd.PrintErrf("Failed to disable user: %s", err)
+				return
+			}
+
+			cmd.Printf("User '%s' disabled and logged out.\n", args[0])
+		},
+	}
+}
+
+func usersEnable(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "enable [username]",
+		Short: "Let a disabled user log in again",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			uid, err := userService.GetUserIdByUsername(ctx, args[0])
+			if err != nil {
+				cmd.PrintErrf("Failed to find user '%s': %s", args[0], err)
+				return
+			}
+
+			if err := userService.EnableUser(ctx, uid); err != nil {
+				cmd.PrintErrf("Failed to enable user: %s", err)
+				return
+			}
+
+			cmd.Printf("User '%s' enabled.\n", args[0])
+		},
+	}
+}
+
+func usersRegistration(logger *slog.Logger, config *kuura.Config) *cobra.Command {
+	var usernamePattern string
+
+	cmd := &cobra.Command{
+		Use:   "registration [closed|open|invite-only]",
+		Short: "Show or change who can register through the web frontend",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+
+			userService, cleanup, err := initUserService(ctx, logger, config)
+			if err != nil {
+				cmd.PrintErrf("Failed to initialize user service: %s", err)
+				return
+			}
+			defer cleanup()
+
+			policy, err := userService.GetRegistrationPolicy(ctx)
+			if err != nil {
+				cmd.PrintErrf("Failed to get registration policy: %s", err)
+				return
+			}
+
+			if len(args) == 0 && !cmd.Flags().Changed("username-pattern") {
+				cmd.Printf("Registration: %s\n", policy.Mode)
+				if policy.UsernamePattern != "" {
+					cmd.Printf("Username pattern: %s\n", policy.UsernamePattern)
+				}
+				return
+			}
+
+			if len(args) == 1 {
+				if policy.Mode, err = users.ParseRegistrationMode(args[0]); err != nil {
+					cmd.PrintErrf("%s\n", err)
+					return
+				}
+			}
+
+			if cmd.Flags().Changed("username-pattern") {
+				policy.UsernamePattern = usernamePattern
+			}
+
+			if err := userService.SetRegistrationPolicy(ctx, policy); err != nil {
+				cmd.PrintErrf("Failed to save registration policy: %s", err)
+				return
+			}
+
+			cmd.Printf("Registration is now %s.\n", policy.Mode)
+		},
+	}
+
+	cmd.Flags().StringVar(&usernamePattern, "username-pattern", "", "regular expression new usernames must match completely, empty allows any")
+
+	return cmd
+}
+
+func initUserService(ctx context.Context, logger *slog.Logger, config *kuura.Config) (*users.UserService, func(), error) {
+	queries, cleanup, err := kuura.InitializeDatabaseConnection(ctx, logger, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	settingsService := settings.NewSettingsService(logger, queries)
+	serviceManager := services.NewServiceManager(logger, queries, settingsService)
+	jwkManager, err := kuura.InitializeJWKManager(ctx, logger, config, queries)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to initialize jwk manager: %w", err)
+	}
+
+	userService, err := kuura.InitializeUserService(ctx, logger, config, queries, jwkManager, serviceManager)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return userService, cleanup, nil
+}
+
 func generateVerifierHash(username, password string) (string, error) {
 	s, err := srp.NewWithHash(crypto.SHA256, 4096)
 	if err != nil {
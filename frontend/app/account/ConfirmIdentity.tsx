@@ -0,0 +1,99 @@
+import { Button, PasswordInput, Stack, TextInput } from '@carbon/react';
+import { useState } from 'react';
+import { Form } from 'react-router';
+import { useAuthentication } from '../hooks/useAuthentication';
+
+// shown when the server answers K0218, the change is retried once onConfirmed runs
+export default function ConfirmIdentity({
+  onConfirmed,
+  onCancel,
+}: {
+  readonly onConfirmed: () => void;
+  readonly onCancel: () => void;
+}) {
+  const { user, client } = useAuthentication();
+  const [password, setPassword] = useState('');
+  const [code, setCode] = useState('');
+  const [inlineError, setInlineError] = useState<string | null>(null);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setInlineError(null);
+
+    if (!user) return;
+
+    if (code) {
+      if (!(await client.reauthenticateWithTOTP(code.replace(/\s/g, '')))) {
+        setInlineError('Invalid verification code');
+        return;
+      }
+    } else {
+      const result = await client.reauthenticateWithPassword(
+        user.username,
+        password
+      );
+      if (!result.success) {
+        setInlineError(result.error);
+        return;
+      }
+    }
+
+    onConfirmed();
+  };
+
+  const usePasskey = async () => {
+    setInlineError(null);
+
+    if (!(await client.reauthenticateWithPasskey())) {
+      setInlineError('Failed to confirm with a passkey');
+      return;
+    }
+
+    onConfirmed();
+  };
+
+  return (
+    <Form onSubmit={handleSubmit}>
+      <Stack gap="1rem">
+        <h3>Confirm it's you</h3>
+        <p>
+          Enter your password
+          {user?.totp_enabled && ' or a code from your authenticator app'} to
+          continue.
+        </p>
+        <PasswordInput
+          id="confirm-password"
+          labelText="Password"
+          autoComplete="current-password"
+          value={password}
+          onChange={(e) => setPassword(e.target.value)}
+          disabled={!!code}
+        />
+        {user?.totp_enabled && (
+          <TextInput
+            id="confirm-totp-code"
+            labelText="Verification code"
+            placeholder="123456"
+            autoComplete="one-time-code"
+            inputMode="numeric"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+            disabled={!!password}
+          />
+        )}
+        {inlineError && <p style={{ color: 'red' }}>{inlineError}</p>}
+        <Stack orientation="horizontal" gap="1rem">
+          <Button type="submit" disabled={!password && !code}>
+            Confirm
+          </Button>
+          <Button kind="ghost" onClick={usePasskey}>
+            Use a passkey
+          </Button>
+          <Button kind="ghost" onClick={onCancel}>
+            Cancel
+          </Button>
+        </Stack>
+      </Stack>
+    </Form>
+  );
+}
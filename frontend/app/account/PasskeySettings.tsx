@@ -0,0 +1,118 @@
+import { Button, Stack, TextInput } from '@carbon/react';
+import { useEffect, useState } from 'react';
+import { Form } from 'react-router';
+import { useAuthentication } from '../hooks/useAuthentication';
+import { REAUTHENTICATION_REQUIRED, type Passkey } from '../lib/auth.client';
+import ConfirmIdentity from './ConfirmIdentity';
+import { RecoveryCodeList } from './RecoveryCodes';
+
+export default function PasskeySettings() {
+  const { client, refreshUser } = useAuthentication();
+  const [passkeys, setPasskeys] = useState<Passkey[]>([]);
+  const [name, setName] = useState('');
+  const [inlineError, setInlineError] = useState<string | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  // the change to retry once the identity is confirmed
+  const [confirming, setConfirming] = useState<(() => void) | null>(null);
+
+  const loadPasskeys = async () => {
+    setPasskeys(await client.getPasskeys());
+  };
+
+  useEffect(() => {
+    loadPasskeys();
+  }, []);
+
+  const register = async () => {
+    setInlineError(null);
+
+    const passkey = await client.registerPasskey(name);
+    if (passkey === REAUTHENTICATION_REQUIRED) {
+      setConfirming(() => register);
+      return;
+    }
+    if (!passkey) {
+      setInlineError('Failed to add a passkey');
+      return;
+    }
+
+    setName('');
+    setRecoveryCodes(passkey.recovery_codes ?? []);
+    await loadPasskeys();
+    await refreshUser();
+  };
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    await register();
+  };
+
+  const handleDelete = async (id: string) => {
+    setInlineError(null);
+
+    const deleted = await client.deletePasskey(id);
+    if (deleted === REAUTHENTICATION_REQUIRED) {
+      setConfirming(() => () => handleDelete(id));
+      return;
+    }
+    if (!deleted) {
+      setInlineError('Failed to remove the passkey');
+      return;
+    }
+
+    await loadPasskeys();
+    await refreshUser();
+  };
+
+  if (confirming) {
+    return (
+      <Stack gap="1rem">
+        <h2>Passkeys</h2>
+        <ConfirmIdentity
+          onConfirmed={() => {
+            setConfirming(null);
+            confirming();
+          }}
+          onCancel={() => setConfirming(null)}
+        />
+      </Stack>
+    );
+  }
+
+  return (
+    <Form onSubmit={handleSubmit}>
+      <Stack gap="1rem">
+        <h2>Passkeys</h2>
+        <p>Log in without a password, or use a passkey as a second factor.</p>
+        {recoveryCodes.length > 0 && <RecoveryCodeList codes={recoveryCodes} />}
+        {passkeys.map((passkey) => (
+          <Stack key={passkey.id} orientation="horizontal" gap="1rem">
+            <span>
+              {passkey.name || 'Passkey'} (added{' '}
+              {new Date(passkey.created_at).toLocaleDateString()})
+            </span>
+            <Button
+              kind="danger--ghost"
+              size="sm"
+              onClick={() => handleDelete(passkey.id)}
+            >
+              Remove
+            </Button>
+          </Stack>
+        ))}
+        <TextInput
+          id="passkey-name"
+          labelText="Name"
+          placeholder="My laptop"
+          maxLength={64}
+          value={name}
+          onChange={(e) => setName(e.target.value)}
+        />
+        {inlineError && <p style={{ color: 'red' }}>{inlineError}</p>}
+        <Button kind="tertiary" type="submit">
+          Add a passkey
+        </Button>
+      </Stack>
+    </Form>
+  );
+}
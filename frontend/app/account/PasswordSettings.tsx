@@ -0,0 +1,86 @@
+import { Button, PasswordInput, Stack } from '@carbon/react';
+import { useState } from 'react';
+import { Form } from 'react-router';
+import { useAuthentication } from '../hooks/useAuthentication';
+
+export default function PasswordSettings() {
+  const { user, client } = useAuthentication();
+  const [currentPassword, setCurrentPassword] = useState('');
+  const [newPassword, setNewPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [inlineError, setInlineError] = useState<string | null>(null);
+  const [changed, setChanged] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setInlineError(null);
+    setChanged(false);
+
+    if (!user) return;
+
+    if (newPassword.length < 16) {
+      setInlineError('Password must be at least 16 characters long');
+      return;
+    }
+
+    if (newPassword !== confirmPassword) {
+      setInlineError('Passwords do not match');
+      return;
+    }
+
+    const result = await client.changePassword(
+      user.username,
+      currentPassword,
+      newPassword
+    );
+
+    if (!result.success) {
+      setInlineError(result.error);
+      return;
+    }
+
+    setCurrentPassword('');
+    setNewPassword('');
+    setConfirmPassword('');
+    setChanged(true);
+  };
+
+  return (
+    <Form onSubmit={handleSubmit}>
+      <Stack gap="1rem">
+        <h2>Password</h2>
+        <PasswordInput
+          id="current-password"
+          labelText="Current password"
+          autoComplete="current-password"
+          value={currentPassword}
+          onChange={(e) => setCurrentPassword(e.target.value)}
+          required
+        />
+        <PasswordInput
+          id="new-password"
+          labelText="New password"
+          autoComplete="new-password"
+          value={newPassword}
+          onChange={(e) => setNewPassword(e.target.value)}
+          required
+        />
+        <PasswordInput
+          id="confirm-password"
+          labelText="Confirm new password"
+          autoComplete="new-password"
+          value={confirmPassword}
+          onChange={(e) => setConfirmPassword(e.target.value)}
+          required
+        />
+        {inlineError && <p style={{ color: 'red' }}>{inlineError}</p>}
+        {changed && (
+          <p>Password changed. Your other sessions have been logged out.</p>
+        )}
+        <Button kind="tertiary" type="submit">
+          Change password
+        </Button>
+      </Stack>
+    </Form>
+  );
+}
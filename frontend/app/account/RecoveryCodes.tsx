@@ -0,0 +1,74 @@
+import { Button, Stack } from '@carbon/react';
+import { useState } from 'react';
+import { useAuthentication } from '../hooks/useAuthentication';
+import { REAUTHENTICATION_REQUIRED } from '../lib/auth.client';
+import ConfirmIdentity from './ConfirmIdentity';
+
+export function RecoveryCodeList({ codes }: { readonly codes: string[] }) {
+  return (
+    <Stack gap="0.5rem">
+      <p>
+        Save these recovery codes somewhere safe. Each of them can be used once
+        to log in if you lose your second factor, and they won't be shown
+        again.
+      </p>
+      <pre>{codes.join('\n')}</pre>
+    </Stack>
+  );
+}
+
+export default function RecoveryCodeSettings() {
+  const { user, client, refreshUser } = useAuthentication();
+  const [codes, setCodes] = useState<string[] | null>(null);
+  const [inlineError, setInlineError] = useState<string | null>(null);
+  const [confirming, setConfirming] = useState(false);
+
+  if (!user?.recovery_codes_remaining && !codes) {
+    return null;
+  }
+
+  const regenerate = async () => {
+    setInlineError(null);
+
+    const result = await client.regenerateRecoveryCodes();
+    if (result === REAUTHENTICATION_REQUIRED) {
+      setConfirming(true);
+      return;
+    }
+    if (!result) {
+      setInlineError('Failed to generate new recovery codes');
+      return;
+    }
+
+    setCodes(result);
+    await refreshUser();
+  };
+
+  return (
+    <Stack gap="1rem">
+      <h2>Recovery codes</h2>
+      {codes ? (
+        <RecoveryCodeList codes={codes} />
+      ) : (
+        <p>
+          {user?.recovery_codes_remaining} unused recovery codes left.
+          Generating new ones invalidates the old codes.
+        </p>
+      )}
+      {inlineError && <p style={{ color: 'red' }}>{inlineError}</p>}
+      {confirming ? (
+        <ConfirmIdentity
+          onConfirmed={() => {
+            setConfirming(false);
+            regenerate();
+          }}
+          onCancel={() => setConfirming(false)}
+        />
+      ) : (
+        <Button kind="tertiary" onClick={regenerate}>
+          Generate new codes
+        </Button>
+      )}
+    </Stack>
+  );
+}
@@ -0,0 +1,151 @@
+import { Button, Stack, TextInput } from '@carbon/react';
+import { useState } from 'react';
+import { Form } from 'react-router';
+import { useAuthentication } from '../hooks/useAuthentication';
+import {
+  REAUTHENTICATION_REQUIRED,
+  type TOTPEnrollment,
+} from '../lib/auth.client';
+import ConfirmIdentity from './ConfirmIdentity';
+import { RecoveryCodeList } from './RecoveryCodes';
+
+export default function TOTPSettings() {
+  const { user, client, refreshUser } = useAuthentication();
+  const [enrollment, setEnrollment] = useState<TOTPEnrollment | null>(null);
+  const [code, setCode] = useState('');
+  const [inlineError, setInlineError] = useState<string | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [confirming, setConfirming] = useState(false);
+
+  const startEnrollment = async () => {
+    setInlineError(null);
+
+    const result = await client.enrollTOTP();
+    if (result === REAUTHENTICATION_REQUIRED) {
+      setConfirming(true);
+      return;
+    }
+    if (!result) {
+      setInlineError('Failed to set up an authenticator app');
+      return;
+    }
+
+    setEnrollment(result);
+  };
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setInlineError(null);
+
+    const normalized = code.replace(/\s/g, '');
+
+    if (enrollment) {
+      const codes = await client.confirmTOTP(normalized);
+      if (codes === REAUTHENTICATION_REQUIRED) {
+        // the confirmation window ran out while setting up the app, the same secret stays pending
+        setConfirming(true);
+        return;
+      }
+      if (!codes) {
+        setInlineError('Invalid verification code');
+        return;
+      }
+
+      setRecoveryCodes(codes);
+    } else if (!(await client.disableTOTP(normalized))) {
+      setInlineError('Invalid verification code');
+      return;
+    } else {
+      setRecoveryCodes([]);
+    }
+
+    setEnrollment(null);
+    setCode('');
+    await refreshUser();
+  };
+
+  const codeInput = (
+    <TextInput
+      id="totp-code"
+      labelText="Verification code"
+      placeholder="123456"
+      autoComplete="one-time-code"
+      inputMode="numeric"
+      value={code}
+      onChange={(e) => setCode(e.target.value)}
+      required
+    />
+  );
+
+  if (confirming) {
+    return (
+      <Stack gap="1rem">
+        <h2>Authenticator app</h2>
+        <ConfirmIdentity
+          onConfirmed={() => {
+            setConfirming(false);
+            if (!enrollment) startEnrollment();
+          }}
+          onCancel={() => setConfirming(false)}
+        />
+      </Stack>
+    );
+  }
+
+  if (enrollment) {
+    return (
+      <Form onSubmit={handleSubmit}>
+        <Stack gap="1rem">
+          <h2>Set up an authenticator app</h2>
+          <p>
+            Scan the QR code with your authenticator app, then enter the code
+            it shows.
+          </p>
+          <img
+            src={enrollment.qr_code}
+            alt="Authenticator QR code"
+            width={200}
+            height={200}
+          />
+          <p>
+            Can't scan it? <a href={enrollment.uri}>Open it in the app</a> or
+            enter this key instead: <code>{enrollment.secret}</code>
+          </p>
+          {codeInput}
+          {inlineError && <p style={{ color: 'red' }}>{inlineError}</p>}
+          <Button type="submit">Enable</Button>
+        </Stack>
+      </Form>
+    );
+  }
+
+  if (user?.totp_enabled) {
+    return (
+      <Form onSubmit={handleSubmit}>
+        <Stack gap="1rem">
+          <h2>Authenticator app</h2>
+          {recoveryCodes.length > 0 && (
+            <RecoveryCodeList codes={recoveryCodes} />
+          )}
+          <p>Enabled. Enter a current code to turn it off.</p>
+          {codeInput}
+          {inlineError && <p style={{ color: 'red' }}>{inlineError}</p>}
+          <Button kind="danger" type="submit">
+            Disable
+          </Button>
+        </Stack>
+      </Form>
+    );
+  }
+
+  return (
+    <Stack gap="1rem">
+      <h2>Authenticator app</h2>
+      <p>Require a code from an authenticator app when logging in.</p>
+      {inlineError && <p style={{ color: 'red' }}>{inlineError}</p>}
+      <Button kind="tertiary" onClick={startEnrollment}>
+        Set up
+      </Button>
+    </Stack>
+  );
+}
@@ -5,6 +5,8 @@ export interface User {
   id: string;
   username: string;
   last_login_at: Date;
+  totp_enabled: boolean;
+  recovery_codes_remaining: number;
 }
 
 export const AuthContext = createContext<{
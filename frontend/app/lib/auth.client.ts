@@ -9,9 +9,19 @@ import {
   type PrimeField,
   type SRPClientInstance,
 } from './srp.client';
+import {
+  createCredential,
+  getAssertion,
+  isWebAuthnSupported,
+  type CreationOptionsJSON,
+  type RequestOptionsJSON,
+} from './webauthn.client';
 
 export type LoginError =
   | 'INVALID_CREDENTIALS'
+  | 'INVALID_CODE'
+  | 'ACCOUNT_DISABLED'
+  | 'SERVICE_ACCESS_DENIED'
   | 'SERVER_ERROR'
   | 'NETWORK_ERROR'
   | 'SUSPICIOUS_SERVER'
@@ -19,6 +29,13 @@ export type LoginError =
   | 'TOKEN_REFRESH_FAILED'
   | 'TOKEN_REFRESH_COOLDOWN';
 
+// K0218, sensitive account changes need the identity confirmed again within a few minutes
+export const REAUTHENTICATION_REQUIRED = 'REAUTHENTICATION_REQUIRED';
+
+function isReauthenticationRequired(error: unknown): boolean {
+  return axios.isAxiosError(error) && error.response?.data?.code === 'K0218';
+}
+
 interface AuthenticationResponse {
   data: string;
 }
@@ -26,13 +43,47 @@ interface AuthenticationResponse {
 interface VerificationResponse {
   success: boolean;
   data: string;
+  mfa_required?: boolean;
+  mfa_token?: string;
+  mfa_methods?: string[];
+}
+
+export interface MFAChallenge {
+  token: string;
+  methods: string[];
+}
+
+export interface TOTPEnrollment {
+  secret: string;
+  uri: string;
+  qr_code: string; // PNG data URL
+}
+
+export interface Passkey {
+  id: string;
+  name: string;
+  transports: string[];
+  created_at: string;
+  last_used_at: string | null;
+  recovery_codes?: string[];
+}
+
+export interface RegistrationPolicy {
+  mode: 'closed' | 'open' | 'invite-only';
+  username_pattern?: string;
 }
 
 interface TokenRefreshResponse {
   success: boolean;
 }
 
-const SKIP_REFRESH_URLS = ['/v1/srp', '/v1/logout', '/v1/user/tokens/internal'];
+const SKIP_REFRESH_URLS = [
+  '/v1/srp',
+  '/v1/mfa',
+  '/v1/webauthn',
+  '/v1/logout',
+  '/v1/user/tokens/internal',
+];
 
 export class SRPAuthClient {
   private readonly srpClient: SRPClient;
@@ -135,7 +186,10 @@ export class SRPAuthClient {
     loginTarget: string,
     username: string,
     password: string
-  ): Promise<{ success: true } | { success: false; error: LoginError }> {
+  ): Promise<
+    | { success: true; mfa?: MFAChallenge }
+    | { success: false; error: LoginError }
+  > {
     if (!this.isClientSupported()) {
       return { success: false, error: 'CLIENT_UNSUPPORTED' };
     }
@@ -169,6 +223,312 @@ export class SRPAuthClient {
 
       if (!serverOk) return { success: false, error: 'SUSPICIOUS_SERVER' };
 
+      // the session is only created once the second factor is verified
+      if (verifyResponse.mfa) {
+        return { success: true, mfa: verifyResponse.mfa };
+      }
+
+      return { success: true };
+    } catch (error) {
+      return this.handleLoginError(error);
+    }
+  }
+
+  public async changePassword(
+    username: string,
+    currentPassword: string,
+    newPassword: string
+  ): Promise<{ success: true } | { success: false; error: LoginError }> {
+    if (!this.isClientSupported()) {
+      return { success: false, error: 'CLIENT_UNSUPPORTED' };
+    }
+
+    try {
+      // the handshake expires in seconds, so the slow part is done first
+      const verifier = await this.srpClient.createVerifier(
+        new TextEncoder().encode(username),
+        new TextEncoder().encode(newPassword)
+      );
+
+      const client = await this.srpClient.newClient(
+        new TextEncoder().encode(username),
+        new TextEncoder().encode(currentPassword)
+      );
+
+      const begin = await this.request<AuthenticationResponse>(
+        '/v1/me/password/begin',
+        'POST',
+        { data: this.srpClient.getCredentials(client) }
+      );
+
+      const proof = await this.srpClient.getVerifyData(client, begin.data);
+
+      const response = await this.request<{ success: boolean; data: string }>(
+        '/v1/me/password',
+        'POST',
+        {
+          identity: this.srpClient.getIdentity(client),
+          data: proof,
+          verifier,
+        }
+      );
+
+      if (!response?.success) {
+        return { success: false, error: 'INVALID_CREDENTIALS' };
+      }
+
+      const serverOk = await this.srpClient.verifyServer(client, response.data);
+      if (!serverOk) return { success: false, error: 'SUSPICIOUS_SERVER' };
+
+      return { success: true };
+    } catch (error) {
+      return this.handleLoginError(error);
+    }
+  }
+
+  public async reauthenticateWithPassword(
+    username: string,
+    password: string
+  ): Promise<{ success: true } | { success: false; error: LoginError }> {
+    if (!this.isClientSupported()) {
+      return { success: false, error: 'CLIENT_UNSUPPORTED' };
+    }
+
+    try {
+      const client = await this.srpClient.newClient(
+        new TextEncoder().encode(username),
+        new TextEncoder().encode(password)
+      );
+
+      const begin = await this.request<AuthenticationResponse>(
+        '/v1/me/reauth/srp/begin',
+        'POST',
+        { data: this.srpClient.getCredentials(client) }
+      );
+
+      const proof = await this.srpClient.getVerifyData(client, begin.data);
+
+      const response = await this.request<{ success: boolean; data: string }>(
+        '/v1/me/reauth/srp',
+        'POST',
+        { identity: this.srpClient.getIdentity(client), data: proof }
+      );
+
+      if (!response?.success) {
+        return { success: false, error: 'INVALID_CREDENTIALS' };
+      }
+
+      const serverOk = await this.srpClient.verifyServer(client, response.data);
+      if (!serverOk) return { success: false, error: 'SUSPICIOUS_SERVER' };
+
+      return { success: true };
+    } catch (error) {
+      return this.handleLoginError(error);
+    }
+  }
+
+  public async reauthenticateWithTOTP(code: string): Promise<boolean> {
+    try {
+      const response = await this.axiosInstance.post<{ success: boolean }>(
+        '/v1/me/reauth/totp',
+        { code }
+      );
+
+      return response.data.success;
+    } catch (error) {
+      console.error('Failed to confirm identity:', error);
+      return false;
+    }
+  }
+
+  public async reauthenticateWithPasskey(): Promise<boolean> {
+    if (!isWebAuthnSupported()) {
+      return false;
+    }
+
+    try {
+      const options = await this.axiosInstance.post<RequestOptionsJSON>(
+        '/v1/me/reauth/webauthn/begin'
+      );
+
+      const credential = await getAssertion(options.data);
+
+      const response = await this.axiosInstance.post<{ success: boolean }>(
+        '/v1/me/reauth/webauthn',
+        { credential }
+      );
+
+      return response.data.success;
+    } catch (error) {
+      console.error('Failed to confirm identity:', error);
+      return false;
+    }
+  }
+
+  public async getRegistrationPolicy(): Promise<RegistrationPolicy> {
+    try {
+      const response =
+        await this.axiosInstance.get<RegistrationPolicy>('/v1/register');
+
+      return response.data;
+    } catch (error) {
+      console.error('Failed to get registration policy:', error);
+      return { mode: 'closed' };
+    }
+  }
+
+  // the verifier is computed here so the password never reaches the server,
+  // on failure error is the server's description of the problem. An
+  // invitation token lets the user register even when registration is closed
+  public async register(
+    username: string,
+    password: string,
+    invitation?: string
+  ): Promise<{ success: true } | { success: false; error: string }> {
+    if (!this.isClientSupported()) {
+      return { success: false, error: 'CLIENT_UNSUPPORTED' };
+    }
+
+    try {
+      const verifier = await this.srpClient.createVerifier(
+        new TextEncoder().encode(username),
+        new TextEncoder().encode(password)
+      );
+
+      await this.axiosInstance.post('/v1/register', {
+        username,
+        verifier,
+        invitation,
+      });
+
+      return { success: true };
+    } catch (error) {
+      console.error('Registration failed:', error);
+
+      if (axios.isAxiosError(error) && error.response?.data?.message) {
+        return { success: false, error: error.response.data.message };
+      }
+
+      return { success: false, error: 'SERVER_ERROR' };
+    }
+  }
+
+  public async verifyTOTP(
+    mfaToken: string,
+    code: string
+  ): Promise<{ success: true } | { success: false; error: LoginError }> {
+    try {
+      const response = await this.request<{ success: boolean }>(
+        '/v1/mfa/totp',
+        'POST',
+        {
+          mfa_token: mfaToken,
+          code,
+        }
+      );
+
+      if (!response?.success) {
+        return { success: false, error: 'INVALID_CODE' };
+      }
+
+      return { success: true };
+    } catch (error) {
+      const result = this.handleLoginError(error);
+      if (result.error === 'INVALID_CREDENTIALS') {
+        return { success: false, error: 'INVALID_CODE' };
+      }
+
+      return result;
+    }
+  }
+
+  public async verifyRecoveryCode(
+    mfaToken: string,
+    code: string
+  ): Promise<{ success: true } | { success: false; error: LoginError }> {
+    try {
+      const response = await this.request<{ success: boolean }>(
+        '/v1/mfa/recovery',
+        'POST',
+        {
+          mfa_token: mfaToken,
+          code,
+        }
+      );
+
+      if (!response?.success) {
+        return { success: false, error: 'INVALID_CODE' };
+      }
+
+      return { success: true };
+    } catch (error) {
+      const result = this.handleLoginError(error);
+      if (result.error === 'INVALID_CREDENTIALS') {
+        return { success: false, error: 'INVALID_CODE' };
+      }
+
+      return result;
+    }
+  }
+
+  public async loginWithPasskey(
+    loginTarget: string
+  ): Promise<{ success: true } | { success: false; error: LoginError }> {
+    if (!isWebAuthnSupported()) {
+      return { success: false, error: 'CLIENT_UNSUPPORTED' };
+    }
+
+    try {
+      const options = await this.request<RequestOptionsJSON>(
+        '/v1/webauthn/login/begin',
+        'POST',
+        { target_service: loginTarget }
+      );
+
+      const credential = await getAssertion(options);
+
+      const response = await this.request<{ success: boolean }>(
+        '/v1/webauthn/login/finish',
+        'POST',
+        { credential }
+      );
+
+      if (!response?.success) {
+        return { success: false, error: 'INVALID_CREDENTIALS' };
+      }
+
+      return { success: true };
+    } catch (error) {
+      return this.handleLoginError(error);
+    }
+  }
+
+  public async verifyPasskey(
+    mfaToken: string
+  ): Promise<{ success: true } | { success: false; error: LoginError }> {
+    if (!isWebAuthnSupported()) {
+      return { success: false, error: 'CLIENT_UNSUPPORTED' };
+    }
+
+    try {
+      const options = await this.request<RequestOptionsJSON>(
+        '/v1/mfa/webauthn/begin',
+        'POST',
+        { mfa_token: mfaToken }
+      );
+
+      const credential = await getAssertion(options);
+
+      const response = await this.request<{ success: boolean }>(
+        '/v1/mfa/webauthn',
+        'POST',
+        { mfa_token: mfaToken, credential }
+      );
+
+      if (!response?.success) {
+        return { success: false, error: 'INVALID_CREDENTIALS' };
+      }
+
       return { success: true };
     } catch (error) {
       return this.handleLoginError(error);
@@ -209,7 +569,7 @@ export class SRPAuthClient {
   private async processServerChallenge(
     serverData: string,
     loginTarget: string
-  ): Promise<{ success: boolean; data: string }> {
+  ): Promise<{ success: boolean; data: string; mfa?: MFAChallenge }> {
     if (!this.currentClient) return { success: false, data: '' };
 
     const payload = await this.srpClient.getVerifyData(
@@ -228,7 +588,12 @@ export class SRPAuthClient {
         }
       );
 
-      return { success: !!response?.success, data: response.data };
+      const mfa =
+        response?.mfa_required && response.mfa_token
+          ? { token: response.mfa_token, methods: response.mfa_methods ?? [] }
+          : undefined;
+
+      return { success: !!response?.success, data: response.data, mfa };
     } catch (error) {
       console.error('Challenge verification failed:', error);
       throw error;
@@ -269,6 +634,16 @@ export class SRPAuthClient {
           throw new Error('Invalid credentials');
         }
 
+        // K0217, the account was disabled by an admin
+        if (error.response?.data?.code === 'K0217') {
+          throw new Error('ACCOUNT_DISABLED');
+        }
+
+        // K0502, the service's access policy does not let the user in
+        if (error.response?.data?.code === 'K0502') {
+          throw new Error('SERVICE_ACCESS_DENIED');
+        }
+
         throw new Error(
           `HTTP error! status: ${error.response?.status ?? 'unknown'}`
         );
@@ -290,6 +665,12 @@ export class SRPAuthClient {
       if (error.message.includes('Invalid credentials')) {
         return { success: false, error: 'INVALID_CREDENTIALS' };
       }
+      if (error.message === 'ACCOUNT_DISABLED') {
+        return { success: false, error: 'ACCOUNT_DISABLED' };
+      }
+      if (error.message === 'SERVICE_ACCESS_DENIED') {
+        return { success: false, error: 'SERVICE_ACCESS_DENIED' };
+      }
       if (error.message === 'TOKEN_REFRESH_FAILED') {
         return { success: false, error: 'TOKEN_REFRESH_FAILED' };
       }
@@ -322,6 +703,8 @@ export class SRPAuthClient {
         id: string;
         username: string;
         last_login_at: string;
+        totp_enabled: boolean;
+        recovery_codes_remaining: number;
       }>('/v1/me');
 
       return {
@@ -347,6 +730,134 @@ export class SRPAuthClient {
     }
   }
 
+  public async enrollTOTP(): Promise<
+    TOTPEnrollment | typeof REAUTHENTICATION_REQUIRED | null
+  > {
+    try {
+      const response =
+        await this.axiosInstance.post<TOTPEnrollment>('/v1/me/totp');
+
+      return response.data;
+    } catch (error) {
+      if (isReauthenticationRequired(error)) return REAUTHENTICATION_REQUIRED;
+
+      console.error('Failed to start authenticator enrollment:', error);
+      return null;
+    }
+  }
+
+  // resolves to the new recovery codes, empty if the user already had some,
+  // or null on failure
+  public async confirmTOTP(
+    code: string
+  ): Promise<string[] | typeof REAUTHENTICATION_REQUIRED | null> {
+    try {
+      const response = await this.axiosInstance.post<{
+        success: boolean;
+        recovery_codes?: string[];
+      }>('/v1/me/totp/confirm', { code });
+
+      if (!response.data.success) {
+        return null;
+      }
+
+      return response.data.recovery_codes ?? [];
+    } catch (error) {
+      if (isReauthenticationRequired(error)) return REAUTHENTICATION_REQUIRED;
+
+      console.error('Failed to confirm authenticator:', error);
+      return null;
+    }
+  }
+
+  public async regenerateRecoveryCodes(): Promise<
+    string[] | typeof REAUTHENTICATION_REQUIRED | null
+  > {
+    try {
+      const response = await this.axiosInstance.post<{
+        recovery_codes: string[];
+      }>('/v1/me/recovery-codes');
+
+      return response.data.recovery_codes;
+    } catch (error) {
+      if (isReauthenticationRequired(error)) return REAUTHENTICATION_REQUIRED;
+
+      console.error('Failed to regenerate recovery codes:', error);
+      return null;
+    }
+  }
+
+  public async disableTOTP(code: string): Promise<boolean> {
+    try {
+      const response = await this.axiosInstance.delete<{ success: boolean }>(
+        '/v1/me/totp',
+        { data: { code } }
+      );
+
+      return response.data.success;
+    } catch (error) {
+      console.error('Failed to disable authenticator:', error);
+      return false;
+    }
+  }
+
+  public async getPasskeys(): Promise<Passkey[]> {
+    try {
+      const response =
+        await this.axiosInstance.get<Passkey[]>('/v1/me/webauthn');
+
+      return response.data;
+    } catch (error) {
+      console.error('Failed to get passkeys:', error);
+      return [];
+    }
+  }
+
+  public async registerPasskey(
+    name: string
+  ): Promise<Passkey | typeof REAUTHENTICATION_REQUIRED | null> {
+    if (!isWebAuthnSupported()) {
+      return null;
+    }
+
+    try {
+      const options = await this.axiosInstance.post<CreationOptionsJSON>(
+        '/v1/me/webauthn/register/begin'
+      );
+
+      const credential = await createCredential(options.data);
+
+      const response = await this.axiosInstance.post<Passkey>(
+        '/v1/me/webauthn/register/finish',
+        { name, credential }
+      );
+
+      return response.data;
+    } catch (error) {
+      if (isReauthenticationRequired(error)) return REAUTHENTICATION_REQUIRED;
+
+      console.error('Failed to register passkey:', error);
+      return null;
+    }
+  }
+
+  public async deletePasskey(
+    id: string
+  ): Promise<boolean | typeof REAUTHENTICATION_REQUIRED> {
+    try {
+      const response = await this.axiosInstance.delete<{ success: boolean }>(
+        `/v1/me/webauthn/${encodeURIComponent(id)}`
+      );
+
+      return response.data.success;
+    } catch (error) {
+      if (isReauthenticationRequired(error)) return REAUTHENTICATION_REQUIRED;
+
+      console.error('Failed to delete passkey:', error);
+      return false;
+    }
+  }
+
   public async loginToService(serviceId: string): Promise<string> {
     try {
       const response = await this.axiosInstance.post<{ redirect_url: string }>(
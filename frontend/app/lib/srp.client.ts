@@ -62,6 +62,36 @@ export class SRPClient {
     };
   }
 
+  /**
+   * Creates a password verifier in the same format as the Go version's
+   * Verifier.Encode, so the password never has to leave the browser
+   */
+  async createVerifier(I: Uint8Array, p: Uint8Array): Promise<string> {
+    const i = await this.hashbyte(I);
+    const hashedPassword = await this.hashbyte(p);
+
+    const salt = new Uint8Array(32);
+    crypto.getRandomValues(salt);
+
+    // Calculate x = H(i, p, salt) and v = g^x % N
+    const x = await this.hashbigint(i, hashedPassword, salt);
+    const v = modPow(this.pf.g, x, this.pf.N);
+
+    const toHex = (bytes: Uint8Array) =>
+      Array.from(bytes)
+        .map((b) => b.toString(16).padStart(2, '0'))
+        .join('');
+
+    // 5 is crypto.SHA256 in Go
+    return [
+      5,
+      this.pf.n * 8,
+      toHex(this.bigIntToUint8Array(v)),
+      toHex(i),
+      toHex(salt),
+    ].join(':');
+  }
+
   /**
    * Returns the hashed identity
    */
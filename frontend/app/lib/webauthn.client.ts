@@ -0,0 +1,128 @@
+// converts between the JSON options/responses of the kuura API (base64url
+// binary fields) and the ArrayBuffers the WebAuthn browser API works with
+
+export interface CredentialDescriptorJSON {
+  type: 'public-key';
+  id: string;
+  transports?: AuthenticatorTransport[];
+}
+
+export interface CreationOptionsJSON {
+  challenge: string;
+  rp: { id: string; name: string };
+  user: { id: string; name: string; displayName: string };
+  pubKeyCredParams: { type: 'public-key'; alg: number }[];
+  timeout: number;
+  excludeCredentials: CredentialDescriptorJSON[];
+  authenticatorSelection: AuthenticatorSelectionCriteria;
+  attestation: AttestationConveyancePreference;
+}
+
+export interface RequestOptionsJSON {
+  challenge: string;
+  timeout: number;
+  rpId: string;
+  allowCredentials: CredentialDescriptorJSON[];
+  userVerification: UserVerificationRequirement;
+}
+
+export function base64URLToBuffer(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const padded = base64.padEnd(
+    base64.length + ((4 - (base64.length % 4)) % 4),
+    '='
+  );
+  const binary = atob(padded);
+
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+
+  return bytes.buffer;
+}
+
+export function bufferToBase64URL(buffer: ArrayBuffer): string {
+  const bytes = new Uint8Array(buffer);
+
+  let binary = '';
+  for (const byte of bytes) {
+    binary += String.fromCharCode(byte);
+  }
+
+  return btoa(binary)
+    .replace(/\+/g, '-')
+    .replace(/\//g, '_')
+    .replace(/=+$/, '');
+}
+
+function toDescriptor(
+  descriptor: CredentialDescriptorJSON
+): PublicKeyCredentialDescriptor {
+  return { ...descriptor, id: base64URLToBuffer(descriptor.id) };
+}
+
+export function isWebAuthnSupported(): boolean {
+  return (
+    typeof window !== 'undefined' &&
+    typeof window.PublicKeyCredential !== 'undefined'
+  );
+}
+
+export async function createCredential(options: CreationOptionsJSON) {
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...options,
+      challenge: base64URLToBuffer(options.challenge),
+      user: { ...options.user, id: base64URLToBuffer(options.user.id) },
+      excludeCredentials: options.excludeCredentials.map(toDescriptor),
+    },
+  })) as PublicKeyCredential | null;
+
+  if (!credential) {
+    throw new Error('No credential was created');
+  }
+
+  const response = credential.response as AuthenticatorAttestationResponse;
+
+  return {
+    id: credential.id,
+    rawId: bufferToBase64URL(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: bufferToBase64URL(response.clientDataJSON),
+      attestationObject: bufferToBase64URL(response.attestationObject),
+      transports: response.getTransports?.() ?? [],
+    },
+  };
+}
+
+export async function getAssertion(options: RequestOptionsJSON) {
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...options,
+      challenge: base64URLToBuffer(options.challenge),
+      allowCredentials: options.allowCredentials.map(toDescriptor),
+    },
+  })) as PublicKeyCredential | null;
+
+  if (!credential) {
+    throw new Error('No credential was selected');
+  }
+
+  const response = credential.response as AuthenticatorAssertionResponse;
+
+  return {
+    id: credential.id,
+    rawId: bufferToBase64URL(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: bufferToBase64URL(response.clientDataJSON),
+      authenticatorData: bufferToBase64URL(response.authenticatorData),
+      signature: bufferToBase64URL(response.signature),
+      userHandle: response.userHandle
+        ? bufferToBase64URL(response.userHandle)
+        : undefined,
+    },
+  };
+}
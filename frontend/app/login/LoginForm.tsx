@@ -1,7 +1,8 @@
 import { Button, PasswordInput, Stack, TextInput } from '@carbon/react';
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { Form } from 'react-router';
 import { useAuthentication } from '../hooks/useAuthentication';
+import type { MFAChallenge } from '../lib/auth.client';
 import type { ServiceInfo } from '../lib/service.client';
 
 export default function LoginForm({
@@ -17,6 +18,17 @@ export default function LoginForm({
   const [inlineError, setInlineError] = useState<string | null>(null);
   const [usernameInvalid, setUsernameInvalid] = useState(false);
   const [passwordInvalid, setPasswordInvalid] = useState(false);
+  const [mfa, setMfa] = useState<MFAChallenge | null>(null);
+  const [code, setCode] = useState('');
+  const [codeInvalid, setCodeInvalid] = useState(false);
+  const [recovery, setRecovery] = useState(false);
+  const [registrationOpen, setRegistrationOpen] = useState(false);
+
+  useEffect(() => {
+    client
+      .getRegistrationPolicy()
+      .then((policy) => setRegistrationOpen(policy.mode === 'open'));
+  }, []);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -34,26 +46,174 @@ export default function LoginForm({
 
     const result = await client.login(info.id, username, password);
 
+    if (!result.success) {
+      setInlineError(result.error);
+    } else if (result.mfa) {
+      setInlineError(null);
+      setMfa(result.mfa);
+    } else {
+      setInlineError(null);
+      window.location.href = returnTo;
+    }
+  };
+
+  const handlePasskeyLogin = async () => {
+    setInlineError(null);
+
+    const result = await client.loginWithPasskey(info.id);
+
+    if (!result.success) {
+      setInlineError(result.error);
+    } else {
+      window.location.href = returnTo;
+    }
+  };
+
+  const handlePasskeyVerify = async () => {
+    setInlineError(null);
+
+    if (!mfa) return;
+
+    const result = await client.verifyPasskey(mfa.token);
+
     if (!result.success) {
       setInlineError(result.error);
+    } else {
+      window.location.href = returnTo;
+    }
+  };
+
+  const handleCodeSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+
+    setCodeInvalid(false);
+    setInlineError(null);
+
+    if (!mfa) return;
+
+    if (!code) {
+      setCodeInvalid(true);
+      setInlineError('Verification code is required');
+      return;
+    }
+
+    const result = recovery
+      ? await client.verifyRecoveryCode(mfa.token, code)
+      : await client.verifyTOTP(mfa.token, code.replace(/\s/g, ''));
+
+    if (!result.success) {
+      setCode('');
+      setInlineError(result.error);
     } else {
       setInlineError(null);
       window.location.href = returnTo;
     }
   };
 
+  if (mfa) {
+    const totp = mfa.methods.includes('totp') && !recovery;
+    const passkey = mfa.methods.includes('webauthn') && !recovery;
+
+    return (
+      <Form onSubmit={handleCodeSubmit}>
+        <Stack gap={8}>
+          <Stack gap="0.25rem">
+            <h1>Two-factor authentication</h1>
+            <p>
+              {recovery
+                ? 'Enter one of your recovery codes.'
+                : totp
+                  ? 'Enter the 6-digit code from your authenticator app.'
+                  : 'Confirm the login with your passkey.'}
+            </p>
+          </Stack>
+          <Stack gap="1rem">
+            {recovery && (
+              <TextInput
+                id="recovery-code"
+                labelText="Recovery code"
+                placeholder="xxxxx-xxxxx"
+                autoComplete="off"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                invalid={codeInvalid}
+                invalidText="Recovery code is required"
+                required
+              />
+            )}
+            {totp && (
+              <TextInput
+                id="code"
+                labelText="Verification code"
+                placeholder="123456"
+                autoComplete="one-time-code"
+                inputMode="numeric"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                invalid={codeInvalid}
+                invalidText="Verification code is required"
+                required
+              />
+            )}
+            {inlineError && (
+              <p style={{ color: 'red', marginTop: '0.5rem' }}>
+                {inlineError}
+              </p>
+            )}
+          </Stack>
+
+          {passkey && (
+            <Button
+              kind={totp ? 'tertiary' : 'primary'}
+              onClick={handlePasskeyVerify}
+              style={{ justifySelf: 'flex-end' }}
+            >
+              Use passkey
+            </Button>
+          )}
+          {(totp || recovery) && (
+            <Button type="submit" style={{ justifySelf: 'flex-end' }}>
+              Verify
+            </Button>
+          )}
+          <Button
+            kind="ghost"
+            onClick={() => {
+              setRecovery(!recovery);
+              setCode('');
+              setInlineError(null);
+            }}
+            style={{ justifySelf: 'flex-end' }}
+          >
+            {recovery ? 'Use your second factor' : 'Use a recovery code'}
+          </Button>
+        </Stack>
+      </Form>
+    );
+  }
+
   return (
     <Form onSubmit={handleSubmit}>
       <Stack gap={8}>
         <Stack gap="0.25rem">
           <h1>Log in to {info.name}</h1>
-          <p>
-            Don't have an account? Contact{' '}
-            <a href={info.contact.link} target="_blank">
-              {info.contact.name}
-            </a>
-            .
-          </p>
+          {registrationOpen ? (
+            <p>
+              Don't have an account?{' '}
+              <a href={`/register?return_to=${encodeURIComponent(returnTo)}`}>
+                Create one
+              </a>
+              .
+            </p>
+          ) : (
+            <p>
+              Don't have an account? Contact{' '}
+              <a href={info.contact.link} target="_blank">
+                {info.contact.name}
+              </a>
+              .
+            </p>
+          )}
         </Stack>
         <Stack gap="1rem">
           <TextInput
@@ -84,6 +244,13 @@ export default function LoginForm({
         <Button type="submit" style={{ justifySelf: 'flex-end' }}>
           Log in
         </Button>
+        <Button
+          kind="tertiary"
+          onClick={handlePasskeyLogin}
+          style={{ justifySelf: 'flex-end' }}
+        >
+          Log in with a passkey
+        </Button>
       </Stack>
     </Form>
   );
@@ -0,0 +1,118 @@
+import { Button, PasswordInput, Stack, TextInput } from '@carbon/react';
+import { useState } from 'react';
+import { Form } from 'react-router';
+import { useAuthentication } from '../hooks/useAuthentication';
+import type { RegistrationPolicy } from '../lib/auth.client';
+import type { ServiceInfo } from '../lib/service.client';
+
+export default function RegisterForm({
+  info,
+  policy,
+  invitation,
+  returnTo,
+}: {
+  readonly info: ServiceInfo;
+  readonly policy: RegistrationPolicy;
+  readonly invitation: string | null;
+  readonly returnTo: string;
+}) {
+  const { client } = useAuthentication();
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [inlineError, setInlineError] = useState<string | null>(null);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setInlineError(null);
+
+    if (password.length < 16) {
+      setInlineError('Password must be at least 16 characters long');
+      return;
+    }
+
+    if (password !== confirmPassword) {
+      setInlineError('Passwords do not match');
+      return;
+    }
+
+    const result = await client.register(
+      username,
+      password,
+      invitation ?? undefined
+    );
+    if (!result.success) {
+      setInlineError(result.error);
+      return;
+    }
+
+    const login = await client.login(info.id, username, password);
+    window.location.href = login.success ? returnTo : '/login';
+  };
+
+  if (policy.mode !== 'open' && !invitation) {
+    return (
+      <Stack gap="0.25rem">
+        <h1>Registration is closed</h1>
+        <p>
+          Contact{' '}
+          <a href={info.contact.link} target="_blank">
+            {info.contact.name}
+          </a>{' '}
+          to get an account.
+        </p>
+      </Stack>
+    );
+  }
+
+  return (
+    <Form onSubmit={handleSubmit}>
+      <Stack gap={8}>
+        <Stack gap="0.25rem">
+          <h1>
+            {invitation ? 'You have been invited' : 'Create an account'}
+          </h1>
+          <p>
+            Already have one? <a href="/login">Log in</a>.
+          </p>
+        </Stack>
+        <Stack gap="1rem">
+          <TextInput
+            id="username"
+            labelText="Username"
+            placeholder="Choose a username"
+            autoComplete="username"
+            pattern={policy.username_pattern}
+            maxLength={64}
+            value={username}
+            onChange={(e) => setUsername(e.target.value)}
+            required
+          />
+          <PasswordInput
+            id="password"
+            labelText="Password"
+            autoComplete="new-password"
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+            required
+          />
+          <PasswordInput
+            id="confirm-password"
+            labelText="Confirm password"
+            autoComplete="new-password"
+            value={confirmPassword}
+            onChange={(e) => setConfirmPassword(e.target.value)}
+            required
+          />
+          {inlineError && (
+            <p style={{ color: 'red', marginTop: '0.5rem' }}>{inlineError}</p>
+          )}
+        </Stack>
+
+        <Button type="submit" style={{ justifySelf: 'flex-end' }}>
+          Create account
+        </Button>
+      </Stack>
+    </Form>
+  );
+}
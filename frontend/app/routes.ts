@@ -8,6 +8,7 @@ import {
 export default [
   route('/', 'routes/index.tsx'),
   route('/home', 'routes/home.tsx'),
+  route('/register', 'routes/register.tsx'),
   ...prefix('login', [
     index('routes/login.tsx'),
     route(':serviceId', 'routes/login-serviceId.tsx'),
@@ -1,5 +1,9 @@
 import { Button, Loading, Stack } from '@carbon/react';
 import { useNavigate } from 'react-router';
+import PasskeySettings from '../account/PasskeySettings';
+import PasswordSettings from '../account/PasswordSettings';
+import RecoveryCodeSettings from '../account/RecoveryCodes';
+import TOTPSettings from '../account/TOTPSettings';
 import { useAuthentication } from '../hooks/useAuthentication';
 
 export function meta() {
@@ -51,6 +55,10 @@ export default function Home() {
       >
         Log out
       </Button>
+      <PasswordSettings />
+      <TOTPSettings />
+      <PasskeySettings />
+      <RecoveryCodeSettings />
     </Stack>
   );
 }
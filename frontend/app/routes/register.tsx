@@ -0,0 +1,90 @@
+import { useEffect, useState } from 'react';
+import { useLocation } from 'react-router';
+import { useAuthentication } from '../hooks/useAuthentication';
+import LoginLayout from '../layouts/LoginLayout';
+import type { RegistrationPolicy } from '../lib/auth.client';
+import { getServiceInfo, type ServiceInfo } from '../lib/service.client';
+import RegisterForm from '../login/RegisterForm';
+
+export function meta() {
+  return [
+    { title: 'Kuura' },
+    {
+      name: 'description',
+      content: 'Create a Kuura account.',
+    },
+  ];
+}
+
+export default function Register() {
+  const { client } = useAuthentication();
+  const [serviceData, setServiceData] = useState<ServiceInfo | null>(null);
+  const [policy, setPolicy] = useState<RegistrationPolicy | null>(null);
+  const [isLoading, setIsLoading] = useState(true);
+  const [error, setError] = useState<string | null>(null);
+
+  useEffect(() => {
+    const fetchServiceInfo = async () => {
+      try {
+        setIsLoading(true);
+        const [data, registration] = await Promise.all([
+          getServiceInfo(),
+          client.getRegistrationPolicy(),
+        ]);
+        setServiceData(data);
+        setPolicy(registration);
+      } catch (err) {
+        setError('Failed to load service information');
+        console.error(err);
+      } finally {
+        setIsLoading(false);
+      }
+    };
+
+    fetchServiceInfo();
+  }, []);
+
+  const location = useLocation();
+  const searchParams = new URLSearchParams(location.search);
+  const returnTo = searchParams.get('return_to') ?? '/home';
+  const invitation = searchParams.get('invitation');
+
+  return (
+    <LoginLayout>
+      <div
+        style={{
+          display: 'grid',
+          placeItems: 'center',
+          height: '100%',
+          padding: '1rem',
+          backgroundImage: 'url("/login.jpg")',
+          backgroundSize: 'cover',
+          backgroundRepeat: 'no-repeat',
+          backgroundPosition: 'center',
+        }}
+      >
+        <div
+          style={{
+            width: '100%',
+            maxWidth: '32rem',
+            padding: '1rem',
+            backgroundColor: 'white',
+          }}
+        >
+          {isLoading ? (
+            <p>Loading service information...</p>
+          ) : error ? (
+            <p>{error}</p>
+          ) : serviceData && policy ? (
+            <RegisterForm
+              info={serviceData}
+              policy={policy}
+              invitation={invitation}
+              returnTo={returnTo}
+            />
+          ) : null}
+        </div>
+      </div>
+    </LoginLayout>
+  );
+}
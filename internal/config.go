@@ -1,6 +1,8 @@
 package kuura
 
 import (
+	"time"
+
 	"github.com/caarlos0/env/v11"
 )
 
@@ -12,15 +14,39 @@ type Config struct {
 	RUN_MIGRATIONS    bool   `env:"RUN_MIGRATIONS" envDefault:"false"`
 	DEBUG             bool   `env:"DEBUG" envDefault:"false"`
 
+	// key sources (see kek.ParseSource), JWK_KEK takes precedence over JWK_KEK_PATH
+	JWK_KEK      string `env:"JWK_KEK"`
 	JWK_KEK_PATH string `env:"JWK_KEK_PATH" envDefault:"/var/kuura/.kek"`
+	JWK_KEK_ID   string `env:"JWK_KEK_ID" envDefault:"default"`
 	JWT_ISSUER   string `env:"JWT_ISSUER" envDefault:"kuura.midka.dev"`
 
+	// how long decrypted signing keys and public keys are cached, 0 disables the cache
+	JWK_CACHE_TTL time.Duration `env:"JWK_CACHE_TTL" envDefault:"30s"`
+
+	// KEKs that keys may still be encrypted with, id=source,id=source
+	JWK_PREVIOUS_KEKS map[string]string `env:"JWK_PREVIOUS_KEKS" envKeyValSeparator:"="`
+
+	// key source of the bearer token of the authenticated management endpoints, they reject every request without it
+	MANAGEMENT_TOKEN string `env:"MANAGEMENT_TOKEN"`
+
+	USER_CODE_SECRET_KEY      string `env:"USER_CODE_SECRET_KEY"`
 	USER_CODE_SECRET_KEY_PATH string `env:"USER_CODE_SECRET_KEY_PATH" envDefault:"/var/kuura/.user-code"`
 
+	// Vault transit compatible API for transit: key sources
+	VAULT_ADDR        string `env:"VAULT_ADDR"`
+	VAULT_TOKEN       string `env:"VAULT_TOKEN"`
+	KEK_TRANSIT_MOUNT string `env:"KEK_TRANSIT_MOUNT" envDefault:"transit"`
+	KEK_TRANSIT_KEY   string `env:"KEK_TRANSIT_KEY" envDefault:"kuura"`
+
 	SRP_PRIME     string `env:"SRP_PRIME" envDefault:"00b14cbeb5826b34e3075714520de2af615885f244358e498a04de5dea9d79aa142f0624239261bb2309faa250a9c4b56229282f6ad7ef3b44c59521f32b30c62d057c25b7f7992618a3d1329390eaa0c1c12a13290101d77acd8d3969556868a8b4842a28cf2910c431efd3da63d61e5c6f032f745f539996157bc6b5f6bf8d7a3f7287950d84fec7d5227ed46a15206572acd370c8ae80b9a28b6938d1d8f89f6402c8f64d46459506506e6e2c51b43ddf344148243a6b82c409ef9aec540c26eff0d3124c08e49e52f2d8fd32acb1e6dac5c580110153c44631d324acbae652283c7258d999cd38befb9968906e221d7faa366709972b2a45c0736303e84f848ffed435f2f4185ab70fde271647bf26aebf86f8ac7211b965ea959298cfaeff206a60c55f3534ca05eaf71232762ec54398f1cb554002f901d0afdfb3ad84d4a2dce14b6afb0e4197a9a617342ad80310f5460762e5883251d664abe2d8e92678b2723e9eb7a28ae1d55efe2987611a950657f26398d4bf5ebecfa24bcec597"`
 	SRP_GENERATOR string `env:"SRP_GENERATOR" envDefault:"2"`
 
 	PUBLIC_KUURA_DOMAIN string `env:"PUBLIC_KUURA_DOMAIN" envDefault:"kuura.example.com"`
+
+	// passkeys are bound to the relying party id, changing it invalidates every registered passkey
+	WEBAUTHN_RP_ID   string   `env:"WEBAUTHN_RP_ID"` // defaults to PUBLIC_KUURA_DOMAIN
+	WEBAUTHN_RP_NAME string   `env:"WEBAUTHN_RP_NAME" envDefault:"Kuura"`
+	WEBAUTHN_ORIGINS []string `env:"WEBAUTHN_ORIGINS" envSeparator:","` // defaults to https://WEBAUTHN_RP_ID
 }
 
 func ParseConfig() (*Config, error) {
@@ -1,3 +1,18 @@
 package constants
 
 const INTERNAL_USER_REFRESH_PATH = "/v1/user/tokens/internal"
+
+const OPENID_CONFIGURATION_PATH = "/.well-known/openid-configuration"
+const SERVICE_OPENID_CONFIGURATION_PATH = "/v1/service/{serviceId}/.well-known/openid-configuration"
+const SERVICE_JWKS_PATH = "/v1/service/{serviceId}/jwks.json"
+const EXTERNAL_USER_TOKENS_PATH = "/v1/user/tokens/external"
+const M2M_ACCESS_PATH = "/v1/m2m/access"
+
+const OAUTH2_AUTHORIZE_PATH = "/oauth2/authorize"
+const OAUTH2_TOKEN_PATH = "/oauth2/token"
+const OAUTH2_INTROSPECT_PATH = "/oauth2/introspect"
+const OAUTH2_REVOKE_PATH = "/oauth2/revoke"
+const OAUTH2_USERINFO_PATH = "/oauth2/userinfo"
+
+// frontend route
+const LOGIN_PATH = "/login"
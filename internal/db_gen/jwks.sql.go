@@ -11,6 +11,15 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const advisoryXactLock = `-- name: AdvisoryXactLock :exec
+SELECT pg_advisory_xact_lock($1::bigint)
+`
+
+func (q *Queries) AdvisoryXactLock(ctx context.Context, key int64) error {
+	_, err := q.db.Exec(ctx, advisoryXactLock, key)
+	return err
+}
+
 const createServiceKey = `-- name: CreateServiceKey :exec
 INSERT INTO service_key_states (service_id, jwk_private_id, status)
 VALUES ($1, $2, 'future')
@@ -28,13 +37,7 @@ func (q *Queries) CreateServiceKey(ctx context.Context, arg CreateServiceKeyPara
 
 const deleteJWKPrivate = `-- name: DeleteJWKPrivate :exec
 DELETE FROM jwk_private
-WHERE id = $1
-AND EXISTS (
-    SELECT 1 
-    FROM service_key_states
-    WHERE service_key_states.service_id = $2
-    AND service_key_states.jwk_private_id = $1
-)
+WHERE id = $1 AND service_id = $2
 `
 
 type DeleteJWKPrivateParams struct {
@@ -49,13 +52,7 @@ func (q *Queries) DeleteJWKPrivate(ctx context.Context, arg DeleteJWKPrivatePara
 
 const deleteJWKPublic = `-- name: DeleteJWKPublic :exec
 DELETE FROM jwk_public_keys
-WHERE id = $1
-AND EXISTS (
-    SELECT 1 
-    FROM service_key_states
-    WHERE service_key_states.service_id = $2
-    AND service_key_states.jwk_private_id = $1
-)
+WHERE id = $1 AND service_id = $2
 `
 
 type DeleteJWKPublicParams struct {
@@ -68,12 +65,69 @@ func (q *Queries) DeleteJWKPublic(ctx context.Context, arg DeleteJWKPublicParams
 	return err
 }
 
+const deleteServiceKeyState = `-- name: DeleteServiceKeyState :execrows
+DELETE FROM service_key_states
+WHERE service_id = $1 AND jwk_private_id = $2
+`
+
+type DeleteServiceKeyStateParams struct {
+	ServiceID    pgtype.UUID `json:"service_id"`
+	JwkPrivateID string      `json:"jwk_private_id"`
+}
+
+func (q *Queries) DeleteServiceKeyState(ctx context.Context, arg DeleteServiceKeyStateParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteServiceKeyState, arg.ServiceID, arg.JwkPrivateID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getAllJWKPrivate = `-- name: GetAllJWKPrivate :many
+SELECT id, encrypted_key_data, nonce, kek_id FROM jwk_private
+ORDER BY id
+FOR UPDATE
+`
+
+type GetAllJWKPrivateRow struct {
+	ID               string `json:"id"`
+	EncryptedKeyData []byte `json:"encrypted_key_data"`
+	Nonce            []byte `json:"nonce"`
+	KekID            string `json:"kek_id"`
+}
+
+func (q *Queries) GetAllJWKPrivate(ctx context.Context) ([]GetAllJWKPrivateRow, error) {
+	rows, err := q.db.Query(ctx, getAllJWKPrivate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetAllJWKPrivateRow{}
+	for rows.Next() {
+		var i GetAllJWKPrivateRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.EncryptedKeyData,
+			&i.Nonce,
+			&i.KekID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getCurrentJWKPrivate = `-- name: GetCurrentJWKPrivate :one
 SELECT 
     p.id,
     p.service_id,
     p.encrypted_key_data,
     p.nonce,
+    p.kek_id,
     p.created_at,
     k.key_data AS public_key_data
 FROM 
@@ -94,6 +148,7 @@ type GetCurrentJWKPrivateRow struct {
 	ServiceID        pgtype.UUID        `json:"service_id"`
 	EncryptedKeyData []byte             `json:"encrypted_key_data"`
 	Nonce            []byte             `json:"nonce"`
+	KekID            string             `json:"kek_id"`
 	CreatedAt        pgtype.Timestamptz `json:"created_at"`
 	PublicKeyData    []byte             `json:"public_key_data"`
 }
@@ -106,6 +161,7 @@ func (q *Queries) GetCurrentJWKPrivate(ctx context.Context, serviceID pgtype.UUI
 		&i.ServiceID,
 		&i.EncryptedKeyData,
 		&i.Nonce,
+		&i.KekID,
 		&i.CreatedAt,
 		&i.PublicKeyData,
 	)
@@ -118,6 +174,7 @@ SELECT
     p.service_id,
     p.encrypted_key_data,
     p.nonce,
+    p.kek_id,
     p.created_at,
     k.key_data AS public_key_data
 FROM 
@@ -144,6 +201,7 @@ type GetJWKPrivateRow struct {
 	ServiceID        pgtype.UUID        `json:"service_id"`
 	EncryptedKeyData []byte             `json:"encrypted_key_data"`
 	Nonce            []byte             `json:"nonce"`
+	KekID            string             `json:"kek_id"`
 	CreatedAt        pgtype.Timestamptz `json:"created_at"`
 	PublicKeyData    []byte             `json:"public_key_data"`
 }
@@ -156,6 +214,7 @@ func (q *Queries) GetJWKPrivate(ctx context.Context, arg GetJWKPrivateParams) (G
 		&i.ServiceID,
 		&i.EncryptedKeyData,
 		&i.Nonce,
+		&i.KekID,
 		&i.CreatedAt,
 		&i.PublicKeyData,
 	)
@@ -191,14 +250,55 @@ func (q *Queries) GetJWKPublic(ctx context.Context, arg GetJWKPublicParams) (Jwk
 	return i, err
 }
 
+const getKeySet = `-- name: GetKeySet :many
+SELECT pk.id, pk.key_data, sks.status, sks.status_changed_at
+FROM service_key_states AS sks
+JOIN jwk_public_keys AS pk ON pk.id = sks.jwk_private_id
+WHERE sks.service_id = $1
+`
+
+type GetKeySetRow struct {
+	ID              string             `json:"id"`
+	KeyData         []byte             `json:"key_data"`
+	Status          string             `json:"status"`
+	StatusChangedAt pgtype.Timestamptz `json:"status_changed_at"`
+}
+
+// one statement so the keys and their states always describe the same key set
+func (q *Queries) GetKeySet(ctx context.Context, serviceID pgtype.UUID) ([]GetKeySetRow, error) {
+	rows, err := q.db.Query(ctx, getKeySet, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetKeySetRow{}
+	for rows.Next() {
+		var i GetKeySetRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.KeyData,
+			&i.Status,
+			&i.StatusChangedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getKeyStatus = `-- name: GetKeyStatus :many
-SELECT status, jwk_private_id FROM service_key_states
+SELECT status, jwk_private_id, status_changed_at FROM service_key_states
 WHERE service_id = $1
 `
 
 type GetKeyStatusRow struct {
-	Status       string `json:"status"`
-	JwkPrivateID string `json:"jwk_private_id"`
+	Status          string             `json:"status"`
+	JwkPrivateID    string             `json:"jwk_private_id"`
+	StatusChangedAt pgtype.Timestamptz `json:"status_changed_at"`
 }
 
 func (q *Queries) GetKeyStatus(ctx context.Context, serviceID pgtype.UUID) ([]GetKeyStatusRow, error) {
@@ -210,7 +310,7 @@ func (q *Queries) GetKeyStatus(ctx context.Context, serviceID pgtype.UUID) ([]Ge
 	items := []GetKeyStatusRow{}
 	for rows.Next() {
 		var i GetKeyStatusRow
-		if err := rows.Scan(&i.Status, &i.JwkPrivateID); err != nil {
+		if err := rows.Scan(&i.Status, &i.JwkPrivateID, &i.StatusChangedAt); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -277,6 +377,18 @@ func (q *Queries) GetPublicJWKs(ctx context.Context, serviceID pgtype.UUID) ([]J
 	return items, nil
 }
 
+const getServiceJWKAlgorithm = `-- name: GetServiceJWKAlgorithm :one
+SELECT jwk_algorithm FROM services
+WHERE id = $1
+`
+
+func (q *Queries) GetServiceJWKAlgorithm(ctx context.Context, id pgtype.UUID) (string, error) {
+	row := q.db.QueryRow(ctx, getServiceJWKAlgorithm, id)
+	var jwk_algorithm string
+	err := row.Scan(&jwk_algorithm)
+	return jwk_algorithm, err
+}
+
 const getUpcomingKey = `-- name: GetUpcomingKey :one
 SELECT 
     p.id
@@ -300,8 +412,8 @@ func (q *Queries) GetUpcomingKey(ctx context.Context, serviceID pgtype.UUID) (st
 
 const insertJWKTransaction = `-- name: InsertJWKTransaction :exec
 WITH inserted_private_key AS (
-    INSERT INTO jwk_private (id, service_id, encrypted_key_data, nonce)
-    VALUES ($1, $2, $3, $4)
+    INSERT INTO jwk_private (id, service_id, encrypted_key_data, nonce, kek_id)
+    VALUES ($1, $2, $3, $4, $6)
     RETURNING id
 ),
 inserted_public_key AS (
@@ -318,6 +430,7 @@ type InsertJWKTransactionParams struct {
 	EncryptedKeyData []byte      `json:"encrypted_key_data"`
 	Nonce            []byte      `json:"nonce"`
 	KeyData          []byte      `json:"key_data"`
+	KekID            string      `json:"kek_id"`
 }
 
 func (q *Queries) InsertJWKTransaction(ctx context.Context, arg InsertJWKTransactionParams) error {
@@ -327,13 +440,61 @@ func (q *Queries) InsertJWKTransaction(ctx context.Context, arg InsertJWKTransac
 		arg.EncryptedKeyData,
 		arg.Nonce,
 		arg.KeyData,
+		arg.KekID,
 	)
 	return err
 }
 
+const lockJWKPrivateInserts = `-- name: LockJWKPrivateInserts :exec
+LOCK TABLE jwk_private IN SHARE ROW EXCLUSIVE MODE
+`
+
+func (q *Queries) LockJWKPrivateInserts(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockJWKPrivateInserts)
+	return err
+}
+
+const rewrapJWKPrivate = `-- name: RewrapJWKPrivate :execrows
+UPDATE jwk_private AS p
+SET
+    encrypted_key_data = rewrapped.encrypted_key_data,
+    nonce = rewrapped.nonce,
+    kek_id = $1
+FROM unnest(
+    $2::text[],
+    $3::bytea[],
+    $4::bytea[],
+    $5::bytea[]
+) AS rewrapped(id, encrypted_key_data, nonce, previous_nonce)
+WHERE p.id = rewrapped.id AND p.nonce = rewrapped.previous_nonce
+`
+
+type RewrapJWKPrivateParams struct {
+	KekID            string   `json:"kek_id"`
+	Ids              []string `json:"ids"`
+	EncryptedKeyData [][]byte `json:"encrypted_key_data"`
+	Nonces           [][]byte `json:"nonces"`
+	PreviousNonces   [][]byte `json:"previous_nonces"`
+}
+
+func (q *Queries) RewrapJWKPrivate(ctx context.Context, arg RewrapJWKPrivateParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rewrapJWKPrivate,
+		arg.KekID,
+		arg.Ids,
+		arg.EncryptedKeyData,
+		arg.Nonces,
+		arg.PreviousNonces,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const setJWKStatusToCurrent = `-- name: SetJWKStatusToCurrent :exec
 UPDATE service_key_states
-SET status = 'current'
+SET status = 'current',
+    status_changed_at = NOW()
 WHERE service_id = $1
   AND jwk_private_id = $2
 `
@@ -350,7 +511,8 @@ func (q *Queries) SetJWKStatusToCurrent(ctx context.Context, arg SetJWKStatusToC
 
 const setJWKStatusToRetired = `-- name: SetJWKStatusToRetired :exec
 UPDATE service_key_states
-SET status = 'retired'
+SET status = 'retired',
+    status_changed_at = NOW()
 WHERE service_id = $1
   AND jwk_private_id = $2
 `
@@ -364,3 +526,14 @@ func (q *Queries) SetJWKStatusToRetired(ctx context.Context, arg SetJWKStatusToR
 	_, err := q.db.Exec(ctx, setJWKStatusToRetired, arg.ServiceID, arg.JwkPrivateID)
 	return err
 }
+
+const tryAdvisoryXactLock = `-- name: TryAdvisoryXactLock :one
+SELECT pg_try_advisory_xact_lock($1::bigint) AS locked
+`
+
+func (q *Queries) TryAdvisoryXactLock(ctx context.Context, key int64) (bool, error) {
+	row := q.db.QueryRow(ctx, tryAdvisoryXactLock, key)
+	var locked bool
+	err := row.Scan(&locked)
+	return locked, err
+}
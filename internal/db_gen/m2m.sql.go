@@ -12,6 +12,30 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const createM2MClient = `-- name: CreateM2MClient :exec
+INSERT INTO m2m_clients (id, service_id, subject_id, template_id, secret_hash)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateM2MClientParams struct {
+	ID         string      `json:"id"`
+	ServiceID  pgtype.UUID `json:"service_id"`
+	SubjectID  string      `json:"subject_id"`
+	TemplateID string      `json:"template_id"`
+	SecretHash string      `json:"secret_hash"`
+}
+
+func (q *Queries) CreateM2MClient(ctx context.Context, arg CreateM2MClientParams) error {
+	_, err := q.db.Exec(ctx, createM2MClient,
+		arg.ID,
+		arg.ServiceID,
+		arg.SubjectID,
+		arg.TemplateID,
+		arg.SecretHash,
+	)
+	return err
+}
+
 const createM2MRoleTemplate = `-- name: CreateM2MRoleTemplate :exec
 INSERT INTO m2m_session_templates (id, roles, service_id)
 VALUES ($1, $2, $3)
@@ -70,6 +94,112 @@ func (q *Queries) CreateM2MSession(ctx context.Context, arg CreateM2MSessionPara
 	return err
 }
 
+const deleteM2MClient = `-- name: DeleteM2MClient :exec
+DELETE FROM m2m_clients
+WHERE id = $1
+`
+
+func (q *Queries) DeleteM2MClient(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, deleteM2MClient, id)
+	return err
+}
+
+const deleteM2MSession = `-- name: DeleteM2MSession :exec
+DELETE FROM m2m_sessions
+WHERE id = $1
+`
+
+func (q *Queries) DeleteM2MSession(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, deleteM2MSession, id)
+	return err
+}
+
+const getM2MClientAndService = `-- name: GetM2MClientAndService :one
+SELECT 
+    c.id,
+    c.subject_id,
+    c.template_id,
+    c.secret_hash,
+    c.service_id,
+    t.roles,
+    s.name as service_name,
+    s.description as service_description,
+    s.jwt_audience as service_jwt_audience,
+    s.modified_at as service_modified_at,
+    s.created_at as service_created_at
+FROM m2m_clients c
+JOIN m2m_session_templates t ON t.id = c.template_id AND t.service_id = c.service_id
+JOIN services s ON s.id = c.service_id
+WHERE c.id = $1
+`
+
+type GetM2MClientAndServiceRow struct {
+	ID                 string             `json:"id"`
+	SubjectID          string             `json:"subject_id"`
+	TemplateID         string             `json:"template_id"`
+	SecretHash         string             `json:"secret_hash"`
+	ServiceID          pgtype.UUID        `json:"service_id"`
+	Roles              []string           `json:"roles"`
+	ServiceName        string             `json:"service_name"`
+	ServiceDescription pgtype.Text        `json:"service_description"`
+	ServiceJwtAudience string             `json:"service_jwt_audience"`
+	ServiceModifiedAt  time.Time          `json:"service_modified_at"`
+	ServiceCreatedAt   pgtype.Timestamptz `json:"service_created_at"`
+}
+
+func (q *Queries) GetM2MClientAndService(ctx context.Context, id string) (GetM2MClientAndServiceRow, error) {
+	row := q.db.QueryRow(ctx, getM2MClientAndService, id)
+	var i GetM2MClientAndServiceRow
+	err := row.Scan(
+		&i.ID,
+		&i.SubjectID,
+		&i.TemplateID,
+		&i.SecretHash,
+		&i.ServiceID,
+		&i.Roles,
+		&i.ServiceName,
+		&i.ServiceDescription,
+		&i.ServiceJwtAudience,
+		&i.ServiceModifiedAt,
+		&i.ServiceCreatedAt,
+	)
+	return i, err
+}
+
+const getM2MClients = `-- name: GetM2MClients :many
+SELECT id, service_id, subject_id, template_id, secret_hash, created_at, last_used_at FROM m2m_clients
+WHERE service_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetM2MClients(ctx context.Context, serviceID pgtype.UUID) ([]M2mClient, error) {
+	rows, err := q.db.Query(ctx, getM2MClients, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []M2mClient{}
+	for rows.Next() {
+		var i M2mClient
+		if err := rows.Scan(
+			&i.ID,
+			&i.ServiceID,
+			&i.SubjectID,
+			&i.TemplateID,
+			&i.SecretHash,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getM2MRoleTemplates = `-- name: GetM2MRoleTemplates :many
 SELECT id, roles, service_id FROM m2m_session_templates
 WHERE service_id = $1
@@ -105,6 +235,7 @@ SELECT
     m.last_authenticated_at,
     m.expires_at,
     m.service_id,
+    m.refresh_token_generation,
     s.name as service_name,
     s.description as service_description,
     s.jwt_audience as service_jwt_audience,
@@ -116,19 +247,20 @@ WHERE m.id = $1
 `
 
 type GetM2MSessionAndServiceRow struct {
-	ID                  string             `json:"id"`
-	SubjectID           string             `json:"subject_id"`
-	RefreshToken        string             `json:"refresh_token"`
-	Roles               []string           `json:"roles"`
-	CreatedAt           pgtype.Timestamptz `json:"created_at"`
-	LastAuthenticatedAt pgtype.Timestamptz `json:"last_authenticated_at"`
-	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
-	ServiceID           pgtype.UUID        `json:"service_id"`
-	ServiceName         string             `json:"service_name"`
-	ServiceDescription  pgtype.Text        `json:"service_description"`
-	ServiceJwtAudience  string             `json:"service_jwt_audience"`
-	ServiceModifiedAt   time.Time          `json:"service_modified_at"`
-	ServiceCreatedAt    pgtype.Timestamptz `json:"service_created_at"`
+	ID                     string             `json:"id"`
+	SubjectID              string             `json:"subject_id"`
+	RefreshToken           string             `json:"refresh_token"`
+	Roles                  []string           `json:"roles"`
+	CreatedAt              pgtype.Timestamptz `json:"created_at"`
+	LastAuthenticatedAt    pgtype.Timestamptz `json:"last_authenticated_at"`
+	ExpiresAt              pgtype.Timestamptz `json:"expires_at"`
+	ServiceID              pgtype.UUID        `json:"service_id"`
+	RefreshTokenGeneration int32              `json:"refresh_token_generation"`
+	ServiceName            string             `json:"service_name"`
+	ServiceDescription     pgtype.Text        `json:"service_description"`
+	ServiceJwtAudience     string             `json:"service_jwt_audience"`
+	ServiceModifiedAt      time.Time          `json:"service_modified_at"`
+	ServiceCreatedAt       pgtype.Timestamptz `json:"service_created_at"`
 }
 
 func (q *Queries) GetM2MSessionAndService(ctx context.Context, id string) (GetM2MSessionAndServiceRow, error) {
@@ -143,6 +275,7 @@ func (q *Queries) GetM2MSessionAndService(ctx context.Context, id string) (GetM2
 		&i.LastAuthenticatedAt,
 		&i.ExpiresAt,
 		&i.ServiceID,
+		&i.RefreshTokenGeneration,
 		&i.ServiceName,
 		&i.ServiceDescription,
 		&i.ServiceJwtAudience,
@@ -152,21 +285,73 @@ func (q *Queries) GetM2MSessionAndService(ctx context.Context, id string) (GetM2
 	return i, err
 }
 
-const rotateM2MSessionRefreshToken = `-- name: RotateM2MSessionRefreshToken :exec
+const getM2MSessionPreviousRefreshToken = `-- name: GetM2MSessionPreviousRefreshToken :one
+SELECT token_hash, rotated_at FROM m2m_session_refresh_tokens
+WHERE session_id = $1 AND generation = $2
+`
+
+type GetM2MSessionPreviousRefreshTokenParams struct {
+	SessionID  string `json:"session_id"`
+	Generation int32  `json:"generation"`
+}
+
+type GetM2MSessionPreviousRefreshTokenRow struct {
+	TokenHash string             `json:"token_hash"`
+	RotatedAt pgtype.Timestamptz `json:"rotated_at"`
+}
+
+func (q *Queries) GetM2MSessionPreviousRefreshToken(ctx context.Context, arg GetM2MSessionPreviousRefreshTokenParams) (GetM2MSessionPreviousRefreshTokenRow, error) {
+	row := q.db.QueryRow(ctx, getM2MSessionPreviousRefreshToken, arg.SessionID, arg.Generation)
+	var i GetM2MSessionPreviousRefreshTokenRow
+	err := row.Scan(&i.TokenHash, &i.RotatedAt)
+	return i, err
+}
+
+const rotateM2MSessionRefreshToken = `-- name: RotateM2MSessionRefreshToken :one
+WITH previous AS (
+    INSERT INTO m2m_session_refresh_tokens (session_id, generation, token_hash)
+    SELECT m.id, m.refresh_token_generation, m.refresh_token
+    FROM m2m_sessions m
+    WHERE m.id = $2
+      AND m.refresh_token_generation = $4
+    ON CONFLICT (session_id, generation) DO NOTHING
+)
 UPDATE m2m_sessions
 SET refresh_token = $1,
-    expires_at = $3
+    expires_at = $3,
+    refresh_token_generation = refresh_token_generation + 1
 WHERE id = $2
+  AND refresh_token_generation = $4
+RETURNING refresh_token_generation
 `
 
 type RotateM2MSessionRefreshTokenParams struct {
-	RefreshToken string             `json:"refresh_token"`
-	ID           string             `json:"id"`
-	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+	RefreshToken           string             `json:"refresh_token"`
+	ID                     string             `json:"id"`
+	ExpiresAt              pgtype.Timestamptz `json:"expires_at"`
+	RefreshTokenGeneration int32              `json:"refresh_token_generation"`
+}
+
+func (q *Queries) RotateM2MSessionRefreshToken(ctx context.Context, arg RotateM2MSessionRefreshTokenParams) (int32, error) {
+	row := q.db.QueryRow(ctx, rotateM2MSessionRefreshToken,
+		arg.RefreshToken,
+		arg.ID,
+		arg.ExpiresAt,
+		arg.RefreshTokenGeneration,
+	)
+	var refresh_token_generation int32
+	err := row.Scan(&refresh_token_generation)
+	return refresh_token_generation, err
 }
 
-func (q *Queries) RotateM2MSessionRefreshToken(ctx context.Context, arg RotateM2MSessionRefreshTokenParams) error {
-	_, err := q.db.Exec(ctx, rotateM2MSessionRefreshToken, arg.RefreshToken, arg.ID, arg.ExpiresAt)
+const updateM2MClientLastUsedAt = `-- name: UpdateM2MClientLastUsedAt :exec
+UPDATE m2m_clients
+SET last_used_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) UpdateM2MClientLastUsedAt(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, updateM2MClientLastUsedAt, id)
 	return err
 }
 
@@ -21,6 +21,7 @@ type JwkPrivate struct {
 	EncryptedKeyData []byte             `json:"encrypted_key_data"`
 	Nonce            []byte             `json:"nonce"`
 	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+	KekID            string             `json:"kek_id"`
 }
 
 type JwkPublicKey struct {
@@ -30,15 +31,33 @@ type JwkPublicKey struct {
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
+type M2mClient struct {
+	ID         string             `json:"id"`
+	ServiceID  pgtype.UUID        `json:"service_id"`
+	SubjectID  string             `json:"subject_id"`
+	TemplateID string             `json:"template_id"`
+	SecretHash string             `json:"secret_hash"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+}
+
 type M2mSession struct {
-	ID                  string             `json:"id"`
-	SubjectID           string             `json:"subject_id"`
-	RefreshToken        string             `json:"refresh_token"`
-	Roles               []string           `json:"roles"`
-	CreatedAt           pgtype.Timestamptz `json:"created_at"`
-	LastAuthenticatedAt pgtype.Timestamptz `json:"last_authenticated_at"`
-	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
-	ServiceID           pgtype.UUID        `json:"service_id"`
+	ID                     string             `json:"id"`
+	SubjectID              string             `json:"subject_id"`
+	RefreshToken           string             `json:"refresh_token"`
+	Roles                  []string           `json:"roles"`
+	CreatedAt              pgtype.Timestamptz `json:"created_at"`
+	LastAuthenticatedAt    pgtype.Timestamptz `json:"last_authenticated_at"`
+	ExpiresAt              pgtype.Timestamptz `json:"expires_at"`
+	ServiceID              pgtype.UUID        `json:"service_id"`
+	RefreshTokenGeneration int32              `json:"refresh_token_generation"`
+}
+
+type M2mSessionRefreshToken struct {
+	SessionID  string             `json:"session_id"`
+	Generation int32              `json:"generation"`
+	TokenHash  string             `json:"token_hash"`
+	RotatedAt  pgtype.Timestamptz `json:"rotated_at"`
 }
 
 type M2mSessionTemplate struct {
@@ -58,12 +77,29 @@ type Service struct {
 	ContactEmail        string             `json:"contact_email"`
 	LoginRedirect       string             `json:"login_redirect"`
 	AccessTokenDuration int32              `json:"access_token_duration"`
+	JwkRotationInterval int32              `json:"jwk_rotation_interval"`
+	JwkRetirementPeriod int32              `json:"jwk_retirement_period"`
+	JwkAlgorithm        string             `json:"jwk_algorithm"`
+}
+
+type ServiceAccessPolicy struct {
+	ServiceID     pgtype.UUID `json:"service_id"`
+	Mode          string      `json:"mode"`
+	RequiredRoles []string    `json:"required_roles"`
+	ModifiedAt    time.Time   `json:"modified_at"`
+}
+
+type ServiceAllowedUser struct {
+	ServiceID pgtype.UUID `json:"service_id"`
+	UserID    string      `json:"user_id"`
+	CreatedAt time.Time   `json:"created_at"`
 }
 
 type ServiceKeyState struct {
-	ServiceID    pgtype.UUID `json:"service_id"`
-	JwkPrivateID string      `json:"jwk_private_id"`
-	Status       string      `json:"status"`
+	ServiceID       pgtype.UUID        `json:"service_id"`
+	JwkPrivateID    string             `json:"jwk_private_id"`
+	Status          string             `json:"status"`
+	StatusChangedAt pgtype.Timestamptz `json:"status_changed_at"`
 }
 
 type User struct {
@@ -74,17 +110,58 @@ type User struct {
 	LastLoginAt     pgtype.Timestamptz `json:"last_login_at"`
 	Disabled        pgtype.Bool        `json:"disabled"`
 	EncodedVerifier string             `json:"encoded_verifier"`
-	Roles           []string           `json:"roles"`
+}
+
+type UserInvitation struct {
+	ID          pgtype.UUID        `json:"id"`
+	HashedToken string             `json:"hashed_token"`
+	Roles       []string           `json:"roles"`
+	Services    []pgtype.UUID      `json:"services"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	UsedAt      pgtype.Timestamptz `json:"used_at"`
+	UsedBy      pgtype.Text        `json:"used_by"`
+}
+
+type UserMfaChallenge struct {
+	HashedToken string             `json:"hashed_token"`
+	UserID      string             `json:"user_id"`
+	ServiceID   pgtype.UUID        `json:"service_id"`
+	Attempts    int32              `json:"attempts"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+type UserRecoveryCode struct {
+	CodeHash  string             `json:"code_hash"`
+	UserID    string             `json:"user_id"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type UserServiceRole struct {
+	UserID    string      `json:"user_id"`
+	ServiceID pgtype.UUID `json:"service_id"`
+	Roles     []string    `json:"roles"`
 }
 
 type UserSession struct {
-	ID                  string             `json:"id"`
-	UserID              string             `json:"user_id"`
-	ServiceID           pgtype.UUID        `json:"service_id"`
-	RefreshTokenHash    pgtype.Text        `json:"refresh_token_hash"`
-	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
-	CreatedAt           pgtype.Timestamptz `json:"created_at"`
-	LastAuthenticatedAt pgtype.Timestamptz `json:"last_authenticated_at"`
+	ID                     string             `json:"id"`
+	UserID                 string             `json:"user_id"`
+	ServiceID              pgtype.UUID        `json:"service_id"`
+	RefreshTokenHash       pgtype.Text        `json:"refresh_token_hash"`
+	ExpiresAt              pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt              pgtype.Timestamptz `json:"created_at"`
+	LastAuthenticatedAt    pgtype.Timestamptz `json:"last_authenticated_at"`
+	RefreshTokenGeneration int32              `json:"refresh_token_generation"`
+	ReauthenticatedAt      pgtype.Timestamptz `json:"reauthenticated_at"`
+}
+
+type UserSessionRefreshToken struct {
+	SessionID  string             `json:"session_id"`
+	Generation int32              `json:"generation"`
+	TokenHash  string             `json:"token_hash"`
+	RotatedAt  pgtype.Timestamptz `json:"rotated_at"`
 }
 
 type UserSrp struct {
@@ -94,8 +171,42 @@ type UserSrp struct {
 }
 
 type UserTokenCodeExchange struct {
-	SessionID  string             `json:"session_id"`
-	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	SessionID     string             `json:"session_id"`
+	ExpiresAt     pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	HashedCode    string             `json:"hashed_code"`
+	CodeChallenge pgtype.Text        `json:"code_challenge"`
+	RedirectUri   pgtype.Text        `json:"redirect_uri"`
+	Nonce         pgtype.Text        `json:"nonce"`
+	AuthTime      pgtype.Timestamptz `json:"auth_time"`
+}
+
+type UserTotp struct {
+	UserID          string             `json:"user_id"`
+	EncryptedSecret []byte             `json:"encrypted_secret"`
+	Nonce           []byte             `json:"nonce"`
+	KekID           string             `json:"kek_id"`
+	ConfirmedAt     pgtype.Timestamptz `json:"confirmed_at"`
+	LastUsedStep    int64              `json:"last_used_step"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+}
+
+type UserWebauthnChallenge struct {
+	HashedChallenge string             `json:"hashed_challenge"`
+	Ceremony        string             `json:"ceremony"`
+	UserID          pgtype.Text        `json:"user_id"`
+	ServiceID       pgtype.UUID        `json:"service_id"`
+	ExpiresAt       pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+}
+
+type UserWebauthnCredential struct {
+	ID         []byte             `json:"id"`
+	UserID     string             `json:"user_id"`
+	Name       string             `json:"name"`
+	PublicKey  []byte             `json:"public_key"`
+	SignCount  int64              `json:"sign_count"`
+	Transports []string           `json:"transports"`
 	CreatedAt  pgtype.Timestamptz `json:"created_at"`
-	HashedCode string             `json:"hashed_code"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
 }
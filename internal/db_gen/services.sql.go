@@ -44,7 +44,7 @@ func (q *Queries) DeleteAppService(ctx context.Context, id pgtype.UUID) error {
 }
 
 const getAppService = `-- name: GetAppService :one
-SELECT id, jwt_audience, created_at, modified_at, name, description, contact_name, contact_email, login_redirect, access_token_duration FROM services
+SELECT id, jwt_audience, created_at, modified_at, name, description, contact_name, contact_email, login_redirect, access_token_duration, jwk_rotation_interval, jwk_retirement_period, jwk_algorithm FROM services
 WHERE id = $1
 `
 
@@ -62,12 +62,15 @@ func (q *Queries) GetAppService(ctx context.Context, id pgtype.UUID) (Service, e
 		&i.ContactEmail,
 		&i.LoginRedirect,
 		&i.AccessTokenDuration,
+		&i.JwkRotationInterval,
+		&i.JwkRetirementPeriod,
+		&i.JwkAlgorithm,
 	)
 	return i, err
 }
 
 const getAppServices = `-- name: GetAppServices :many
-SELECT id, jwt_audience, created_at, modified_at, name, description, contact_name, contact_email, login_redirect, access_token_duration FROM services
+SELECT id, jwt_audience, created_at, modified_at, name, description, contact_name, contact_email, login_redirect, access_token_duration, jwk_rotation_interval, jwk_retirement_period, jwk_algorithm FROM services
 `
 
 func (q *Queries) GetAppServices(ctx context.Context) ([]Service, error) {
@@ -90,6 +93,14 @@ func (q *Queries) GetAppServices(ctx context.Context) ([]Service, error) {
 			&i.ContactEmail,
 			&i.LoginRedirect,
 			&i.AccessTokenDuration,
+			&i.JwkRotationInterval,
+			&i.JwkRetirementPeriod,
+			&i.JwkAlgorithm,
+			&i.JwkAlgorithm,
+			&i.JwkRotationInterval,
+			&i.JwkRetirementPeriod,
+			&i.JwkAlgorithm,
+			&i.JwkAlgorithm,
 		); err != nil {
 			return nil, err
 		}
@@ -139,3 +150,41 @@ func (q *Queries) UpdateService(ctx context.Context, arg UpdateServiceParams) er
 	)
 	return err
 }
+
+const updateServiceJWKAlgorithm = `-- name: UpdateServiceJWKAlgorithm :exec
+UPDATE services
+SET
+    jwk_algorithm = $2,
+    modified_at = NOW()
+WHERE id = $1
+`
+
+type UpdateServiceJWKAlgorithmParams struct {
+	ID           pgtype.UUID `json:"id"`
+	JwkAlgorithm string      `json:"jwk_algorithm"`
+}
+
+func (q *Queries) UpdateServiceJWKAlgorithm(ctx context.Context, arg UpdateServiceJWKAlgorithmParams) error {
+	_, err := q.db.Exec(ctx, updateServiceJWKAlgorithm, arg.ID, arg.JwkAlgorithm)
+	return err
+}
+
+const updateServiceJWKPolicy = `-- name: UpdateServiceJWKPolicy :exec
+UPDATE services
+SET
+    jwk_rotation_interval = $2,
+    jwk_retirement_period = $3,
+    modified_at = NOW()
+WHERE id = $1
+`
+
+type UpdateServiceJWKPolicyParams struct {
+	ID                  pgtype.UUID `json:"id"`
+	JwkRotationInterval int32       `json:"jwk_rotation_interval"`
+	JwkRetirementPeriod int32       `json:"jwk_retirement_period"`
+}
+
+func (q *Queries) UpdateServiceJWKPolicy(ctx context.Context, arg UpdateServiceJWKPolicyParams) error {
+	_, err := q.db.Exec(ctx, updateServiceJWKPolicy, arg.ID, arg.JwkRotationInterval, arg.JwkRetirementPeriod)
+	return err
+}
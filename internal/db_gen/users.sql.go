@@ -11,6 +11,77 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addServiceAllowedUser = `-- name: AddServiceAllowedUser :exec
+INSERT INTO service_allowed_users (service_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (service_id, user_id) DO NOTHING
+`
+
+type AddServiceAllowedUserParams struct {
+	ServiceID pgtype.UUID `json:"service_id"`
+	UserID    string      `json:"user_id"`
+}
+
+func (q *Queries) AddServiceAllowedUser(ctx context.Context, arg AddServiceAllowedUserParams) error {
+	_, err := q.db.Exec(ctx, addServiceAllowedUser, arg.ServiceID, arg.UserID)
+	return err
+}
+
+const addUserServiceRoles = `-- name: AddUserServiceRoles :one
+INSERT INTO user_service_roles (user_id, service_id, roles)
+VALUES ($1, $2, ARRAY(
+    SELECT DISTINCT role
+    FROM unnest($3::text[]) AS role
+    ORDER BY role
+))
+ON CONFLICT (user_id, service_id) DO UPDATE
+SET roles = ARRAY(
+    SELECT DISTINCT role
+    FROM unnest(user_service_roles.roles || EXCLUDED.roles) AS role
+    ORDER BY role
+)
+RETURNING roles
+`
+
+type AddUserServiceRolesParams struct {
+	UserID    string      `json:"user_id"`
+	ServiceID pgtype.UUID `json:"service_id"`
+	Roles     []string    `json:"roles"`
+}
+
+func (q *Queries) AddUserServiceRoles(ctx context.Context, arg AddUserServiceRolesParams) ([]string, error) {
+	row := q.db.QueryRow(ctx, addUserServiceRoles, arg.UserID, arg.ServiceID, arg.Roles)
+	var roles []string
+	err := row.Scan(&roles)
+	return roles, err
+}
+
+const attemptMFAChallenge = `-- name: AttemptMFAChallenge :one
+UPDATE user_mfa_challenges
+SET attempts = attempts + 1
+WHERE hashed_token = $1
+  AND expires_at > NOW()
+  AND attempts < $2
+RETURNING user_id, service_id
+`
+
+type AttemptMFAChallengeParams struct {
+	HashedToken string `json:"hashed_token"`
+	Attempts    int32  `json:"attempts"`
+}
+
+type AttemptMFAChallengeRow struct {
+	UserID    string      `json:"user_id"`
+	ServiceID pgtype.UUID `json:"service_id"`
+}
+
+func (q *Queries) AttemptMFAChallenge(ctx context.Context, arg AttemptMFAChallengeParams) (AttemptMFAChallengeRow, error) {
+	row := q.db.QueryRow(ctx, attemptMFAChallenge, arg.HashedToken, arg.Attempts)
+	var i AttemptMFAChallengeRow
+	err := row.Scan(&i.UserID, &i.ServiceID)
+	return i, err
+}
+
 const checkSRPServerNotExpired = `-- name: CheckSRPServerNotExpired :one
 SELECT EXISTS (
     SELECT 1 FROM user_srp
@@ -25,6 +96,142 @@ func (q *Queries) CheckSRPServerNotExpired(ctx context.Context, uid string) (boo
 	return record_not_expired, err
 }
 
+const checkUserHasWebAuthnCredentials = `-- name: CheckUserHasWebAuthnCredentials :one
+SELECT EXISTS (
+    SELECT 1 FROM user_webauthn_credentials
+    WHERE user_id = $1
+) AS has_credentials
+`
+
+func (q *Queries) CheckUserHasWebAuthnCredentials(ctx context.Context, userID string) (bool, error) {
+	row := q.db.QueryRow(ctx, checkUserHasWebAuthnCredentials, userID)
+	var has_credentials bool
+	err := row.Scan(&has_credentials)
+	return has_credentials, err
+}
+
+const checkUserTOTPEnabled = `-- name: CheckUserTOTPEnabled :one
+SELECT EXISTS (
+    SELECT 1 FROM user_totp
+    WHERE user_id = $1 AND confirmed_at IS NOT NULL
+) AS enabled
+`
+
+func (q *Queries) CheckUserTOTPEnabled(ctx context.Context, userID string) (bool, error) {
+	row := q.db.QueryRow(ctx, checkUserTOTPEnabled, userID)
+	var enabled bool
+	err := row.Scan(&enabled)
+	return enabled, err
+}
+
+const confirmUserTOTP = `-- name: ConfirmUserTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL
+`
+
+type ConfirmUserTOTPParams struct {
+	UserID       string `json:"user_id"`
+	LastUsedStep int64  `json:"last_used_step"`
+}
+
+func (q *Queries) ConfirmUserTOTP(ctx context.Context, arg ConfirmUserTOTPParams) (int64, error) {
+	result, err := q.db.Exec(ctx, confirmUserTOTP, arg.UserID, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countUnusedRecoveryCodes = `-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM user_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) CountUnusedRecoveryCodes(ctx context.Context, userID string) (int64, error) {
+	row := q.db.QueryRow(ctx, countUnusedRecoveryCodes, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createInvitedUser = `-- name: CreateInvitedUser :one
+WITH invitation AS (
+    UPDATE user_invitations
+    SET used_at = NOW(), used_by = $1
+    WHERE hashed_token = $2
+      AND used_at IS NULL
+      AND expires_at > NOW()
+      -- the services must still be limited to their allowlists, see CreateInvitation
+      AND NOT EXISTS (
+          SELECT 1 FROM unnest(services) AS invited(service_id)
+          WHERE NOT EXISTS (
+              SELECT 1 FROM service_access_policies AS sap
+              WHERE sap.service_id = invited.service_id AND sap.mode = 'allowlist'
+          )
+      )
+    RETURNING roles, services
+), created AS (
+    INSERT INTO users (id, username, hashed_username, encoded_verifier)
+    SELECT $1, $3, $4, $5
+    FROM invitation
+    RETURNING id
+), allowlisted AS (
+    INSERT INTO service_allowed_users (service_id, user_id)
+    SELECT unnest(invitation.services), created.id
+    FROM created, invitation
+), service_roles AS (
+    INSERT INTO user_service_roles (user_id, service_id, roles)
+    SELECT created.id, unnest(invitation.services), invitation.roles
+    FROM created, invitation
+    WHERE cardinality(invitation.roles) > 0
+)
+SELECT id FROM created
+`
+
+type CreateInvitedUserParams struct {
+	ID              string `json:"id"`
+	HashedToken     string `json:"hashed_token"`
+	Username        string `json:"username"`
+	HashedUsername  string `json:"hashed_username"`
+	EncodedVerifier string `json:"encoded_verifier"`
+}
+
+func (q *Queries) CreateInvitedUser(ctx context.Context, arg CreateInvitedUserParams) (string, error) {
+	row := q.db.QueryRow(ctx, createInvitedUser,
+		arg.ID,
+		arg.HashedToken,
+		arg.Username,
+		arg.HashedUsername,
+		arg.EncodedVerifier,
+	)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createMFAChallenge = `-- name: CreateMFAChallenge :exec
+INSERT INTO user_mfa_challenges (hashed_token, user_id, service_id, expires_at)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateMFAChallengeParams struct {
+	HashedToken string             `json:"hashed_token"`
+	UserID      string             `json:"user_id"`
+	ServiceID   pgtype.UUID        `json:"service_id"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateMFAChallenge(ctx context.Context, arg CreateMFAChallengeParams) error {
+	_, err := q.db.Exec(ctx, createMFAChallenge,
+		arg.HashedToken,
+		arg.UserID,
+		arg.ServiceID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
 const createUser = `-- name: CreateUser :exec
 INSERT INTO users (id, username, hashed_username, encoded_verifier)
 VALUES ($1, $2, $3, $4)
@@ -47,30 +254,182 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
 	return err
 }
 
-const createUserSession = `-- name: CreateUserSession :exec
-INSERT INTO user_sessions (id, user_id, service_id, refresh_token_hash, expires_at)
+const createUserInvitation = `-- name: CreateUserInvitation :exec
+INSERT INTO user_invitations (id, hashed_token, roles, services, expires_at)
 VALUES ($1, $2, $3, $4, $5)
 `
 
+type CreateUserInvitationParams struct {
+	ID          pgtype.UUID        `json:"id"`
+	HashedToken string             `json:"hashed_token"`
+	Roles       []string           `json:"roles"`
+	Services    []pgtype.UUID      `json:"services"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateUserInvitation(ctx context.Context, arg CreateUserInvitationParams) error {
+	_, err := q.db.Exec(ctx, createUserInvitation,
+		arg.ID,
+		arg.HashedToken,
+		arg.Roles,
+		arg.Services,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createUserSession = `-- name: CreateUserSession :execrows
+INSERT INTO user_sessions (id, user_id, service_id, refresh_token_hash, expires_at)
+SELECT $1::text, u.id, $2::uuid, $3::text, $4::timestamptz
+FROM users u
+WHERE u.id = $5 AND u.disabled IS NOT TRUE
+FOR SHARE OF u
+`
+
 type CreateUserSessionParams struct {
 	ID               string             `json:"id"`
-	UserID           string             `json:"user_id"`
 	ServiceID        pgtype.UUID        `json:"service_id"`
 	RefreshTokenHash pgtype.Text        `json:"refresh_token_hash"`
 	ExpiresAt        pgtype.Timestamptz `json:"expires_at"`
+	UserID           string             `json:"user_id"`
 }
 
-func (q *Queries) CreateUserSession(ctx context.Context, arg CreateUserSessionParams) error {
-	_, err := q.db.Exec(ctx, createUserSession,
+// inserts nothing for a disabled user, the share lock makes DisableUser wait for the session to be committed
+func (q *Queries) CreateUserSession(ctx context.Context, arg CreateUserSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createUserSession,
 		arg.ID,
-		arg.UserID,
 		arg.ServiceID,
 		arg.RefreshTokenHash,
 		arg.ExpiresAt,
+		arg.UserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createWebAuthnChallenge = `-- name: CreateWebAuthnChallenge :exec
+INSERT INTO user_webauthn_challenges (hashed_challenge, ceremony, user_id, service_id, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateWebAuthnChallengeParams struct {
+	HashedChallenge string             `json:"hashed_challenge"`
+	Ceremony        string             `json:"ceremony"`
+	UserID          pgtype.Text        `json:"user_id"`
+	ServiceID       pgtype.UUID        `json:"service_id"`
+	ExpiresAt       pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateWebAuthnChallenge(ctx context.Context, arg CreateWebAuthnChallengeParams) error {
+	_, err := q.db.Exec(ctx, createWebAuthnChallenge,
+		arg.HashedChallenge,
+		arg.Ceremony,
+		arg.UserID,
+		arg.ServiceID,
+		arg.ExpiresAt,
 	)
 	return err
 }
 
+const createWebAuthnCredential = `-- name: CreateWebAuthnCredential :exec
+INSERT INTO user_webauthn_credentials (id, user_id, name, public_key, sign_count, transports)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type CreateWebAuthnCredentialParams struct {
+	ID         []byte   `json:"id"`
+	UserID     string   `json:"user_id"`
+	Name       string   `json:"name"`
+	PublicKey  []byte   `json:"public_key"`
+	SignCount  int64    `json:"sign_count"`
+	Transports []string `json:"transports"`
+}
+
+func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) error {
+	_, err := q.db.Exec(ctx, createWebAuthnCredential,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.PublicKey,
+		arg.SignCount,
+		arg.Transports,
+	)
+	return err
+}
+
+const deleteMFAChallenge = `-- name: DeleteMFAChallenge :execrows
+DELETE FROM user_mfa_challenges
+WHERE hashed_token = $1
+`
+
+func (q *Queries) DeleteMFAChallenge(ctx context.Context, hashedToken string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteMFAChallenge, hashedToken)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteOtherUserSessions = `-- name: DeleteOtherUserSessions :execrows
+WITH exchanges AS (
+    DELETE FROM user_token_code_exchange
+    WHERE session_id IN (
+        SELECT id FROM user_sessions
+        WHERE user_id = $1 AND id <> $2
+    )
+)
+DELETE FROM user_sessions
+WHERE user_id = $1 AND id <> $2
+`
+
+type DeleteOtherUserSessionsParams struct {
+	UserID string `json:"user_id"`
+	ID     string `json:"id"`
+}
+
+func (q *Queries) DeleteOtherUserSessions(ctx context.Context, arg DeleteOtherUserSessionsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteOtherUserSessions, arg.UserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUnusedUserInvitation = `-- name: DeleteUnusedUserInvitation :execrows
+DELETE FROM user_invitations
+WHERE id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) DeleteUnusedUserInvitation(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUnusedUserInvitation, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUserMFAChallenges = `-- name: DeleteUserMFAChallenges :exec
+DELETE FROM user_mfa_challenges
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserMFAChallenges(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteUserMFAChallenges, userID)
+	return err
+}
+
+const deleteUserRecoveryCodes = `-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM user_recovery_codes
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserRecoveryCodes(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteUserRecoveryCodes, userID)
+	return err
+}
+
 const deleteUserSession = `-- name: DeleteUserSession :exec
 DELETE FROM user_sessions
 WHERE id = $1 AND user_id = $2
@@ -86,6 +445,78 @@ func (q *Queries) DeleteUserSession(ctx context.Context, arg DeleteUserSessionPa
 	return err
 }
 
+const deleteUserTOTP = `-- name: DeleteUserTOTP :execrows
+DELETE FROM user_totp
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserTOTP(ctx context.Context, userID string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserTOTP, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteWebAuthnCredential = `-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM user_webauthn_credentials
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteWebAuthnCredentialParams struct {
+	ID     []byte `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+func (q *Queries) DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebAuthnCredential, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const disableUser = `-- name: DisableUser :execrows
+WITH exchanges AS (
+    DELETE FROM user_token_code_exchange
+    WHERE session_id IN (
+        SELECT id FROM user_sessions
+        WHERE user_id = $1
+    )
+), sessions AS (
+    DELETE FROM user_sessions
+    WHERE user_id = $1
+), challenges AS (
+    DELETE FROM user_mfa_challenges
+    WHERE user_id = $1
+)
+UPDATE users
+SET disabled = true
+WHERE id = $1
+`
+
+func (q *Queries) DisableUser(ctx context.Context, userID string) (int64, error) {
+	result, err := q.db.Exec(ctx, disableUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const enableUser = `-- name: EnableUser :execrows
+UPDATE users
+SET disabled = false
+WHERE id = $1
+`
+
+func (q *Queries) EnableUser(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.Exec(ctx, enableUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getAccessTokenDurationUsingSessionId = `-- name: GetAccessTokenDurationUsingSessionId :one
 SELECT svc.access_token_duration
 FROM services AS svc
@@ -100,6 +531,44 @@ func (q *Queries) GetAccessTokenDurationUsingSessionId(ctx context.Context, id s
 	return access_token_duration, err
 }
 
+const getAllUserTOTP = `-- name: GetAllUserTOTP :many
+SELECT user_id, encrypted_secret, nonce, kek_id FROM user_totp
+ORDER BY user_id
+FOR UPDATE
+`
+
+type GetAllUserTOTPRow struct {
+	UserID          string `json:"user_id"`
+	EncryptedSecret []byte `json:"encrypted_secret"`
+	Nonce           []byte `json:"nonce"`
+	KekID           string `json:"kek_id"`
+}
+
+func (q *Queries) GetAllUserTOTP(ctx context.Context) ([]GetAllUserTOTPRow, error) {
+	rows, err := q.db.Query(ctx, getAllUserTOTP)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetAllUserTOTPRow{}
+	for rows.Next() {
+		var i GetAllUserTOTPRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.EncryptedSecret,
+			&i.Nonce,
+			&i.KekID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAndDeleteSRPServer = `-- name: GetAndDeleteSRPServer :one
 DELETE FROM user_srp
 WHERE uid = $1 AND expires_at > NOW()
@@ -113,6 +582,30 @@ func (q *Queries) GetAndDeleteSRPServer(ctx context.Context, uid string) (UserSr
 	return i, err
 }
 
+const getMFAChallenge = `-- name: GetMFAChallenge :one
+SELECT user_id, service_id FROM user_mfa_challenges
+WHERE hashed_token = $1
+  AND expires_at > NOW()
+  AND attempts < $2
+`
+
+type GetMFAChallengeParams struct {
+	HashedToken string `json:"hashed_token"`
+	Attempts    int32  `json:"attempts"`
+}
+
+type GetMFAChallengeRow struct {
+	UserID    string      `json:"user_id"`
+	ServiceID pgtype.UUID `json:"service_id"`
+}
+
+func (q *Queries) GetMFAChallenge(ctx context.Context, arg GetMFAChallengeParams) (GetMFAChallengeRow, error) {
+	row := q.db.QueryRow(ctx, getMFAChallenge, arg.HashedToken, arg.Attempts)
+	var i GetMFAChallengeRow
+	err := row.Scan(&i.UserID, &i.ServiceID)
+	return i, err
+}
+
 const getSRPVerifier = `-- name: GetSRPVerifier :one
 SELECT encoded_verifier FROM users WHERE id = $1
 `
@@ -124,6 +617,76 @@ func (q *Queries) GetSRPVerifier(ctx context.Context, id string) (string, error)
 	return encoded_verifier, err
 }
 
+const getServiceAccessPolicy = `-- name: GetServiceAccessPolicy :one
+SELECT mode, required_roles FROM service_access_policies
+WHERE service_id = $1
+`
+
+type GetServiceAccessPolicyRow struct {
+	Mode          string   `json:"mode"`
+	RequiredRoles []string `json:"required_roles"`
+}
+
+func (q *Queries) GetServiceAccessPolicy(ctx context.Context, serviceID pgtype.UUID) (GetServiceAccessPolicyRow, error) {
+	row := q.db.QueryRow(ctx, getServiceAccessPolicy, serviceID)
+	var i GetServiceAccessPolicyRow
+	err := row.Scan(&i.Mode, &i.RequiredRoles)
+	return i, err
+}
+
+const getServiceAllowedUsers = `-- name: GetServiceAllowedUsers :many
+SELECT u.username
+FROM service_allowed_users AS sau
+JOIN users AS u ON u.id = sau.user_id
+WHERE sau.service_id = $1
+ORDER BY u.username
+`
+
+func (q *Queries) GetServiceAllowedUsers(ctx context.Context, serviceID pgtype.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, getServiceAllowedUsers, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		items = append(items, username)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnusedRecoveryCodes = `-- name: GetUnusedRecoveryCodes :many
+SELECT code_hash FROM user_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) GetUnusedRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	rows, err := q.db.Query(ctx, getUnusedRecoveryCodes, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var code_hash string
+		if err := rows.Scan(&code_hash); err != nil {
+			return nil, err
+		}
+		items = append(items, code_hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUser = `-- name: GetUser :one
 SELECT id, username, last_login_at FROM users
 WHERE id = $1
@@ -142,6 +705,18 @@ func (q *Queries) GetUser(ctx context.Context, id string) (GetUserRow, error) {
 	return i, err
 }
 
+const getUserDisabled = `-- name: GetUserDisabled :one
+SELECT disabled FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserDisabled(ctx context.Context, id string) (pgtype.Bool, error) {
+	row := q.db.QueryRow(ctx, getUserDisabled, id)
+	var disabled pgtype.Bool
+	err := row.Scan(&disabled)
+	return disabled, err
+}
+
 const getUserIDFromUsername = `-- name: GetUserIDFromUsername :one
 SELECT id FROM users
 WHERE username = $1
@@ -166,20 +741,104 @@ func (q *Queries) GetUserIDFromUsernameHash(ctx context.Context, hashedUsername
 	return id, err
 }
 
-const getUserRoles = `-- name: GetUserRoles :one
-SELECT roles FROM users
-WHERE id = $1
+const getUserInvitations = `-- name: GetUserInvitations :many
+SELECT ui.id, ui.roles, ui.services, ui.expires_at, ui.created_at, ui.used_at, u.username AS used_by
+FROM user_invitations AS ui
+LEFT JOIN users AS u ON u.id = ui.used_by
+ORDER BY ui.created_at DESC
 `
 
-func (q *Queries) GetUserRoles(ctx context.Context, id string) ([]string, error) {
-	row := q.db.QueryRow(ctx, getUserRoles, id)
+type GetUserInvitationsRow struct {
+	ID        pgtype.UUID        `json:"id"`
+	Roles     []string           `json:"roles"`
+	Services  []pgtype.UUID      `json:"services"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	UsedBy    pgtype.Text        `json:"used_by"`
+}
+
+func (q *Queries) GetUserInvitations(ctx context.Context) ([]GetUserInvitationsRow, error) {
+	rows, err := q.db.Query(ctx, getUserInvitations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetUserInvitationsRow{}
+	for rows.Next() {
+		var i GetUserInvitationsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Roles,
+			&i.Services,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.UsedAt,
+			&i.UsedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserRolesByService = `-- name: GetUserRolesByService :many
+SELECT usr.service_id, s.name AS service_name, usr.roles
+FROM user_service_roles AS usr
+JOIN services AS s ON s.id = usr.service_id
+WHERE usr.user_id = $1 AND cardinality(usr.roles) > 0
+ORDER BY s.name
+`
+
+type GetUserRolesByServiceRow struct {
+	ServiceID   pgtype.UUID `json:"service_id"`
+	ServiceName string      `json:"service_name"`
+	Roles       []string    `json:"roles"`
+}
+
+func (q *Queries) GetUserRolesByService(ctx context.Context, userID string) ([]GetUserRolesByServiceRow, error) {
+	rows, err := q.db.Query(ctx, getUserRolesByService, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetUserRolesByServiceRow{}
+	for rows.Next() {
+		var i GetUserRolesByServiceRow
+		if err := rows.Scan(&i.ServiceID, &i.ServiceName, &i.Roles); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserServiceRoles = `-- name: GetUserServiceRoles :one
+SELECT roles FROM user_service_roles
+WHERE user_id = $1 AND service_id = $2
+`
+
+type GetUserServiceRolesParams struct {
+	UserID    string      `json:"user_id"`
+	ServiceID pgtype.UUID `json:"service_id"`
+}
+
+func (q *Queries) GetUserServiceRoles(ctx context.Context, arg GetUserServiceRolesParams) ([]string, error) {
+	row := q.db.QueryRow(ctx, getUserServiceRoles, arg.UserID, arg.ServiceID)
 	var roles []string
 	err := row.Scan(&roles)
 	return roles, err
 }
 
 const getUserSession = `-- name: GetUserSession :one
-SELECT id, user_id, service_id, refresh_token_hash, expires_at, created_at, last_authenticated_at FROM user_sessions
+SELECT id, user_id, service_id, refresh_token_hash, expires_at, created_at, last_authenticated_at, refresh_token_generation, reauthenticated_at FROM user_sessions
 WHERE id = $1
 `
 
@@ -194,10 +853,138 @@ func (q *Queries) GetUserSession(ctx context.Context, id string) (UserSession, e
 		&i.ExpiresAt,
 		&i.CreatedAt,
 		&i.LastAuthenticatedAt,
+		&i.RefreshTokenGeneration,
+		&i.ReauthenticatedAt,
 	)
 	return i, err
 }
 
+const getUserSessionPreviousRefreshToken = `-- name: GetUserSessionPreviousRefreshToken :one
+SELECT token_hash, rotated_at FROM user_session_refresh_tokens
+WHERE session_id = $1 AND generation = $2
+`
+
+type GetUserSessionPreviousRefreshTokenParams struct {
+	SessionID  string `json:"session_id"`
+	Generation int32  `json:"generation"`
+}
+
+type GetUserSessionPreviousRefreshTokenRow struct {
+	TokenHash string             `json:"token_hash"`
+	RotatedAt pgtype.Timestamptz `json:"rotated_at"`
+}
+
+func (q *Queries) GetUserSessionPreviousRefreshToken(ctx context.Context, arg GetUserSessionPreviousRefreshTokenParams) (GetUserSessionPreviousRefreshTokenRow, error) {
+	row := q.db.QueryRow(ctx, getUserSessionPreviousRefreshToken, arg.SessionID, arg.Generation)
+	var i GetUserSessionPreviousRefreshTokenRow
+	err := row.Scan(&i.TokenHash, &i.RotatedAt)
+	return i, err
+}
+
+const getUserTOTP = `-- name: GetUserTOTP :one
+SELECT user_id, encrypted_secret, nonce, kek_id, confirmed_at, last_used_step, created_at FROM user_totp
+WHERE user_id = $1
+`
+
+func (q *Queries) GetUserTOTP(ctx context.Context, userID string) (UserTotp, error) {
+	row := q.db.QueryRow(ctx, getUserTOTP, userID)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.EncryptedSecret,
+		&i.Nonce,
+		&i.KekID,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserWebAuthnCredentials = `-- name: GetUserWebAuthnCredentials :many
+SELECT id, user_id, name, public_key, sign_count, transports, created_at, last_used_at FROM user_webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetUserWebAuthnCredentials(ctx context.Context, userID string) ([]UserWebauthnCredential, error) {
+	rows, err := q.db.Query(ctx, getUserWebAuthnCredentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserWebauthnCredential{}
+	for rows.Next() {
+		var i UserWebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.PublicKey,
+			&i.SignCount,
+			&i.Transports,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebAuthnCredential = `-- name: GetWebAuthnCredential :one
+SELECT id, user_id, name, public_key, sign_count, transports, created_at, last_used_at FROM user_webauthn_credentials
+WHERE id = $1
+`
+
+func (q *Queries) GetWebAuthnCredential(ctx context.Context, id []byte) (UserWebauthnCredential, error) {
+	row := q.db.QueryRow(ctx, getWebAuthnCredential, id)
+	var i UserWebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.PublicKey,
+		&i.SignCount,
+		&i.Transports,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const insertAuthorizationCode = `-- name: InsertAuthorizationCode :exec
+INSERT INTO user_token_code_exchange (session_id, expires_at, hashed_code, code_challenge, redirect_uri, nonce, auth_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type InsertAuthorizationCodeParams struct {
+	SessionID     string             `json:"session_id"`
+	ExpiresAt     pgtype.Timestamptz `json:"expires_at"`
+	HashedCode    string             `json:"hashed_code"`
+	CodeChallenge pgtype.Text        `json:"code_challenge"`
+	RedirectUri   pgtype.Text        `json:"redirect_uri"`
+	Nonce         pgtype.Text        `json:"nonce"`
+	AuthTime      pgtype.Timestamptz `json:"auth_time"`
+}
+
+func (q *Queries) InsertAuthorizationCode(ctx context.Context, arg InsertAuthorizationCodeParams) error {
+	_, err := q.db.Exec(ctx, insertAuthorizationCode,
+		arg.SessionID,
+		arg.ExpiresAt,
+		arg.HashedCode,
+		arg.CodeChallenge,
+		arg.RedirectUri,
+		arg.Nonce,
+		arg.AuthTime,
+	)
+	return err
+}
+
 const insertCodeToSessionTokenExchange = `-- name: InsertCodeToSessionTokenExchange :exec
 INSERT INTO user_token_code_exchange (session_id, expires_at, hashed_code)
 VALUES ($1, $2, $3)
@@ -214,19 +1001,187 @@ func (q *Queries) InsertCodeToSessionTokenExchange(ctx context.Context, arg Inse
 	return err
 }
 
-const rotateUserSessionRefreshToken = `-- name: RotateUserSessionRefreshToken :exec
+const isUserAllowedInService = `-- name: IsUserAllowedInService :one
+SELECT EXISTS (
+    SELECT 1 FROM service_allowed_users
+    WHERE service_id = $1 AND user_id = $2
+)
+`
+
+type IsUserAllowedInServiceParams struct {
+	ServiceID pgtype.UUID `json:"service_id"`
+	UserID    string      `json:"user_id"`
+}
+
+func (q *Queries) IsUserAllowedInService(ctx context.Context, arg IsUserAllowedInServiceParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isUserAllowedInService, arg.ServiceID, arg.UserID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const lockUser = `-- name: LockUser :exec
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) LockUser(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, lockUser, id)
+	return err
+}
+
+const lockUserTOTPInserts = `-- name: LockUserTOTPInserts :exec
+LOCK TABLE user_totp IN SHARE ROW EXCLUSIVE MODE
+`
+
+func (q *Queries) LockUserTOTPInserts(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockUserTOTPInserts)
+	return err
+}
+
+const removeServiceAllowedUser = `-- name: RemoveServiceAllowedUser :execrows
+DELETE FROM service_allowed_users
+WHERE service_id = $1 AND user_id = $2
+`
+
+type RemoveServiceAllowedUserParams struct {
+	ServiceID pgtype.UUID `json:"service_id"`
+	UserID    string      `json:"user_id"`
+}
+
+func (q *Queries) RemoveServiceAllowedUser(ctx context.Context, arg RemoveServiceAllowedUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeServiceAllowedUser, arg.ServiceID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeUserServiceRoles = `-- name: RemoveUserServiceRoles :one
+UPDATE user_service_roles
+SET roles = ARRAY(
+    SELECT role
+    FROM unnest(roles) AS role
+    WHERE role <> ALL($1::text[])
+    ORDER BY role
+)
+WHERE user_id = $2 AND service_id = $3
+RETURNING roles
+`
+
+type RemoveUserServiceRolesParams struct {
+	Roles     []string    `json:"roles"`
+	UserID    string      `json:"user_id"`
+	ServiceID pgtype.UUID `json:"service_id"`
+}
+
+func (q *Queries) RemoveUserServiceRoles(ctx context.Context, arg RemoveUserServiceRolesParams) ([]string, error) {
+	row := q.db.QueryRow(ctx, removeUserServiceRoles, arg.Roles, arg.UserID, arg.ServiceID)
+	var roles []string
+	err := row.Scan(&roles)
+	return roles, err
+}
+
+const replaceRecoveryCodes = `-- name: ReplaceRecoveryCodes :exec
+WITH deleted AS (
+    DELETE FROM user_recovery_codes
+    WHERE user_id = $1
+)
+INSERT INTO user_recovery_codes (user_id, code_hash)
+SELECT $1, unnest($2::text[])
+`
+
+type ReplaceRecoveryCodesParams struct {
+	UserID     string   `json:"user_id"`
+	CodeHashes []string `json:"code_hashes"`
+}
+
+func (q *Queries) ReplaceRecoveryCodes(ctx context.Context, arg ReplaceRecoveryCodesParams) error {
+	_, err := q.db.Exec(ctx, replaceRecoveryCodes, arg.UserID, arg.CodeHashes)
+	return err
+}
+
+const rewrapUserTOTP = `-- name: RewrapUserTOTP :execrows
+UPDATE user_totp AS t
+SET
+    encrypted_secret = rewrapped.encrypted_secret,
+    nonce = rewrapped.nonce,
+    kek_id = $1::text
+FROM unnest(
+    $2::text[],
+    $3::bytea[],
+    $4::bytea[]
+) AS rewrapped(user_id, encrypted_secret, nonce)
+WHERE t.user_id = rewrapped.user_id
+`
+
+type RewrapUserTOTPParams struct {
+	KekID            string   `json:"kek_id"`
+	UserIds          []string `json:"user_ids"`
+	EncryptedSecrets [][]byte `json:"encrypted_secrets"`
+	Nonces           [][]byte `json:"nonces"`
+}
+
+func (q *Queries) RewrapUserTOTP(ctx context.Context, arg RewrapUserTOTPParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rewrapUserTOTP,
+		arg.KekID,
+		arg.UserIds,
+		arg.EncryptedSecrets,
+		arg.Nonces,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rotateUserSessionRefreshToken = `-- name: RotateUserSessionRefreshToken :one
+WITH previous AS (
+    INSERT INTO user_session_refresh_tokens (session_id, generation, token_hash)
+    SELECT us.id, us.refresh_token_generation, us.refresh_token_hash
+    FROM user_sessions AS us
+    WHERE us.id = $2
+      AND us.refresh_token_generation = $3
+      AND us.refresh_token_hash IS NOT NULL
+    ON CONFLICT (session_id, generation) DO NOTHING
+)
 UPDATE user_sessions
-SET refresh_token_hash = $1
+SET refresh_token_hash = $1,
+    refresh_token_generation = refresh_token_generation + 1
 WHERE id = $2
+  AND refresh_token_generation = $3
+RETURNING refresh_token_generation
 `
 
 type RotateUserSessionRefreshTokenParams struct {
-	RefreshTokenHash pgtype.Text `json:"refresh_token_hash"`
-	ID               string      `json:"id"`
+	RefreshTokenHash       pgtype.Text `json:"refresh_token_hash"`
+	ID                     string      `json:"id"`
+	RefreshTokenGeneration int32       `json:"refresh_token_generation"`
+}
+
+func (q *Queries) RotateUserSessionRefreshToken(ctx context.Context, arg RotateUserSessionRefreshTokenParams) (int32, error) {
+	row := q.db.QueryRow(ctx, rotateUserSessionRefreshToken, arg.RefreshTokenHash, arg.ID, arg.RefreshTokenGeneration)
+	var refresh_token_generation int32
+	err := row.Scan(&refresh_token_generation)
+	return refresh_token_generation, err
+}
+
+const setServiceAccessPolicy = `-- name: SetServiceAccessPolicy :exec
+INSERT INTO service_access_policies (service_id, mode, required_roles)
+VALUES ($1, $2, $3)
+ON CONFLICT (service_id) DO UPDATE
+SET mode = EXCLUDED.mode, required_roles = EXCLUDED.required_roles, modified_at = NOW()
+`
+
+type SetServiceAccessPolicyParams struct {
+	ServiceID     pgtype.UUID `json:"service_id"`
+	Mode          string      `json:"mode"`
+	RequiredRoles []string    `json:"required_roles"`
 }
 
-func (q *Queries) RotateUserSessionRefreshToken(ctx context.Context, arg RotateUserSessionRefreshTokenParams) error {
-	_, err := q.db.Exec(ctx, rotateUserSessionRefreshToken, arg.RefreshTokenHash, arg.ID)
+func (q *Queries) SetServiceAccessPolicy(ctx context.Context, arg SetServiceAccessPolicyParams) error {
+	_, err := q.db.Exec(ctx, setServiceAccessPolicy, arg.ServiceID, arg.Mode, arg.RequiredRoles)
 	return err
 }
 
@@ -252,6 +1207,64 @@ func (q *Queries) UpdateUserSessionLastAuthenticatedAt(ctx context.Context, id s
 	return err
 }
 
+const updateUserSessionReauthenticatedAt = `-- name: UpdateUserSessionReauthenticatedAt :execrows
+UPDATE user_sessions
+SET reauthenticated_at = NOW()
+WHERE id = $1 AND user_id = $2
+`
+
+type UpdateUserSessionReauthenticatedAtParams struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+func (q *Queries) UpdateUserSessionReauthenticatedAt(ctx context.Context, arg UpdateUserSessionReauthenticatedAtParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserSessionReauthenticatedAt, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserVerifier = `-- name: UpdateUserVerifier :execrows
+UPDATE users
+SET encoded_verifier = $2
+WHERE id = $1
+`
+
+type UpdateUserVerifierParams struct {
+	ID              string `json:"id"`
+	EncodedVerifier string `json:"encoded_verifier"`
+}
+
+func (q *Queries) UpdateUserVerifier(ctx context.Context, arg UpdateUserVerifierParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserVerifier, arg.ID, arg.EncodedVerifier)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateWebAuthnCredentialSignCount = `-- name: UpdateWebAuthnCredentialSignCount :execrows
+UPDATE user_webauthn_credentials
+SET sign_count = $2, last_used_at = NOW()
+WHERE id = $1
+  AND (sign_count < $2 OR $2 = 0)
+`
+
+type UpdateWebAuthnCredentialSignCountParams struct {
+	ID        []byte `json:"id"`
+	SignCount int64  `json:"sign_count"`
+}
+
+func (q *Queries) UpdateWebAuthnCredentialSignCount(ctx context.Context, arg UpdateWebAuthnCredentialSignCountParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateWebAuthnCredentialSignCount, arg.ID, arg.SignCount)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const upsertSRPServer = `-- name: UpsertSRPServer :exec
 INSERT INTO user_srp (uid, encoded_server, expires_at)
 VALUES ($1, $2, $3)
@@ -270,10 +1283,91 @@ func (q *Queries) UpsertSRPServer(ctx context.Context, arg UpsertSRPServerParams
 	return err
 }
 
+const upsertUserTOTP = `-- name: UpsertUserTOTP :execrows
+INSERT INTO user_totp (user_id, encrypted_secret, nonce, kek_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE
+SET encrypted_secret = EXCLUDED.encrypted_secret,
+    nonce = EXCLUDED.nonce,
+    kek_id = EXCLUDED.kek_id,
+    last_used_step = 0,
+    created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+`
+
+type UpsertUserTOTPParams struct {
+	UserID          string `json:"user_id"`
+	EncryptedSecret []byte `json:"encrypted_secret"`
+	Nonce           []byte `json:"nonce"`
+	KekID           string `json:"kek_id"`
+}
+
+func (q *Queries) UpsertUserTOTP(ctx context.Context, arg UpsertUserTOTPParams) (int64, error) {
+	result, err := q.db.Exec(ctx, upsertUserTOTP,
+		arg.UserID,
+		arg.EncryptedSecret,
+		arg.Nonce,
+		arg.KekID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useAuthorizationCode = `-- name: UseAuthorizationCode :one
+DELETE FROM user_token_code_exchange AS token
+WHERE token.hashed_code = $1
+  AND token.expires_at > NOW()
+  AND token.code_challenge IS NOT NULL
+RETURNING
+  token.session_id,
+  token.code_challenge,
+  token.redirect_uri,
+  token.nonce,
+  token.auth_time
+`
+
+type UseAuthorizationCodeRow struct {
+	SessionID     string             `json:"session_id"`
+	CodeChallenge pgtype.Text        `json:"code_challenge"`
+	RedirectUri   pgtype.Text        `json:"redirect_uri"`
+	Nonce         pgtype.Text        `json:"nonce"`
+	AuthTime      pgtype.Timestamptz `json:"auth_time"`
+}
+
+func (q *Queries) UseAuthorizationCode(ctx context.Context, hashedCode string) (UseAuthorizationCodeRow, error) {
+	row := q.db.QueryRow(ctx, useAuthorizationCode, hashedCode)
+	var i UseAuthorizationCodeRow
+	err := row.Scan(
+		&i.SessionID,
+		&i.CodeChallenge,
+		&i.RedirectUri,
+		&i.Nonce,
+		&i.AuthTime,
+	)
+	return i, err
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE user_recovery_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL
+`
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, codeHash string) (int64, error) {
+	result, err := q.db.Exec(ctx, useRecoveryCode, codeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const useTokenExchangeCode = `-- name: UseTokenExchangeCode :one
 DELETE FROM user_token_code_exchange AS token
 WHERE token.hashed_code = $1
   AND token.expires_at > NOW()
+  AND token.code_challenge IS NULL
 RETURNING
   token.session_id
 `
@@ -284,3 +1378,49 @@ func (q *Queries) UseTokenExchangeCode(ctx context.Context, hashedCode string) (
 	err := row.Scan(&session_id)
 	return session_id, err
 }
+
+const useUserTOTPStep = `-- name: UseUserTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1
+  AND confirmed_at IS NOT NULL
+  AND last_used_step < $2
+`
+
+type UseUserTOTPStepParams struct {
+	UserID       string `json:"user_id"`
+	LastUsedStep int64  `json:"last_used_step"`
+}
+
+func (q *Queries) UseUserTOTPStep(ctx context.Context, arg UseUserTOTPStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useUserTOTPStep, arg.UserID, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useWebAuthnChallenge = `-- name: UseWebAuthnChallenge :one
+DELETE FROM user_webauthn_challenges
+WHERE hashed_challenge = $1
+  AND ceremony = $2
+  AND expires_at > NOW()
+RETURNING user_id, service_id
+`
+
+type UseWebAuthnChallengeParams struct {
+	HashedChallenge string `json:"hashed_challenge"`
+	Ceremony        string `json:"ceremony"`
+}
+
+type UseWebAuthnChallengeRow struct {
+	UserID    pgtype.Text `json:"user_id"`
+	ServiceID pgtype.UUID `json:"service_id"`
+}
+
+func (q *Queries) UseWebAuthnChallenge(ctx context.Context, arg UseWebAuthnChallengeParams) (UseWebAuthnChallengeRow, error) {
+	row := q.db.QueryRow(ctx, useWebAuthnChallenge, arg.HashedChallenge, arg.Ceremony)
+	var i UseWebAuthnChallengeRow
+	err := row.Scan(&i.UserID, &i.ServiceID)
+	return i, err
+}
@@ -0,0 +1,8 @@
+
+-- +migrate Up
+ALTER TABLE user_token_code_exchange ADD COLUMN code_challenge TEXT; -- PKCE S256, NULL for the legacy code flow
+ALTER TABLE user_token_code_exchange ADD COLUMN redirect_uri TEXT;
+
+-- +migrate Down
+ALTER TABLE user_token_code_exchange DROP COLUMN redirect_uri;
+ALTER TABLE user_token_code_exchange DROP COLUMN code_challenge;
@@ -0,0 +1,18 @@
+
+-- +migrate Up
+CREATE TABLE m2m_clients (
+    id text PRIMARY KEY, -- client_id
+    service_id uuid NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    subject_id text NOT NULL,
+    template_id text NOT NULL,
+    secret_hash text NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (template_id, service_id) REFERENCES m2m_session_templates(id, service_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_m2m_clients_service_id ON m2m_clients(service_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_m2m_clients_service_id;
+DROP TABLE IF EXISTS m2m_clients;
@@ -0,0 +1,8 @@
+
+-- +migrate Up
+ALTER TABLE user_token_code_exchange ADD COLUMN nonce TEXT; -- OIDC, echoed back in the id_token
+ALTER TABLE user_token_code_exchange ADD COLUMN auth_time TIMESTAMP WITH TIME ZONE;
+
+-- +migrate Down
+ALTER TABLE user_token_code_exchange DROP COLUMN auth_time;
+ALTER TABLE user_token_code_exchange DROP COLUMN nonce;
@@ -0,0 +1,29 @@
+
+-- +migrate Up
+ALTER TABLE user_sessions ADD COLUMN refresh_token_generation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE m2m_sessions ADD COLUMN refresh_token_generation INTEGER NOT NULL DEFAULT 0;
+
+-- hashes of rotated refresh tokens, presenting one of these again revokes the session
+CREATE TABLE user_session_refresh_tokens (
+    session_id text NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+    generation INTEGER NOT NULL,
+    token_hash text NOT NULL,
+    rotated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (session_id, generation)
+);
+
+CREATE TABLE m2m_session_refresh_tokens (
+    session_id text NOT NULL REFERENCES m2m_sessions(id) ON DELETE CASCADE,
+    generation INTEGER NOT NULL,
+    token_hash text NOT NULL,
+    rotated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (session_id, generation)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS m2m_session_refresh_tokens;
+DROP TABLE IF EXISTS user_session_refresh_tokens;
+ALTER TABLE m2m_sessions DROP COLUMN refresh_token_generation;
+ALTER TABLE user_sessions DROP COLUMN refresh_token_generation;
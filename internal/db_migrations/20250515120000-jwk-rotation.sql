@@ -0,0 +1,10 @@
+
+-- +migrate Up
+ALTER TABLE services ADD COLUMN jwk_rotation_interval INT NOT NULL DEFAULT 0; -- seconds, 0 disables automatic rotation, services opt in with `kuura jwks policy`
+ALTER TABLE services ADD COLUMN jwk_retirement_period INT NOT NULL DEFAULT 604800; -- seconds a retired key stays published
+ALTER TABLE service_key_states ADD COLUMN status_changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+-- +migrate Down
+ALTER TABLE service_key_states DROP COLUMN status_changed_at;
+ALTER TABLE services DROP COLUMN jwk_retirement_period;
+ALTER TABLE services DROP COLUMN jwk_rotation_interval;
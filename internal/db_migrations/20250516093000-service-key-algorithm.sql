@@ -0,0 +1,7 @@
+
+-- +migrate Up
+ALTER TABLE services ADD COLUMN jwk_algorithm TEXT NOT NULL DEFAULT 'ES384'
+    CHECK (jwk_algorithm IN ('ES256', 'ES384', 'RS256', 'EdDSA')); -- only used for new keys, existing keys keep their algorithm
+
+-- +migrate Down
+ALTER TABLE services DROP COLUMN jwk_algorithm;
@@ -0,0 +1,6 @@
+
+-- +migrate Up
+ALTER TABLE jwk_private ADD COLUMN kek_id TEXT NOT NULL DEFAULT 'default'; -- which key encryption key sealed encrypted_key_data
+
+-- +migrate Down
+ALTER TABLE jwk_private DROP COLUMN kek_id;
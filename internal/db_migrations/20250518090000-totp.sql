@@ -0,0 +1,28 @@
+
+-- +migrate Up
+CREATE TABLE user_totp (
+    user_id text PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    encrypted_secret bytea NOT NULL,
+    nonce bytea NOT NULL,
+    kek_id text NOT NULL, -- which key encryption key sealed encrypted_secret
+    confirmed_at TIMESTAMP WITH TIME ZONE, -- NULL until the first code is verified
+    last_used_step BIGINT NOT NULL DEFAULT 0, -- codes of this or earlier steps are rejected
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- logins that passed SRP but still need a second factor
+CREATE TABLE user_mfa_challenges (
+    hashed_token text PRIMARY KEY,
+    user_id text NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    service_id uuid NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_mfa_challenges_user_id ON user_mfa_challenges(user_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_user_mfa_challenges_user_id;
+DROP TABLE IF EXISTS user_mfa_challenges;
+DROP TABLE IF EXISTS user_totp;
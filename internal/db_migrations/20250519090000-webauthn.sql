@@ -0,0 +1,29 @@
+
+-- +migrate Up
+CREATE TABLE user_webauthn_credentials (
+    id bytea PRIMARY KEY, -- credential id chosen by the authenticator
+    user_id text NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name text NOT NULL DEFAULT '',
+    public_key bytea NOT NULL, -- COSE_Key
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports text[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_user_webauthn_credentials_user_id ON user_webauthn_credentials(user_id);
+
+-- challenges of registrations and logins in progress, user_id is NULL for passwordless logins
+CREATE TABLE user_webauthn_challenges (
+    hashed_challenge text PRIMARY KEY,
+    ceremony text NOT NULL,
+    user_id text REFERENCES users(id) ON DELETE CASCADE,
+    service_id uuid REFERENCES services(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_webauthn_challenges;
+DROP INDEX IF EXISTS idx_user_webauthn_credentials_user_id;
+DROP TABLE IF EXISTS user_webauthn_credentials;
@@ -0,0 +1,14 @@
+
+-- +migrate Up
+CREATE TABLE user_recovery_codes (
+    code_hash text PRIMARY KEY, -- argon2id
+    user_id text NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_user_recovery_codes_user_id;
+DROP TABLE IF EXISTS user_recovery_codes;
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE user_invitations (
+    id uuid PRIMARY KEY,
+    hashed_token text UNIQUE NOT NULL, -- HMAC-SHA256
+    roles text[] NOT NULL DEFAULT '{}',
+    services uuid[] NOT NULL DEFAULT '{}', -- the invited user is added to their allowlists and gets the roles there
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP WITH TIME ZONE,
+    used_by text REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_invitations;
@@ -0,0 +1,30 @@
+
+-- +migrate Up
+CREATE TABLE user_service_roles (
+    user_id text NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    service_id uuid NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    roles text[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (user_id, service_id)
+);
+
+-- the global roles were granted in every service, existing users keep them there
+INSERT INTO user_service_roles (user_id, service_id, roles)
+SELECT u.id, s.id, u.roles
+FROM users AS u
+CROSS JOIN services AS s
+WHERE cardinality(u.roles) > 0;
+
+ALTER TABLE users DROP COLUMN roles;
+
+-- +migrate Down
+ALTER TABLE users ADD COLUMN roles text[] DEFAULT '{}';
+
+UPDATE users AS u
+SET roles = ARRAY(
+    SELECT DISTINCT role
+    FROM user_service_roles AS usr, unnest(usr.roles) AS role
+    WHERE usr.user_id = u.id
+    ORDER BY role
+);
+
+DROP TABLE IF EXISTS user_service_roles;
@@ -0,0 +1,20 @@
+
+-- +migrate Up
+-- services without a policy are open to every user
+CREATE TABLE service_access_policies (
+    service_id uuid PRIMARY KEY REFERENCES services(id) ON DELETE CASCADE,
+    mode text NOT NULL, -- open, allowlist or roles
+    required_roles text[] NOT NULL DEFAULT '{}',
+    modified_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE service_allowed_users (
+    service_id uuid NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    user_id text NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (service_id, user_id)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS service_allowed_users;
+DROP TABLE IF EXISTS service_access_policies;
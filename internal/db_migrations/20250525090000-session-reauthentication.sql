@@ -0,0 +1,7 @@
+
+-- +migrate Up
+-- when the user last proved their identity again within the session, sensitive account changes require it to be recent
+ALTER TABLE user_sessions ADD COLUMN reauthenticated_at TIMESTAMP WITH TIME ZONE;
+
+-- +migrate Down
+ALTER TABLE user_sessions DROP COLUMN reauthenticated_at;
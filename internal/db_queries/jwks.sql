@@ -1,8 +1,8 @@
 
 -- name: InsertJWKTransaction :exec
 WITH inserted_private_key AS (
-    INSERT INTO jwk_private (id, service_id, encrypted_key_data, nonce)
-    VALUES ($1, $2, $3, $4)
+    INSERT INTO jwk_private (id, service_id, encrypted_key_data, nonce, kek_id)
+    VALUES ($1, $2, $3, $4, $6)
     RETURNING id
 ),
 inserted_public_key AS (
@@ -12,25 +12,17 @@ inserted_public_key AS (
 )
 SELECT * FROM inserted_private_key, inserted_public_key;
 
+-- name: DeleteServiceKeyState :execrows
+DELETE FROM service_key_states
+WHERE service_id = $1 AND jwk_private_id = $2;
+
 -- name: DeleteJWKPublic :exec
 DELETE FROM jwk_public_keys
-WHERE id = $1
-AND EXISTS (
-    SELECT 1 
-    FROM service_key_states
-    WHERE service_key_states.service_id = $2
-    AND service_key_states.jwk_private_id = $1
-);
+WHERE id = $1 AND service_id = $2;
 
 -- name: DeleteJWKPrivate :exec
 DELETE FROM jwk_private
-WHERE id = $1
-AND EXISTS (
-    SELECT 1 
-    FROM service_key_states
-    WHERE service_key_states.service_id = $2
-    AND service_key_states.jwk_private_id = $1
-);
+WHERE id = $1 AND service_id = $2;
 
 -- name: GetJWKPrivate :one
 SELECT 
@@ -38,6 +30,7 @@ SELECT
     p.service_id,
     p.encrypted_key_data,
     p.nonce,
+    p.kek_id,
     p.created_at,
     k.key_data AS public_key_data
 FROM 
@@ -59,6 +52,7 @@ SELECT
     p.service_id,
     p.encrypted_key_data,
     p.nonce,
+    p.kek_id,
     p.created_at,
     k.key_data AS public_key_data
 FROM 
@@ -99,13 +93,15 @@ VALUES ($1, $2, 'future');
 
 -- name: SetJWKStatusToCurrent :exec
 UPDATE service_key_states
-SET status = 'current'
+SET status = 'current',
+    status_changed_at = NOW()
 WHERE service_id = $1
   AND jwk_private_id = $2;
 
 -- name: SetJWKStatusToRetired :exec
 UPDATE service_key_states
-SET status = 'retired'
+SET status = 'retired',
+    status_changed_at = NOW()
 WHERE service_id = $1
   AND jwk_private_id = $2;
 
@@ -136,5 +132,44 @@ ORDER BY p.created_at ASC
 LIMIT 1;
 
 -- name: GetKeyStatus :many
-SELECT status, jwk_private_id FROM service_key_states
+SELECT status, jwk_private_id, status_changed_at FROM service_key_states
 WHERE service_id = $1;
+
+-- name: GetKeySet :many
+-- one statement so the keys and their states always describe the same key set
+SELECT pk.id, pk.key_data, sks.status, sks.status_changed_at
+FROM service_key_states AS sks
+JOIN jwk_public_keys AS pk ON pk.id = sks.jwk_private_id
+WHERE sks.service_id = $1;
+
+-- name: GetServiceJWKAlgorithm :one
+SELECT jwk_algorithm FROM services
+WHERE id = $1;
+
+-- name: GetAllJWKPrivate :many
+SELECT id, encrypted_key_data, nonce, kek_id FROM jwk_private
+ORDER BY id
+FOR UPDATE;
+
+-- name: LockJWKPrivateInserts :exec
+LOCK TABLE jwk_private IN SHARE ROW EXCLUSIVE MODE;
+
+-- name: RewrapJWKPrivate :execrows
+UPDATE jwk_private AS p
+SET
+    encrypted_key_data = rewrapped.encrypted_key_data,
+    nonce = rewrapped.nonce,
+    kek_id = sqlc.arg(kek_id)
+FROM unnest(
+    sqlc.arg(ids)::text[],
+    sqlc.arg(encrypted_key_data)::bytea[],
+    sqlc.arg(nonces)::bytea[],
+    sqlc.arg(previous_nonces)::bytea[]
+) AS rewrapped(id, encrypted_key_data, nonce, previous_nonce)
+WHERE p.id = rewrapped.id AND p.nonce = rewrapped.previous_nonce;
+
+-- name: TryAdvisoryXactLock :one
+SELECT pg_try_advisory_xact_lock(sqlc.arg(key)::bigint) AS locked;
+
+-- name: AdvisoryXactLock :exec
+SELECT pg_advisory_xact_lock(sqlc.arg(key)::bigint);
@@ -36,6 +36,7 @@ SELECT
     m.last_authenticated_at,
     m.expires_at,
     m.service_id,
+    m.refresh_token_generation,
     s.name as service_name,
     s.description as service_description,
     s.jwt_audience as service_jwt_audience,
@@ -50,8 +51,63 @@ UPDATE m2m_sessions
 SET last_authenticated_at = NOW()
 WHERE id = $1;
 
--- name: RotateM2MSessionRefreshToken :exec
+-- name: RotateM2MSessionRefreshToken :one
+WITH previous AS (
+    INSERT INTO m2m_session_refresh_tokens (session_id, generation, token_hash)
+    SELECT m.id, m.refresh_token_generation, m.refresh_token
+    FROM m2m_sessions m
+    WHERE m.id = $2
+      AND m.refresh_token_generation = $4
+    ON CONFLICT (session_id, generation) DO NOTHING
+)
 UPDATE m2m_sessions
 SET refresh_token = $1,
-    expires_at = $3
-WHERE id = $2;
+    expires_at = $3,
+    refresh_token_generation = refresh_token_generation + 1
+WHERE id = $2
+  AND refresh_token_generation = $4
+RETURNING refresh_token_generation;
+
+-- name: GetM2MSessionPreviousRefreshToken :one
+SELECT token_hash, rotated_at FROM m2m_session_refresh_tokens
+WHERE session_id = $1 AND generation = $2;
+
+-- name: DeleteM2MSession :exec
+DELETE FROM m2m_sessions
+WHERE id = $1;
+
+-- name: CreateM2MClient :exec
+INSERT INTO m2m_clients (id, service_id, subject_id, template_id, secret_hash)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetM2MClientAndService :one
+SELECT 
+    c.id,
+    c.subject_id,
+    c.template_id,
+    c.secret_hash,
+    c.service_id,
+    t.roles,
+    s.name as service_name,
+    s.description as service_description,
+    s.jwt_audience as service_jwt_audience,
+    s.modified_at as service_modified_at,
+    s.created_at as service_created_at
+FROM m2m_clients c
+JOIN m2m_session_templates t ON t.id = c.template_id AND t.service_id = c.service_id
+JOIN services s ON s.id = c.service_id
+WHERE c.id = $1;
+
+-- name: GetM2MClients :many
+SELECT * FROM m2m_clients
+WHERE service_id = $1
+ORDER BY created_at ASC;
+
+-- name: DeleteM2MClient :exec
+DELETE FROM m2m_clients
+WHERE id = $1;
+
+-- name: UpdateM2MClientLastUsedAt :exec
+UPDATE m2m_clients
+SET last_used_at = NOW()
+WHERE id = $1;
@@ -25,3 +25,18 @@ SET
     contact_name = COALESCE($7, contact_name),
     contact_email = COALESCE($8, contact_email)
 WHERE id = $1;
+
+-- name: UpdateServiceJWKPolicy :exec
+UPDATE services
+SET
+    jwk_rotation_interval = $2,
+    jwk_retirement_period = $3,
+    modified_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateServiceJWKAlgorithm :exec
+UPDATE services
+SET
+    jwk_algorithm = $2,
+    modified_at = NOW()
+WHERE id = $1;
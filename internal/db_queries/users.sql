@@ -30,9 +30,13 @@ VALUES ($1, $2, $3)
 ON CONFLICT (uid) DO UPDATE
 SET encoded_server = EXCLUDED.encoded_server, expires_at = EXCLUDED.expires_at;
 
--- name: CreateUserSession :exec
+-- name: CreateUserSession :execrows
+-- inserts nothing for a disabled user, the share lock makes DisableUser wait for the session to be committed
 INSERT INTO user_sessions (id, user_id, service_id, refresh_token_hash, expires_at)
-VALUES ($1, $2, $3, $4, $5);
+SELECT sqlc.arg(id)::text, u.id, sqlc.arg(service_id)::uuid, sqlc.narg(refresh_token_hash)::text, sqlc.arg(expires_at)::timestamptz
+FROM users u
+WHERE u.id = sqlc.arg(user_id) AND u.disabled IS NOT TRUE
+FOR SHARE OF u;
 
 -- name: UpdateUserLastSignInDate :exec
 UPDATE users
@@ -48,14 +52,35 @@ UPDATE user_sessions
 SET last_authenticated_at = NOW()
 WHERE id = $1;
 
--- name: RotateUserSessionRefreshToken :exec
+-- name: UpdateUserSessionReauthenticatedAt :execrows
 UPDATE user_sessions
-SET refresh_token_hash = $1
-WHERE id = $2;
+SET reauthenticated_at = NOW()
+WHERE id = $1 AND user_id = $2;
 
--- name: GetUserRoles :one
-SELECT roles FROM users
-WHERE id = $1;
+-- name: RotateUserSessionRefreshToken :one
+WITH previous AS (
+    INSERT INTO user_session_refresh_tokens (session_id, generation, token_hash)
+    SELECT us.id, us.refresh_token_generation, us.refresh_token_hash
+    FROM user_sessions AS us
+    WHERE us.id = $2
+      AND us.refresh_token_generation = $3
+      AND us.refresh_token_hash IS NOT NULL
+    ON CONFLICT (session_id, generation) DO NOTHING
+)
+UPDATE user_sessions
+SET refresh_token_hash = $1,
+    refresh_token_generation = refresh_token_generation + 1
+WHERE id = $2
+  AND refresh_token_generation = $3
+RETURNING refresh_token_generation;
+
+-- name: GetUserSessionPreviousRefreshToken :one
+SELECT token_hash, rotated_at FROM user_session_refresh_tokens
+WHERE session_id = $1 AND generation = $2;
+
+-- name: GetUserServiceRoles :one
+SELECT roles FROM user_service_roles
+WHERE user_id = $1 AND service_id = $2;
 
 -- name: GetUser :one
 SELECT id, username, last_login_at FROM users
@@ -69,9 +94,26 @@ VALUES ($1, $2, $3);
 DELETE FROM user_token_code_exchange AS token
 WHERE token.hashed_code = $1
   AND token.expires_at > NOW()
+  AND token.code_challenge IS NULL
 RETURNING
   token.session_id;
 
+-- name: InsertAuthorizationCode :exec
+INSERT INTO user_token_code_exchange (session_id, expires_at, hashed_code, code_challenge, redirect_uri, nonce, auth_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: UseAuthorizationCode :one
+DELETE FROM user_token_code_exchange AS token
+WHERE token.hashed_code = $1
+  AND token.expires_at > NOW()
+  AND token.code_challenge IS NOT NULL
+RETURNING
+  token.session_id,
+  token.code_challenge,
+  token.redirect_uri,
+  token.nonce,
+  token.auth_time;
+
 -- name: GetAccessTokenDurationUsingSessionId :one
 SELECT svc.access_token_duration
 FROM services AS svc
@@ -81,3 +123,312 @@ WHERE us.id = $1;
 -- name: DeleteUserSession :exec
 DELETE FROM user_sessions
 WHERE id = $1 AND user_id = $2;
+
+-- name: UpsertUserTOTP :execrows
+INSERT INTO user_totp (user_id, encrypted_secret, nonce, kek_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE
+SET encrypted_secret = EXCLUDED.encrypted_secret,
+    nonce = EXCLUDED.nonce,
+    kek_id = EXCLUDED.kek_id,
+    last_used_step = 0,
+    created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: CheckUserTOTPEnabled :one
+SELECT EXISTS (
+    SELECT 1 FROM user_totp
+    WHERE user_id = $1 AND confirmed_at IS NOT NULL
+) AS enabled;
+
+-- name: ConfirmUserTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1
+  AND confirmed_at IS NOT NULL
+  AND last_used_step < $2;
+
+-- name: DeleteUserTOTP :execrows
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: LockUserTOTPInserts :exec
+LOCK TABLE user_totp IN SHARE ROW EXCLUSIVE MODE;
+
+-- name: GetAllUserTOTP :many
+SELECT user_id, encrypted_secret, nonce, kek_id FROM user_totp
+ORDER BY user_id
+FOR UPDATE;
+
+-- name: RewrapUserTOTP :execrows
+UPDATE user_totp AS t
+SET
+    encrypted_secret = rewrapped.encrypted_secret,
+    nonce = rewrapped.nonce,
+    kek_id = sqlc.arg(kek_id)::text
+FROM unnest(
+    sqlc.arg(user_ids)::text[],
+    sqlc.arg(encrypted_secrets)::bytea[],
+    sqlc.arg(nonces)::bytea[]
+) AS rewrapped(user_id, encrypted_secret, nonce)
+WHERE t.user_id = rewrapped.user_id;
+
+-- name: CreateMFAChallenge :exec
+INSERT INTO user_mfa_challenges (hashed_token, user_id, service_id, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: AttemptMFAChallenge :one
+UPDATE user_mfa_challenges
+SET attempts = attempts + 1
+WHERE hashed_token = $1
+  AND expires_at > NOW()
+  AND attempts < $2
+RETURNING user_id, service_id;
+
+-- name: DeleteMFAChallenge :execrows
+DELETE FROM user_mfa_challenges
+WHERE hashed_token = $1;
+
+-- name: DeleteUserMFAChallenges :exec
+DELETE FROM user_mfa_challenges
+WHERE user_id = $1;
+
+-- name: GetMFAChallenge :one
+SELECT user_id, service_id FROM user_mfa_challenges
+WHERE hashed_token = $1
+  AND expires_at > NOW()
+  AND attempts < $2;
+
+-- name: CreateWebAuthnChallenge :exec
+INSERT INTO user_webauthn_challenges (hashed_challenge, ceremony, user_id, service_id, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: UseWebAuthnChallenge :one
+DELETE FROM user_webauthn_challenges
+WHERE hashed_challenge = $1
+  AND ceremony = $2
+  AND expires_at > NOW()
+RETURNING user_id, service_id;
+
+-- name: CreateWebAuthnCredential :exec
+INSERT INTO user_webauthn_credentials (id, user_id, name, public_key, sign_count, transports)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetWebAuthnCredential :one
+SELECT * FROM user_webauthn_credentials
+WHERE id = $1;
+
+-- name: GetUserWebAuthnCredentials :many
+SELECT * FROM user_webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CheckUserHasWebAuthnCredentials :one
+SELECT EXISTS (
+    SELECT 1 FROM user_webauthn_credentials
+    WHERE user_id = $1
+) AS has_credentials;
+
+-- name: UpdateWebAuthnCredentialSignCount :execrows
+UPDATE user_webauthn_credentials
+SET sign_count = $2, last_used_at = NOW()
+WHERE id = $1
+  AND (sign_count < $2 OR $2 = 0);
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM user_webauthn_credentials
+WHERE id = $1 AND user_id = $2;
+
+-- name: ReplaceRecoveryCodes :exec
+WITH deleted AS (
+    DELETE FROM user_recovery_codes
+    WHERE user_id = sqlc.arg(user_id)
+)
+INSERT INTO user_recovery_codes (user_id, code_hash)
+SELECT sqlc.arg(user_id), unnest(sqlc.arg(code_hashes)::text[]);
+
+-- name: GetUnusedRecoveryCodes :many
+SELECT code_hash FROM user_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM user_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UseRecoveryCode :execrows
+UPDATE user_recovery_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL;
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM user_recovery_codes
+WHERE user_id = $1;
+
+-- name: UpdateUserVerifier :execrows
+UPDATE users
+SET encoded_verifier = $2
+WHERE id = $1;
+
+-- name: DeleteOtherUserSessions :execrows
+WITH exchanges AS (
+    DELETE FROM user_token_code_exchange
+    WHERE session_id IN (
+        SELECT id FROM user_sessions
+        WHERE user_id = $1 AND id <> $2
+    )
+)
+DELETE FROM user_sessions
+WHERE user_id = $1 AND id <> $2;
+
+-- name: CreateUserInvitation :exec
+INSERT INTO user_invitations (id, hashed_token, roles, services, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetUserInvitations :many
+SELECT ui.id, ui.roles, ui.services, ui.expires_at, ui.created_at, ui.used_at, u.username AS used_by
+FROM user_invitations AS ui
+LEFT JOIN users AS u ON u.id = ui.used_by
+ORDER BY ui.created_at DESC;
+
+-- name: DeleteUnusedUserInvitation :execrows
+DELETE FROM user_invitations
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: CreateInvitedUser :one
+WITH invitation AS (
+    UPDATE user_invitations
+    SET used_at = NOW(), used_by = sqlc.arg(id)
+    WHERE hashed_token = sqlc.arg(hashed_token)
+      AND used_at IS NULL
+      AND expires_at > NOW()
+      -- the services must still be limited to their allowlists, see CreateInvitation
+      AND NOT EXISTS (
+          SELECT 1 FROM unnest(services) AS invited(service_id)
+          WHERE NOT EXISTS (
+              SELECT 1 FROM service_access_policies AS sap
+              WHERE sap.service_id = invited.service_id AND sap.mode = 'allowlist'
+          )
+      )
+    RETURNING roles, services
+), created AS (
+    INSERT INTO users (id, username, hashed_username, encoded_verifier)
+    SELECT sqlc.arg(id), sqlc.arg(username), sqlc.arg(hashed_username), sqlc.arg(encoded_verifier)
+    FROM invitation
+    RETURNING id
+), allowlisted AS (
+    INSERT INTO service_allowed_users (service_id, user_id)
+    SELECT unnest(invitation.services), created.id
+    FROM created, invitation
+), service_roles AS (
+    INSERT INTO user_service_roles (user_id, service_id, roles)
+    SELECT created.id, unnest(invitation.services), invitation.roles
+    FROM created, invitation
+    WHERE cardinality(invitation.roles) > 0
+)
+SELECT id FROM created;
+
+-- name: GetUserDisabled :one
+SELECT disabled FROM users
+WHERE id = $1;
+
+-- name: LockUser :exec
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE;
+
+-- name: DisableUser :execrows
+WITH exchanges AS (
+    DELETE FROM user_token_code_exchange
+    WHERE session_id IN (
+        SELECT id FROM user_sessions
+        WHERE user_id = $1
+    )
+), sessions AS (
+    DELETE FROM user_sessions
+    WHERE user_id = $1
+), challenges AS (
+    DELETE FROM user_mfa_challenges
+    WHERE user_id = $1
+)
+UPDATE users
+SET disabled = true
+WHERE id = $1;
+
+-- name: EnableUser :execrows
+UPDATE users
+SET disabled = false
+WHERE id = $1;
+
+-- name: AddUserServiceRoles :one
+INSERT INTO user_service_roles (user_id, service_id, roles)
+VALUES (sqlc.arg(user_id), sqlc.arg(service_id), ARRAY(
+    SELECT DISTINCT role
+    FROM unnest(sqlc.arg(roles)::text[]) AS role
+    ORDER BY role
+))
+ON CONFLICT (user_id, service_id) DO UPDATE
+SET roles = ARRAY(
+    SELECT DISTINCT role
+    FROM unnest(user_service_roles.roles || EXCLUDED.roles) AS role
+    ORDER BY role
+)
+RETURNING roles;
+
+-- name: RemoveUserServiceRoles :one
+UPDATE user_service_roles
+SET roles = ARRAY(
+    SELECT role
+    FROM unnest(roles) AS role
+    WHERE role <> ALL(sqlc.arg(roles)::text[])
+    ORDER BY role
+)
+WHERE user_id = sqlc.arg(user_id) AND service_id = sqlc.arg(service_id)
+RETURNING roles;
+
+-- name: GetUserRolesByService :many
+SELECT usr.service_id, s.name AS service_name, usr.roles
+FROM user_service_roles AS usr
+JOIN services AS s ON s.id = usr.service_id
+WHERE usr.user_id = $1 AND cardinality(usr.roles) > 0
+ORDER BY s.name;
+
+-- name: GetServiceAccessPolicy :one
+SELECT mode, required_roles FROM service_access_policies
+WHERE service_id = $1;
+
+-- name: SetServiceAccessPolicy :exec
+INSERT INTO service_access_policies (service_id, mode, required_roles)
+VALUES ($1, $2, $3)
+ON CONFLICT (service_id) DO UPDATE
+SET mode = EXCLUDED.mode, required_roles = EXCLUDED.required_roles, modified_at = NOW();
+
+-- name: GetServiceAllowedUsers :many
+SELECT u.username
+FROM service_allowed_users AS sau
+JOIN users AS u ON u.id = sau.user_id
+WHERE sau.service_id = $1
+ORDER BY u.username;
+
+-- name: IsUserAllowedInService :one
+SELECT EXISTS (
+    SELECT 1 FROM service_allowed_users
+    WHERE service_id = $1 AND user_id = $2
+);
+
+-- name: AddServiceAllowedUser :exec
+INSERT INTO service_allowed_users (service_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (service_id, user_id) DO NOTHING;
+
+-- name: RemoveServiceAllowedUser :execrows
+DELETE FROM service_allowed_users
+WHERE service_id = $1 AND user_id = $2;
@@ -0,0 +1,116 @@
+package endpoints
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/constants"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/services"
+	"github.com/kymppi/kuura/internal/users"
+)
+
+type openIDConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	M2MTokenEndpoint                 string   `json:"m2m_token_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	IntrospectionEndpointAuthMethods []string `json:"introspection_endpoint_auth_methods_supported"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	RevocationEndpoint               string   `json:"revocation_endpoint"`
+	RevocationEndpointAuthMethods    []string `json:"revocation_endpoint_auth_methods_supported"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethods         []string `json:"token_endpoint_auth_methods_supported"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+	ServiceId                        string   `json:"service_id"`
+	Audience                         string   `json:"audience"`
+}
+
+// V1_OpenIDConfiguration serves the discovery document of the internal Kuura service
+func V1_OpenIDConfiguration(logger *slog.Logger, serviceManager *services.ServiceManager, publicKuuraDomain string, jwtIssuer string) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			service, err := serviceManager.GetInternalKuuraService(r.Context())
+			if err != nil {
+				handleErr(w, r, logger, err)
+				return
+			}
+
+			w.Header().Set("Cache-Control", "max-age=3600")
+			safeEncode(w, r, logger, http.StatusOK, buildOpenIDConfiguration(service, publicKuuraDomain, jwtIssuer))
+		},
+	)
+}
+
+// V1_ServiceOpenIDConfiguration serves the discovery document of the service in the path
+func V1_ServiceOpenIDConfiguration(logger *slog.Logger, serviceManager *services.ServiceManager, publicKuuraDomain string, jwtIssuer string) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			service, err := resolvePathService(r, serviceManager)
+			if err != nil {
+				handleErr(w, r, logger, err)
+				return
+			}
+
+			w.Header().Set("Cache-Control", "max-age=3600")
+			safeEncode(w, r, logger, http.StatusOK, buildOpenIDConfiguration(service, publicKuuraDomain, jwtIssuer))
+		},
+	)
+}
+
+func buildOpenIDConfiguration(service *models.AppService, publicKuuraDomain string, jwtIssuer string) openIDConfiguration {
+	return openIDConfiguration{
+		Issuer:                           jwtIssuer,
+		JWKSURI:                          publicURL(publicKuuraDomain, serviceRoute(constants.SERVICE_JWKS_PATH, service.Id)),
+		AuthorizationEndpoint:            publicURL(publicKuuraDomain, constants.OAUTH2_AUTHORIZE_PATH),
+		TokenEndpoint:                    publicURL(publicKuuraDomain, constants.OAUTH2_TOKEN_PATH),
+		M2MTokenEndpoint:                 publicURL(publicKuuraDomain, constants.M2M_ACCESS_PATH),
+		IntrospectionEndpoint:            publicURL(publicKuuraDomain, constants.OAUTH2_INTROSPECT_PATH),
+		IntrospectionEndpointAuthMethods: []string{"client_secret_basic", "client_secret_post"},
+		UserInfoEndpoint:                 publicURL(publicKuuraDomain, constants.OAUTH2_USERINFO_PATH),
+		RevocationEndpoint:               publicURL(publicKuuraDomain, constants.OAUTH2_REVOKE_PATH),
+		RevocationEndpointAuthMethods:    []string{"none"},
+		GrantTypesSupported:              []string{"authorization_code", "refresh_token", "client_credentials"},
+		TokenEndpointAuthMethods:         []string{"none", "client_secret_basic", "client_secret_post"},
+		ResponseTypesSupported:           []string{"code"},
+		ScopesSupported:                  []string{"openid", "profile"},
+		CodeChallengeMethodsSupported:    []string{users.CodeChallengeMethodS256},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{service.JWKAlgorithm},
+		ClaimsSupported: []string{
+			"iss",
+			"sub",
+			"aud",
+			"exp",
+			"iat",
+			"session_id",
+			"roles",
+			"client_type",
+			"service_id",
+			"nonce",
+			"auth_time",
+			"azp",
+			"preferred_username",
+		},
+		ServiceId: service.Id.String(),
+		Audience:  service.JWTAudience,
+	}
+}
+
+func publicURL(publicKuuraDomain string, path string) string {
+	return fmt.Sprintf("https://%s%s", publicKuuraDomain, path)
+}
+
+func serviceRoute(path string, serviceId uuid.UUID) string {
+	return strings.Replace(path, "{serviceId}", serviceId.String(), 1)
+}
@@ -0,0 +1,108 @@
+package endpoints
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/m2m"
+	"github.com/kymppi/kuura/internal/users"
+)
+
+// RFC 7662 section 2.2, inactive tokens only carry "active": false
+type introspectionResponse struct {
+	Active     bool     `json:"active"`
+	Subject    string   `json:"sub,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	ClientType string   `json:"client_type,omitempty"`
+	ServiceId  string   `json:"service_id,omitempty"`
+	Expiration int64    `json:"exp,omitempty"`
+	SessionId  string   `json:"session_id,omitempty"`
+	ClientId   string   `json:"client_id,omitempty"`
+	TokenType  string   `json:"token_type,omitempty"`
+}
+
+// V1_OAuth2_Introspect lets an M2M client of a service check tokens issued for the same service
+func V1_OAuth2_Introspect(logger *slog.Logger, userService *users.UserService, m2mService *m2m.M2MService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		if err := r.ParseForm(); err != nil {
+			handleOAuthErr(w, r, logger, errs.New(errcode.InvalidRequest, err))
+			return
+		}
+
+		ctx := r.Context()
+
+		clientId, clientSecret, err := clientCredentialsFromRequest(r)
+		if err != nil {
+			handleOAuthErr(w, r, logger, err)
+			return
+		}
+
+		caller, err := m2mService.AuthenticateClient(ctx, clientId, clientSecret)
+		if err != nil {
+			handleOAuthErr(w, r, logger, err)
+			return
+		}
+
+		if problem := requireFormValues(r, "token"); problem != nil {
+			handleOAuthErr(w, r, logger, problem)
+			return
+		}
+
+		// token_type_hint is optional and only access tokens can be introspected, so it is ignored
+		client, err := authenticateToken(ctx, r.PostForm.Get("token"), jwkManager, jwtIssuer)
+		if err != nil || client.ServiceId != caller.ServiceId.String() {
+			safeEncode(w, r, logger, http.StatusOK, introspectionResponse{Active: false})
+			return
+		}
+
+		active, err := backingSessionActive(ctx, client, userService, m2mService)
+		if err != nil {
+			handleOAuthErr(w, r, logger, err)
+			return
+		}
+
+		if !active {
+			safeEncode(w, r, logger, http.StatusOK, introspectionResponse{Active: false})
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, introspectionResponse{
+			Active:     true,
+			Subject:    client.Id,
+			Roles:      client.Roles,
+			ClientType: client.ClientType,
+			ServiceId:  client.ServiceId,
+			Expiration: client.TokenExpiresAt.Unix(),
+			SessionId:  client.SessionId,
+			ClientId:   client.ClientId,
+			TokenType:  "Bearer",
+		})
+	}
+}
+
+// a valid signature is not enough, the session (or M2M client) the token was issued for must still exist
+func backingSessionActive(ctx context.Context, client *Client, userService *users.UserService, m2mService *m2m.M2MService) (bool, error) {
+	switch client.ClientType {
+	case "user":
+		if client.SessionId == "" {
+			return false, nil
+		}
+		return userService.SessionActive(ctx, client.SessionId, client.Id)
+	case "machine":
+		if client.SessionId != "" {
+			return m2mService.SessionActive(ctx, client.SessionId)
+		}
+		if client.ClientId != "" {
+			return m2mService.ClientExists(ctx, client.ClientId)
+		}
+		return false, nil
+	default:
+		return false, nil
+	}
+}
@@ -1,35 +1,83 @@
 package endpoints
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/google/uuid"
-	"github.com/kymppi/kuura/internal/errcode"
-	"github.com/kymppi/kuura/internal/errs"
 	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/services"
 )
 
-func V1JwksHandler(logger *slog.Logger, jwkManager *jwks.JWKManager) http.Handler {
+// V1JwksHandler supports conditional requests so verifiers can poll cheaply,
+// max-age is shortened while the service's future key is about to be promoted.
+// The ETag and the body come from the same cached read of the key set.
+func V1JwksHandler(logger *slog.Logger, jwkManager *jwks.JWKManager, serviceManager *services.ServiceManager) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Cache-Control", "max-age=600")
-
 			ctx := r.Context()
 
-			serviceId, err := uuid.Parse(r.PathValue("serviceId"))
+			service, err := resolvePathService(r, serviceManager)
 			if err != nil {
-				handleErr(w, r, logger, errs.New(errcode.InvalidServiceId, err))
+				handleErr(w, r, logger, err)
 				return
 			}
 
-			keys, err := jwkManager.GetJWKS(ctx, serviceId)
+			keys, states, err := jwkManager.GetPublishedKeySet(ctx, service.Id)
 			if err != nil {
 				handleErr(w, r, logger, err)
 				return
 			}
 
+			etag := jwks.KeySetETag(states)
+			maxAge := jwks.KeySetMaxAge(states, service.JWKRotationInterval, time.Now())
+
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+			w.Header().Set("ETag", etag)
+			if lastModified := jwks.KeySetLastModified(states); !lastModified.IsZero() {
+				w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+			}
+
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
 			safeEncode(w, r, logger, http.StatusOK, keys)
 		},
 	)
 }
+
+// RFC 9110 section 13.1.2, If-None-Match uses weak comparison
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func V1JwksCacheStats(logger *slog.Logger, jwkManager *jwks.JWKManager) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			stats, enabled := jwkManager.CacheStats()
+
+			safeEncode(w, r, logger, http.StatusOK, struct {
+				Enabled bool `json:"enabled"`
+				jwks.CacheStats
+			}{
+				Enabled:    enabled,
+				CacheStats: stats,
+			})
+		},
+	)
+}
@@ -104,3 +104,55 @@ func V1M2MRefreshAccessToken(logger *slog.Logger, m2mService *m2m.M2MService) ht
 		})
 	}
 }
+
+type v1CreateM2MClientRequest struct {
+	SubjectId string `json:"subject_id"`
+	Template  string `json:"template"`
+	ServiceId string `json:"service_id"`
+}
+
+func (r *v1CreateM2MClientRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.SubjectId == "" {
+		problems["subject_id"] = "'subject_id' cannot be empty"
+	}
+	if r.Template == "" {
+		problems["template"] = "'template' cannot be empty"
+	}
+	if r.ServiceId == "" {
+		problems["service_id"] = "'service_id' cannot be empty"
+	} else {
+		if _, err := uuid.Parse(r.ServiceId); err != nil {
+			problems["service_id"] = "'service_id' must be a valid UUID"
+		}
+	}
+
+	return problems
+}
+
+func V1CreateM2MClient(logger *slog.Logger, m2mService *m2m.M2MService) http.HandlerFunc {
+	type response struct {
+		ClientId     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := decodeValid[*v1CreateM2MClientRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		clientId, clientSecret, err := m2mService.CreateClient(r.Context(), uuid.MustParse(data.ServiceId), data.SubjectId, data.Template)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusCreated, response{
+			ClientId:     clientId,
+			ClientSecret: clientSecret,
+		})
+	}
+}
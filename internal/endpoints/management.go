@@ -0,0 +1,49 @@
+package endpoints
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+)
+
+// ManagementAuth requires the base64 encoded MANAGEMENT_TOKEN as a bearer token, every request is rejected when token is nil
+func ManagementAuth(logger *slog.Logger, token []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkManagementToken(r, token); err != nil {
+			logger.Warn("Rejected management request",
+				slog.String("security_event", "management_auth_failed"),
+				slog.String("path", r.URL.Path),
+				slog.String("ip", r.RemoteAddr),
+			)
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kuura-management"`)
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func checkManagementToken(r *http.Request, token []byte) error {
+	if token == nil {
+		return errs.New(errcode.Unauthorized, errors.New("MANAGEMENT_TOKEN is not configured"))
+	}
+
+	value, ok := bearerToken(r)
+	if !ok {
+		return errs.New(errcode.Unauthorized, errors.New("missing bearer token"))
+	}
+
+	presented, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || subtle.ConstantTimeCompare(presented, token) != 1 {
+		return errs.New(errcode.Unauthorized, errors.New("invalid management token"))
+	}
+
+	return nil
+}
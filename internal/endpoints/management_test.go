@@ -0,0 +1,43 @@
+package endpoints
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckManagementToken(t *testing.T) {
+	token := []byte("0123456789abcdef0123456789abcdef")
+
+	tests := []struct {
+		name          string
+		configured    []byte
+		authorization string
+		valid         bool
+	}{
+		{"Valid", token, "Bearer " + base64.StdEncoding.EncodeToString(token), true},
+		{"Scheme is case insensitive", token, "bearer " + base64.StdEncoding.EncodeToString(token), true},
+		{"Missing", token, "", false},
+		{"Raw token", token, "Bearer " + string(token), false},
+		{"Wrong token", token, "Bearer " + base64.StdEncoding.EncodeToString([]byte("wrong")), false},
+		{"Not configured", nil, "Bearer " + base64.StdEncoding.EncodeToString(token), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/users/test/roles", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			err := checkManagementToken(r, tt.configured)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package endpoints
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/users"
+)
+
+type mfaTOTPRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (r *mfaTOTPRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.MFAToken == "" {
+		problems["mfa_token"] = "'mfa_token' cannot be empty"
+	}
+	if r.Code == "" {
+		problems["code"] = "'code' cannot be empty"
+	}
+
+	return problems
+}
+
+// V1_MFA_TOTP finishes a login that V1_SRP_ClientVerify left waiting for a second factor
+func V1_MFA_TOTP(logger *slog.Logger, userService *users.UserService, publicKuuraDomain string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		payload, err := decodeValid[*mfaTOTPRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		uid, serviceId, err := userService.CompleteMFAChallengeTOTP(ctx, payload.MFAToken, payload.Code)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := startInternalSession(ctx, w, userService, uid, serviceId, publicKuuraDomain); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, map[string]any{
+			"success": true,
+		})
+	}
+}
+
+// V1_User_TOTPEnroll requires the session to have been reauthenticated recently, see V1_User_ReauthSRP
+func V1_User_TOTPEnroll(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+		QRCode string `json:"qr_code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.RequireReauthentication(r.Context(), client.Id, client.SessionId); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		enrollment, err := userService.BeginTOTPEnrollment(r.Context(), client.Id)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			Secret: enrollment.Secret,
+			URI:    enrollment.URI,
+			QRCode: enrollment.QRCode,
+		})
+	}
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (r *totpCodeRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.Code == "" {
+		problems["code"] = "'code' cannot be empty"
+	}
+
+	return problems
+}
+
+// V1_User_TOTPConfirm requires the session to have been reauthenticated recently, see V1_User_ReauthSRP
+func V1_User_TOTPConfirm(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		Success       bool     `json:"success"`
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.RequireReauthentication(r.Context(), client.Id, client.SessionId); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		payload, err := decodeValid[*totpCodeRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		recoveryCodes, err := userService.ConfirmTOTPEnrollment(r.Context(), client.Id, payload.Code)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if recoveryCodes != nil {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			Success:       true,
+			RecoveryCodes: recoveryCodes,
+		})
+	}
+}
+
+func V1_User_TOTPDisable(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		payload, err := decodeValid[*totpCodeRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.DisableTOTP(r.Context(), client.Id, payload.Code); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, map[string]any{
+			"success": true,
+		})
+	}
+}
+
+type mfaRecoveryCodeRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (r *mfaRecoveryCodeRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.MFAToken == "" {
+		problems["mfa_token"] = "'mfa_token' cannot be empty"
+	}
+	if r.Code == "" {
+		problems["code"] = "'code' cannot be empty"
+	}
+
+	return problems
+}
+
+// V1_MFA_RecoveryCode finishes a pending login with a recovery code instead of the second factor
+func V1_MFA_RecoveryCode(logger *slog.Logger, userService *users.UserService, publicKuuraDomain string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		payload, err := decodeValid[*mfaRecoveryCodeRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		uid, serviceId, err := userService.CompleteMFAChallengeRecoveryCode(ctx, payload.MFAToken, payload.Code)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := startInternalSession(ctx, w, userService, uid, serviceId, publicKuuraDomain); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, map[string]any{
+			"success": true,
+		})
+	}
+}
+
+// V1_User_RecoveryCodesRegenerate requires the session to have been reauthenticated recently, see V1_User_ReauthSRP
+func V1_User_RecoveryCodesRegenerate(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.RequireReauthentication(r.Context(), client.Id, client.SessionId); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		recoveryCodes, err := userService.RegenerateRecoveryCodes(r.Context(), client.Id)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			RecoveryCodes: recoveryCodes,
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/constants"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/m2m"
+	"github.com/kymppi/kuura/internal/services"
+	"github.com/kymppi/kuura/internal/users"
+)
+
+// RFC 6749 section 5.2 error codes
+var oauthErrorNames = map[errcode.ErrorCode]string{
+	errcode.InvalidArgumentError: "invalid_request",
+	errcode.InvalidRequest:       "invalid_request",
+	errcode.InvalidServiceId:     "invalid_request",
+	errcode.InvalidRedirectURI:   "invalid_request",
+	errcode.InvalidClient:        "invalid_client",
+	errcode.InvalidGrant:         "invalid_grant",
+	errcode.UnsupportedGrantType: "unsupported_grant_type",
+}
+
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	TraceID          string `json:"trace_id,omitempty"`
+}
+
+// like handleErr but the body follows RFC 6749 so standard OAuth2 clients can parse it
+func handleOAuthErr(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error) {
+	traceId := traceIdFromRequest(r)
+
+	var customErr *errs.Error
+	if errors.As(err, &customErr) {
+		if name, ok := oauthErrorNames[customErr.Code]; ok {
+			logger.Warn("OAuth2 request rejected",
+				slog.String("error", customErr.Error()),
+				slog.String("code", string(customErr.Code)),
+				slog.String("trace_id", traceId),
+			)
+
+			errorDetail := errcode.GetErrorDetail(customErr.Code)
+
+			if errorDetail.StatusCode == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Basic realm="kuura"`)
+			}
+
+			safeEncode(w, r, logger, errorDetail.StatusCode, oauthErrorResponse{
+				Error:            name,
+				ErrorDescription: errorDetail.Description,
+				TraceID:          traceId,
+			})
+			return
+		}
+	}
+
+	logger.Error("An error occurred during an OAuth2 request",
+		slog.String("error", err.Error()),
+		slog.String("trace_id", traceId),
+	)
+
+	safeEncode(w, r, logger, http.StatusInternalServerError, oauthErrorResponse{
+		Error:   "server_error",
+		TraceID: traceId,
+	})
+}
+
+// redirects the user agent back to the client with an RFC 6749 section 4.1.2.1 error
+func redirectOAuthErr(w http.ResponseWriter, r *http.Request, redirectUri string, name string, description string, state string) {
+	params := url.Values{}
+	params.Set("error", name)
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	http.Redirect(w, r, appendQuery(redirectUri, params), http.StatusFound)
+}
+
+func appendQuery(rawUrl string, params url.Values) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func V1_OAuth2_Authorize(logger *slog.Logger, userService *users.UserService, serviceManager *services.ServiceManager, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := r.URL.Query()
+
+		// errors before the redirect_uri is validated must not redirect (RFC 6749 section 4.1.2.1)
+		clientId, err := uuid.Parse(query.Get("client_id"))
+		if err != nil {
+			handleErr(w, r, logger, errs.New(errcode.InvalidServiceId, err))
+			return
+		}
+
+		service, err := serviceManager.GetService(ctx, clientId)
+		if err != nil {
+			handleErr(w, r, logger, errs.New(errcode.ServiceNotFound, err))
+			return
+		}
+
+		redirectUri := query.Get("redirect_uri")
+		if redirectUri == "" {
+			redirectUri = service.LoginRedirect
+		}
+		if redirectUri != service.LoginRedirect {
+			handleErr(w, r, logger, errs.New(errcode.InvalidRedirectURI, fmt.Errorf("redirect_uri '%s' is not registered", redirectUri)))
+			return
+		}
+
+		state := query.Get("state")
+
+		if query.Get("response_type") != "code" {
+			redirectOAuthErr(w, r, redirectUri, "unsupported_response_type", "only response_type=code is supported", state)
+			return
+		}
+
+		codeChallenge := query.Get("code_challenge")
+		if codeChallenge == "" {
+			redirectOAuthErr(w, r, redirectUri, "invalid_request", "code_challenge is required", state)
+			return
+		}
+		if query.Get("code_challenge_method") != users.CodeChallengeMethodS256 {
+			redirectOAuthErr(w, r, redirectUri, "invalid_request", "code_challenge_method must be S256", state)
+			return
+		}
+
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			// the login page sends the user back here after a successful login
+			loginUrl := fmt.Sprintf("%s?return_to=%s", constants.LOGIN_PATH, url.QueryEscape(r.URL.RequestURI()))
+			http.Redirect(w, r, loginUrl, http.StatusFound)
+			return
+		}
+
+		code, err := userService.CreateAuthorizationCode(ctx, client.Id, clientId, redirectUri, codeChallenge, query.Get("nonce"))
+		if err != nil {
+			logger.Error("Failed to create authorization code", slog.String("error", err.Error()))
+			redirectOAuthErr(w, r, redirectUri, "server_error", "", state)
+			return
+		}
+
+		params := url.Values{}
+		params.Set("code", code)
+		if state != "" {
+			params.Set("state", state)
+		}
+
+		http.Redirect(w, r, appendQuery(redirectUri, params), http.StatusFound)
+	}
+}
+
+func V1_OAuth2_Token(logger *slog.Logger, userService *users.UserService, m2mService *m2m.M2MService) http.HandlerFunc {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		SessionId    string `json:"session_id,omitempty"`
+		IDToken      string `json:"id_token,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+
+		if err := r.ParseForm(); err != nil {
+			handleOAuthErr(w, r, logger, errs.New(errcode.InvalidRequest, err))
+			return
+		}
+
+		ctx := r.Context()
+
+		var tokenInfo *users.TokenInfo
+
+		switch grantType := r.PostForm.Get("grant_type"); grantType {
+		case "authorization_code":
+			if problem := requireFormValues(r, "code", "redirect_uri", "client_id", "code_verifier"); problem != nil {
+				handleOAuthErr(w, r, logger, problem)
+				return
+			}
+
+			clientId, err := uuid.Parse(r.PostForm.Get("client_id"))
+			if err != nil {
+				handleOAuthErr(w, r, logger, errs.New(errcode.InvalidClient, err))
+				return
+			}
+
+			info, err := userService.ExchangeAuthorizationCode(
+				ctx,
+				r.PostForm.Get("code"),
+				clientId,
+				r.PostForm.Get("redirect_uri"),
+				r.PostForm.Get("code_verifier"),
+			)
+			if err != nil {
+				handleOAuthErr(w, r, logger, err)
+				return
+			}
+
+			tokenInfo = info
+		case "refresh_token":
+			// kuura refresh tokens are bound to a session, so the session_id extension parameter is required
+			if problem := requireFormValues(r, "refresh_token", "session_id"); problem != nil {
+				handleOAuthErr(w, r, logger, problem)
+				return
+			}
+
+			info, err := userService.CreateAccessToken(ctx, r.PostForm.Get("session_id"), r.PostForm.Get("refresh_token"))
+			if err != nil {
+				handleOAuthErr(w, r, logger, err)
+				return
+			}
+
+			tokenInfo = info
+		case "client_credentials":
+			clientId, clientSecret, err := clientCredentialsFromRequest(r)
+			if err != nil {
+				handleOAuthErr(w, r, logger, err)
+				return
+			}
+
+			accessToken, err := m2mService.ClientCredentials(ctx, clientId, clientSecret)
+			if err != nil {
+				handleOAuthErr(w, r, logger, err)
+				return
+			}
+
+			// no refresh token for client_credentials, RFC 6749 section 4.4.3
+			safeEncode(w, r, logger, http.StatusOK, response{
+				AccessToken: accessToken,
+				TokenType:   "Bearer",
+				ExpiresIn:   int(m2m.AccessTokenDuration.Seconds()),
+			})
+			return
+		default:
+			handleOAuthErr(w, r, logger, errs.New(errcode.UnsupportedGrantType, fmt.Errorf("unsupported grant_type '%s'", grantType)))
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			AccessToken:  tokenInfo.AccessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(tokenInfo.AccessTokenDuration.Seconds()),
+			RefreshToken: tokenInfo.RefreshToken,
+			SessionId:    tokenInfo.SessionId,
+			IDToken:      tokenInfo.IDToken,
+		})
+	}
+}
+
+// V1_OAuth2_UserInfo returns the OIDC profile of the user behind a bearer access token
+func V1_OAuth2_UserInfo(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		Subject           string   `json:"sub"`
+		PreferredUsername string   `json:"preferred_username"`
+		Roles             []string `json:"roles"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kuura"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		client, err := authenticateToken(ctx, token, jwkManager, jwtIssuer)
+		if err == nil && client.ClientType != "user" {
+			err = errors.New("machine tokens have no user profile")
+		}
+		if err == nil {
+			var active bool
+			active, err = userService.SessionActive(ctx, client.SessionId, client.Id)
+			if err == nil && !active {
+				err = errors.New("the session has ended")
+			}
+		}
+		if err != nil {
+			logger.Debug("Rejected userinfo request", slog.String("error", err.Error()))
+			// RFC 6750 section 3.1
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kuura", error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		user, err := userService.GetUser(ctx, client.Id)
+		if err != nil {
+			handleOAuthErr(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		safeEncode(w, r, logger, http.StatusOK, response{
+			Subject:           user.Id,
+			PreferredUsername: user.Username,
+			Roles:             client.Roles,
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+// V1_OAuth2_Revoke ends a user or M2M session with its refresh token (RFC 7009), session_id is required like in the refresh_token grant
+func V1_OAuth2_Revoke(logger *slog.Logger, userService *users.UserService, m2mService *m2m.M2MService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		if err := r.ParseForm(); err != nil {
+			handleOAuthErr(w, r, logger, errs.New(errcode.InvalidRequest, err))
+			return
+		}
+
+		if problem := requireFormValues(r, "token", "session_id"); problem != nil {
+			handleOAuthErr(w, r, logger, problem)
+			return
+		}
+
+		// access tokens are stateless JWTs, only refresh tokens can be revoked
+		if hint := r.PostForm.Get("token_type_hint"); hint != "" && hint != "refresh_token" {
+			safeEncode(w, r, logger, http.StatusBadRequest, oauthErrorResponse{
+				Error:            "unsupported_token_type",
+				ErrorDescription: "only refresh tokens can be revoked",
+				TraceID:          traceIdFromRequest(r),
+			})
+			return
+		}
+
+		ctx := r.Context()
+		sessionId := r.PostForm.Get("session_id")
+		token := r.PostForm.Get("token")
+
+		revoked, err := userService.RevokeSession(ctx, sessionId, token)
+		if err != nil {
+			handleOAuthErr(w, r, logger, err)
+			return
+		}
+
+		if !revoked {
+			revoked, err = m2mService.RevokeSession(ctx, sessionId, token)
+			if err != nil {
+				handleOAuthErr(w, r, logger, err)
+				return
+			}
+		}
+
+		if !revoked {
+			logger.Debug("Nothing to revoke", slog.String("session_id", sessionId))
+		}
+
+		// unknown or already revoked tokens are not an error, RFC 7009 section 2.2
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func requireFormValues(r *http.Request, keys ...string) error {
+	for _, key := range keys {
+		if r.PostForm.Get(key) == "" {
+			return errs.New(errcode.InvalidRequest, fmt.Errorf("'%s' cannot be empty", key)).WithMetadata("parameter", key)
+		}
+	}
+
+	return nil
+}
+
+// client_secret_basic or client_secret_post, RFC 6749 section 2.3.1
+func clientCredentialsFromRequest(r *http.Request) (clientId string, clientSecret string, err error) {
+	if username, password, ok := r.BasicAuth(); ok {
+		clientId, err = url.QueryUnescape(username)
+		if err != nil {
+			return "", "", errs.New(errcode.InvalidClient, fmt.Errorf("failed to decode client_id: %w", err))
+		}
+
+		clientSecret, err = url.QueryUnescape(password)
+		if err != nil {
+			return "", "", errs.New(errcode.InvalidClient, fmt.Errorf("failed to decode client_secret: %w", err))
+		}
+	} else {
+		clientId = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if clientId == "" || clientSecret == "" {
+		return "", "", errs.New(errcode.InvalidClient, errors.New("missing client credentials"))
+	}
+
+	return clientId, clientSecret, nil
+}
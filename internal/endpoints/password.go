@@ -0,0 +1,104 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/users"
+)
+
+// V1_User_PasswordChangeBegin is the SRP begin step of V1_User_PasswordChange, the identity must be the logged in user's
+func V1_User_PasswordChangeBegin(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		Data string `json:"data"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		payload, err := decodeValid[*srpClientBegin](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		value, err := userService.BeginPasswordChange(r.Context(), client.Id, payload.Data)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			Data: value,
+		})
+	}
+}
+
+type passwordChangeRequest struct {
+	Data         string `json:"data"`
+	IdentityHash string `json:"identity"`
+	Verifier     string `json:"verifier"`
+}
+
+func (r *passwordChangeRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.Data == "" {
+		problems["data"] = "'data' cannot be empty"
+	}
+	if r.IdentityHash == "" {
+		problems["identity"] = "'identity' cannot be empty"
+	}
+	if r.Verifier == "" {
+		problems["verifier"] = "'verifier' cannot be empty"
+	}
+
+	return problems
+}
+
+// V1_User_PasswordChange checks the proof of the current password and stores the new verifier, other sessions are revoked
+func V1_User_PasswordChange(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		Success bool   `json:"success"`
+		Data    string `json:"data"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if client.SessionId == "" {
+			handleErr(w, r, logger, errs.New(errcode.Unauthorized, errors.New("access token has no session")))
+			return
+		}
+
+		payload, err := decodeValid[*passwordChangeRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		proof, err := userService.ChangePassword(r.Context(), client.Id, client.SessionId, payload.IdentityHash, payload.Data, payload.Verifier)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			Success: true,
+			Data:    proof,
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package endpoints
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/users"
+	"github.com/kymppi/kuura/internal/webauthn"
+)
+
+// V1_User_ReauthSRPBegin is the SRP begin step of V1_User_ReauthSRP, the identity must be the logged in user's
+func V1_User_ReauthSRPBegin(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		Data string `json:"data"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		payload, err := decodeValid[*srpClientBegin](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		value, err := userService.BeginReauthenticationSRP(r.Context(), client.Id, payload.Data)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			Data: value,
+		})
+	}
+}
+
+type reauthSRPRequest struct {
+	Data         string `json:"data"`
+	IdentityHash string `json:"identity"`
+}
+
+func (r *reauthSRPRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.Data == "" {
+		problems["data"] = "'data' cannot be empty"
+	}
+	if r.IdentityHash == "" {
+		problems["identity"] = "'identity' cannot be empty"
+	}
+
+	return problems
+}
+
+// V1_User_ReauthSRP checks the proof of the current password and unlocks sensitive account changes for a few minutes
+func V1_User_ReauthSRP(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		Success bool   `json:"success"`
+		Data    string `json:"data"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		payload, err := decodeValid[*reauthSRPRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		proof, err := userService.ReauthenticateSRP(r.Context(), client.Id, client.SessionId, payload.IdentityHash, payload.Data)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			Success: true,
+			Data:    proof,
+		})
+	}
+}
+
+func V1_User_ReauthTOTP(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		payload, err := decodeValid[*totpCodeRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.ReauthenticateTOTP(r.Context(), client.Id, client.SessionId, payload.Code); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, map[string]any{
+			"success": true,
+		})
+	}
+}
+
+func V1_User_ReauthWebAuthnBegin(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		options, err := userService.BeginReauthenticationWebAuthn(r.Context(), client.Id)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, options)
+	}
+}
+
+type reauthWebAuthnRequest struct {
+	Credential *webauthn.AssertionResponse `json:"credential"`
+}
+
+func (r *reauthWebAuthnRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.Credential == nil {
+		problems["credential"] = "'credential' cannot be empty"
+	}
+
+	return problems
+}
+
+func V1_User_ReauthWebAuthn(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		payload, err := decodeValid[*reauthWebAuthnRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.ReauthenticateWebAuthn(r.Context(), client.Id, client.SessionId, payload.Credential); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, map[string]any{
+			"success": true,
+		})
+	}
+}
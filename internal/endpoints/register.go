@@ -0,0 +1,72 @@
+package endpoints
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/kymppi/kuura/internal/users"
+)
+
+// V1_RegistrationPolicy lets the frontend decide whether to offer registration
+func V1_RegistrationPolicy(logger *slog.Logger, userService *users.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy, err := userService.GetRegistrationPolicy(r.Context())
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, policy)
+	}
+}
+
+type registerRequest struct {
+	Username   string `json:"username"`
+	Verifier   string `json:"verifier"`
+	Invitation string `json:"invitation,omitempty"` // token from the invitation link
+}
+
+func (r *registerRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.Username == "" {
+		problems["username"] = "'username' cannot be empty"
+	} else if len(r.Username) > 64 {
+		problems["username"] = "'username' cannot be longer than 64 characters"
+	} else if strings.TrimSpace(r.Username) != r.Username || strings.IndexFunc(r.Username, unicode.IsControl) >= 0 {
+		problems["username"] = "'username' cannot contain control characters or surrounding whitespace"
+	}
+	if r.Verifier == "" {
+		problems["verifier"] = "'verifier' cannot be empty"
+	}
+
+	return problems
+}
+
+// V1_Register creates a user from a verifier computed in the browser, the password never reaches the server
+func V1_Register(logger *slog.Logger, userService *users.UserService) http.HandlerFunc {
+	type response struct {
+		Id string `json:"id"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := decodeValid[*registerRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		uid, err := userService.SelfRegister(r.Context(), payload.Username, payload.Verifier, payload.Invitation)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusCreated, response{
+			Id: uid,
+		})
+	}
+}
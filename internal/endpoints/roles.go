@@ -0,0 +1,129 @@
+package endpoints
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/services"
+	"github.com/kymppi/kuura/internal/users"
+)
+
+type userServiceRolesResponse struct {
+	Username  string    `json:"username"`
+	ServiceId uuid.UUID `json:"service_id"`
+	Roles     []string  `json:"roles"`
+}
+
+func V1_Admin_UserRoles(logger *slog.Logger, userService *users.UserService) http.HandlerFunc {
+	type response struct {
+		Username string                 `json:"username"`
+		Services []*models.ServiceRoles `json:"services"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		username := r.PathValue("username")
+
+		uid, err := userService.GetUserIdByUsername(ctx, username)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		roles, err := userService.GetAllRoles(ctx, uid)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, response{
+			Username: username,
+			Services: roles,
+		})
+	}
+}
+
+type v1AddUserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+func (r *v1AddUserRolesRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if len(r.Roles) == 0 {
+		problems["roles"] = "'roles' cannot be empty"
+	}
+
+	return problems
+}
+
+func V1_Admin_AddUserRoles(logger *slog.Logger, userService *users.UserService, serviceManager *services.ServiceManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		username := r.PathValue("username")
+
+		data, err := decodeValid[*v1AddUserRolesRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		service, err := resolvePathService(r, serviceManager)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		uid, err := userService.GetUserIdByUsername(ctx, username)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		roles, err := userService.AddRoles(ctx, uid, service.Id, data.Roles)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, userServiceRolesResponse{
+			Username:  username,
+			ServiceId: service.Id,
+			Roles:     roles,
+		})
+	}
+}
+
+func V1_Admin_RemoveUserRole(logger *slog.Logger, userService *users.UserService, serviceManager *services.ServiceManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		username := r.PathValue("username")
+
+		service, err := resolvePathService(r, serviceManager)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		uid, err := userService.GetUserIdByUsername(ctx, username)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		roles, err := userService.RemoveRoles(ctx, uid, service.Id, []string{r.PathValue("role")})
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, userServiceRolesResponse{
+			Username:  username,
+			ServiceId: service.Id,
+			Roles:     roles,
+		})
+	}
+}
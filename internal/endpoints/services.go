@@ -24,33 +24,10 @@ func V1_ServiceInfo(logger *slog.Logger, serviceManager *services.ServiceManager
 
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-
-			var service *models.AppService
-			pathId := r.PathValue("serviceId")
-
-			if pathId == KUURA_SERVICE_ID_PATH {
-				svc, err := serviceManager.GetInternalKuuraService(ctx)
-				if err != nil {
-					handleErr(w, r, logger, err)
-					return
-				}
-
-				service = svc
-			} else {
-				serviceId, err := uuid.Parse(pathId)
-				if err != nil {
-					handleErr(w, r, logger, errs.New(errcode.InvalidServiceId, err))
-					return
-				}
-
-				svc, err := serviceManager.GetService(ctx, serviceId)
-				if err != nil {
-					handleErr(w, r, logger, err)
-					return
-				}
-
-				service = svc
+			service, err := resolvePathService(r, serviceManager)
+			if err != nil {
+				handleErr(w, r, logger, err)
+				return
 			}
 
 			safeEncode(w, r, logger, http.StatusOK, response{
@@ -63,3 +40,20 @@ func V1_ServiceInfo(logger *slog.Logger, serviceManager *services.ServiceManager
 		},
 	)
 }
+
+// resolves the {serviceId} path value, which can also be KUURA_SERVICE_ID_PATH
+func resolvePathService(r *http.Request, serviceManager *services.ServiceManager) (*models.AppService, error) {
+	ctx := r.Context()
+	pathId := r.PathValue("serviceId")
+
+	if pathId == KUURA_SERVICE_ID_PATH {
+		return serviceManager.GetInternalKuuraService(ctx)
+	}
+
+	serviceId, err := uuid.Parse(pathId)
+	if err != nil {
+		return nil, errs.New(errcode.InvalidServiceId, err)
+	}
+
+	return serviceManager.GetService(ctx, serviceId)
+}
@@ -87,8 +87,11 @@ func (r *srpVerifyRequest) Valid(ctx context.Context) (problems map[string]strin
 
 func V1_SRP_ClientVerify(logger *slog.Logger, userService *users.UserService, publicKuuraDomain string) http.Handler {
 	type response struct {
-		Success bool   `json:"success"`
-		Data    string `json:"data"`
+		Success     bool     `json:"success"`
+		Data        string   `json:"data"`
+		MFARequired bool     `json:"mfa_required,omitempty"`
+		MFAToken    string   `json:"mfa_token,omitempty"`
+		MFAMethods  []string `json:"mfa_methods,omitempty"`
 	}
 
 	return http.HandlerFunc(
@@ -107,19 +110,42 @@ func V1_SRP_ClientVerify(logger *slog.Logger, userService *users.UserService, pu
 				return
 			}
 
-			sessionId, initialRefreshToken, err := userService.CreateSession(ctx, uid, uuid.MustParse(payload.TargetService))
-			if err != nil {
+			targetService := uuid.MustParse(payload.TargetService)
+
+			// refuse before asking for a second factor the user would complete for nothing
+			if err := userService.CheckServiceAccess(ctx, uid, targetService); err != nil {
 				handleErr(w, r, logger, err)
 				return
 			}
 
-			tokenInfo, err := userService.CreateAccessToken(ctx, sessionId, initialRefreshToken)
+			mfaMethods, err := userService.MFAMethods(ctx, uid)
 			if err != nil {
 				handleErr(w, r, logger, err)
 				return
 			}
 
-			setInternalAuthCookies(w, sessionId, tokenInfo, publicKuuraDomain)
+			// the session is only created after the second factor, see V1_MFA_TOTP
+			if len(mfaMethods) > 0 {
+				mfaToken, err := userService.BeginMFAChallenge(ctx, uid, targetService)
+				if err != nil {
+					handleErr(w, r, logger, err)
+					return
+				}
+
+				safeEncode(w, r, logger, http.StatusOK, response{
+					Success:     true,
+					Data:        serverProof,
+					MFARequired: true,
+					MFAToken:    mfaToken,
+					MFAMethods:  mfaMethods,
+				})
+				return
+			}
+
+			if err := startInternalSession(ctx, w, userService, uid, targetService, publicKuuraDomain); err != nil {
+				handleErr(w, r, logger, err)
+				return
+			}
 
 			data := response{
 				Success: true,
@@ -166,44 +192,34 @@ func V1_ME(logger *slog.Logger, users *users.UserService, jwkManager *jwks.JWKMa
 		Id          string `json:"id"`
 		Username    string `json:"username"`
 		LastLoginAt string `json:"last_login_at"`
+		TOTPEnabled bool   `json:"totp_enabled"`
+
+		RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
 	}
 
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
 
-			accessCookie, err := r.Cookie(constants.INTERNAL_ACCESS_TOKEN_COOKIE)
+			client, err := authenticateAccessCookie(r, users, jwkManager, jwtIssuer)
 			if err != nil {
-				handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("'%s' cookie not found", constants.INTERNAL_ACCESS_TOKEN_COOKIE)))
-				return
-			}
-			token := accessCookie.Value
-
-			serviceId, err := extractServiceIdFromToken(token)
-			if err != nil {
-				handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to extract serviceId from token: %w", err)))
-				return
-			} else if serviceId == nil {
-				handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to extract serviceId from token without error")))
+				handleErr(w, r, logger, err)
 				return
 			}
 
-			jwkSet, err := jwkManager.GetJWKS(ctx, *serviceId)
+			user, err := users.GetUser(ctx, client.Id)
 			if err != nil {
-				handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to get JWKS: %w", err)))
+				handleErr(w, r, logger, err)
 				return
 			}
 
-			client, err := parseToken(token, &AuthConfig{
-				JWTIssuer: jwtIssuer,
-				JWKSet:    jwkSet,
-			})
+			totpEnabled, err := users.TOTPEnabled(ctx, user.Id)
 			if err != nil {
-				handleErr(w, r, logger, errs.New(errcode.Unauthorized, err))
+				handleErr(w, r, logger, err)
 				return
 			}
 
-			user, err := users.GetUser(ctx, client.Id)
+			recoveryCodes, err := users.RecoveryCodesRemaining(ctx, user.Id)
 			if err != nil {
 				handleErr(w, r, logger, err)
 				return
@@ -213,11 +229,61 @@ func V1_ME(logger *slog.Logger, users *users.UserService, jwkManager *jwks.JWKMa
 				Id:          user.Id,
 				Username:    user.Username,
 				LastLoginAt: user.LastLoginAt.UTC().Format("2006-01-02T15:04:05Z"),
+				TOTPEnabled: totpEnabled,
+
+				RecoveryCodesRemaining: recoveryCodes,
 			})
 		},
 	)
 }
 
+// validates the internal access token cookie, tokens that relying parties received for other services are rejected
+func authenticateAccessCookie(r *http.Request, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) (*Client, error) {
+	accessCookie, err := r.Cookie(constants.INTERNAL_ACCESS_TOKEN_COOKIE)
+	if err != nil {
+		return nil, errs.New(errcode.Unauthorized, fmt.Errorf("'%s' cookie not found", constants.INTERNAL_ACCESS_TOKEN_COOKIE))
+	}
+
+	client, err := authenticateToken(r.Context(), accessCookie.Value, jwkManager, jwtIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	internal, err := userService.IsInternalService(r.Context(), client.ServiceId)
+	if err != nil {
+		return nil, err
+	} else if !internal {
+		return nil, errs.New(errcode.Unauthorized, fmt.Errorf("access token was issued for service %s, not the internal service", client.ServiceId))
+	}
+
+	return client, nil
+}
+
+// validates an access token against the JWKS of the service it was issued for
+func authenticateToken(ctx context.Context, token string, jwkManager *jwks.JWKManager, jwtIssuer string) (*Client, error) {
+	serviceId, err := extractServiceIdFromToken(token)
+	if err != nil {
+		return nil, errs.New(errcode.Unauthorized, fmt.Errorf("failed to extract serviceId from token: %w", err))
+	} else if serviceId == nil {
+		return nil, errs.New(errcode.Unauthorized, fmt.Errorf("failed to extract serviceId from token without error"))
+	}
+
+	jwkSet, err := jwkManager.GetJWKS(ctx, *serviceId)
+	if err != nil {
+		return nil, errs.New(errcode.Unauthorized, fmt.Errorf("failed to get JWKS: %w", err))
+	}
+
+	client, err := parseToken(token, &AuthConfig{
+		JWTIssuer: jwtIssuer,
+		JWKSet:    jwkSet,
+	})
+	if err != nil {
+		return nil, errs.New(errcode.Unauthorized, err)
+	}
+
+	return client, nil
+}
+
 // extracts the serviceId from a JWT token without fully validating it
 func extractServiceIdFromToken(tokenString string) (*uuid.UUID, error) {
 	token, err := jwt.Parse(
@@ -247,18 +313,37 @@ func extractServiceIdFromToken(tokenString string) (*uuid.UUID, error) {
 	return &parsedUUID, nil
 }
 
+// creates a session for a user who has completed every required factor and sets the cookies of the kuura frontend
+func startInternalSession(ctx context.Context, w http.ResponseWriter, userService *users.UserService, uid string, serviceId uuid.UUID, publicKuuraDomain string) error {
+	sessionId, initialRefreshToken, err := userService.CreateSession(ctx, uid, serviceId)
+	if err != nil {
+		return err
+	}
+
+	tokenInfo, err := userService.CreateAccessToken(ctx, sessionId, initialRefreshToken)
+	if err != nil {
+		return err
+	}
+
+	setInternalAuthCookies(w, sessionId, tokenInfo, publicKuuraDomain)
+
+	return nil
+}
+
 func setInternalAuthCookies(w http.ResponseWriter, sessionId string, tokenInfo *users.TokenInfo, publicKuuraDomain string) {
-	// refresh token
-	http.SetCookie(w, &http.Cookie{
-		Name:     constants.INTERNAL_REFRESH_TOKEN_COOKIE,
-		Value:    tokenInfo.RefreshToken,
-		Path:     constants.INTERNAL_USER_REFRESH_PATH,
-		MaxAge:   60 * 60 * 24 * 7, // week in seconds
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode, // path must match
-		Domain:   publicKuuraDomain,
-	})
+	// refresh token, left alone when a concurrent refresh already set the new one
+	if tokenInfo.RefreshToken != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     constants.INTERNAL_REFRESH_TOKEN_COOKIE,
+			Value:    tokenInfo.RefreshToken,
+			Path:     constants.INTERNAL_USER_REFRESH_PATH,
+			MaxAge:   60 * 60 * 24 * 7, // week in seconds
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode, // path must match
+			Domain:   publicKuuraDomain,
+		})
+	}
 
 	// session
 	http.SetCookie(w, &http.Cookie{
@@ -327,13 +412,6 @@ func V1_User_Logout(logger *slog.Logger, userService *users.UserService, publicK
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		accessCookie, err := r.Cookie(constants.INTERNAL_ACCESS_TOKEN_COOKIE)
-		if err != nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("'%s' cookie not found", constants.INTERNAL_ACCESS_TOKEN_COOKIE)))
-			return
-		}
-		token := accessCookie.Value
-
 		sessionCookie, err := r.Cookie(constants.INTERNAL_SESSION_COOKIE)
 		if err != nil {
 			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("'%s' cookie not found", constants.INTERNAL_SESSION_COOKIE)))
@@ -341,27 +419,9 @@ func V1_User_Logout(logger *slog.Logger, userService *users.UserService, publicK
 		}
 		sessionId := sessionCookie.Value
 
-		serviceId, err := extractServiceIdFromToken(token)
-		if err != nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to extract serviceId from token: %w", err)))
-			return
-		} else if serviceId == nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to extract serviceId from token without error")))
-			return
-		}
-
-		jwkSet, err := jwkManager.GetJWKS(ctx, *serviceId)
-		if err != nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to get JWKS: %w", err)))
-			return
-		}
-
-		client, err := parseToken(token, &AuthConfig{
-			JWTIssuer: jwtIssuer,
-			JWKSet:    jwkSet,
-		})
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
 		if err != nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, err))
+			handleErr(w, r, logger, err)
 			return
 		}
 
@@ -409,7 +469,7 @@ func (r *v1ServiceUserTokens) Valid(ctx context.Context) (problems map[string]st
 func V1_User_ExternalTokens(logger *slog.Logger, userService *users.UserService) http.HandlerFunc {
 	type response struct {
 		AccessToken         string `json:"access_token"`
-		RefreshToken        string `json:"refresh_token"`
+		RefreshToken        string `json:"refresh_token,omitempty"` // omitted when a concurrent refresh received the new one
 		SessionId           string `json:"session_id"`
 		AccessTokenDuration int    `json:"access_token_duration_seconds"`
 	}
@@ -484,34 +544,9 @@ func V1_User_LoginExternal(logger *slog.Logger, userService *users.UserService,
 
 		ctx := r.Context()
 
-		accessCookie, err := r.Cookie(constants.INTERNAL_ACCESS_TOKEN_COOKIE)
-		if err != nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("'%s' cookie not found", constants.INTERNAL_ACCESS_TOKEN_COOKIE)))
-			return
-		}
-		token := accessCookie.Value
-
-		currentSessionServiceId, err := extractServiceIdFromToken(token)
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
 		if err != nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to extract serviceId from token: %w", err)))
-			return
-		} else if currentSessionServiceId == nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to extract serviceId from token without error")))
-			return
-		}
-
-		jwkSet, err := jwkManager.GetJWKS(ctx, *currentSessionServiceId)
-		if err != nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, fmt.Errorf("failed to get JWKS: %w", err)))
-			return
-		}
-
-		client, err := parseToken(token, &AuthConfig{
-			JWTIssuer: jwtIssuer,
-			JWKSet:    jwkSet,
-		})
-		if err != nil {
-			handleErr(w, r, logger, errs.New(errcode.Unauthorized, err))
+			handleErr(w, r, logger, err)
 			return
 		}
 
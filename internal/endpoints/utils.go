@@ -31,13 +31,7 @@ func safeEncode[T any](w http.ResponseWriter, r *http.Request, logger *slog.Logg
 }
 
 func handleErr(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error) {
-	span := trace.SpanFromContext(r.Context())
-	spanContext := span.SpanContext()
-
-	var traceId string
-	if spanContext.IsValid() {
-		traceId = spanContext.TraceID().String()
-	}
+	traceId := traceIdFromRequest(r)
 
 	// in-theory the traceId should match with the customErr.TraceID but not 100% so returning both
 
@@ -73,6 +67,16 @@ func handleErr(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err
 	})
 }
 
+func traceIdFromRequest(r *http.Request) string {
+	spanContext := trace.SpanFromContext(r.Context()).SpanContext()
+
+	if spanContext.IsValid() {
+		return spanContext.TraceID().String()
+	}
+
+	return ""
+}
+
 // https://grafana.com/blog/2024/02/09/how-i-write-http-services-in-go-after-13-years/
 
 func encode[T any](w http.ResponseWriter, _ *http.Request, status int, v T) error {
@@ -140,6 +144,9 @@ type Client struct {
 	Roles          []string
 	ClientType     string // machine | user
 	TokenExpiresAt time.Time
+	ServiceId      string
+	SessionId      string // empty for client_credentials tokens
+	ClientId       string // only set for client_credentials tokens
 }
 
 func parseToken(tokenString string, config *AuthConfig) (*Client, error) {
@@ -180,5 +187,18 @@ func parseToken(tokenString string, config *AuthConfig) (*Client, error) {
 		Roles:          roles,
 		ClientType:     clientType.(string),
 		TokenExpiresAt: token.Expiration(),
+		ServiceId:      optionalStringClaim(token, "service_id"),
+		SessionId:      optionalStringClaim(token, "session_id"),
+		ClientId:       optionalStringClaim(token, "client_id"),
 	}, nil
 }
+
+func optionalStringClaim(token jwt.Token, name string) string {
+	value, ok := token.Get(name)
+	if !ok {
+		return ""
+	}
+
+	str, _ := value.(string)
+	return str
+}
@@ -0,0 +1,293 @@
+package endpoints
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/users"
+	"github.com/kymppi/kuura/internal/webauthn"
+)
+
+// V1_User_WebAuthnRegisterBegin requires the session to have been reauthenticated recently, see V1_User_ReauthSRP
+func V1_User_WebAuthnRegisterBegin(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.RequireReauthentication(r.Context(), client.Id, client.SessionId); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		options, err := userService.BeginWebAuthnRegistration(r.Context(), client.Id)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, options)
+	}
+}
+
+type webauthnRegisterFinishRequest struct {
+	Name       string                         `json:"name"`
+	Credential *webauthn.RegistrationResponse `json:"credential"`
+}
+
+func (r *webauthnRegisterFinishRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if len(r.Name) > 64 {
+		problems["name"] = "'name' cannot be longer than 64 characters"
+	}
+	if r.Credential == nil {
+		problems["credential"] = "'credential' cannot be empty"
+	}
+
+	return problems
+}
+
+func V1_User_WebAuthnRegisterFinish(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	type response struct {
+		*models.WebAuthnCredential
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.RequireReauthentication(r.Context(), client.Id, client.SessionId); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		payload, err := decodeValid[*webauthnRegisterFinishRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		credential, recoveryCodes, err := userService.FinishWebAuthnRegistration(r.Context(), client.Id, payload.Name, payload.Credential)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if recoveryCodes != nil {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+
+		safeEncode(w, r, logger, http.StatusCreated, response{
+			WebAuthnCredential: credential,
+			RecoveryCodes:      recoveryCodes,
+		})
+	}
+}
+
+func V1_User_WebAuthnCredentials(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		credentials, err := userService.GetWebAuthnCredentials(r.Context(), client.Id)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, credentials)
+	}
+}
+
+// V1_User_WebAuthnDelete requires the session to have been reauthenticated recently, see V1_User_ReauthSRP
+func V1_User_WebAuthnDelete(logger *slog.Logger, userService *users.UserService, jwkManager *jwks.JWKManager, jwtIssuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := authenticateAccessCookie(r, userService, jwkManager, jwtIssuer)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.RequireReauthentication(r.Context(), client.Id, client.SessionId); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := userService.DeleteWebAuthnCredential(r.Context(), client.Id, r.PathValue("credentialId")); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, map[string]any{
+			"success": true,
+		})
+	}
+}
+
+type webauthnLoginBeginRequest struct {
+	TargetService string `json:"target_service"`
+}
+
+func (r *webauthnLoginBeginRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.TargetService == "" {
+		problems["target_service"] = "'target_service' cannot be empty"
+	} else if _, err := uuid.Parse(r.TargetService); err != nil {
+		problems["target_service"] = "'target_service' must be a valid UUID"
+	}
+
+	return problems
+}
+
+// V1_WebAuthn_LoginBegin starts a passwordless login
+func V1_WebAuthn_LoginBegin(logger *slog.Logger, userService *users.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := decodeValid[*webauthnLoginBeginRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		options, err := userService.BeginWebAuthnLogin(r.Context(), uuid.MustParse(payload.TargetService))
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, options)
+	}
+}
+
+type webauthnLoginFinishRequest struct {
+	Credential *webauthn.AssertionResponse `json:"credential"`
+}
+
+func (r *webauthnLoginFinishRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.Credential == nil {
+		problems["credential"] = "'credential' cannot be empty"
+	}
+
+	return problems
+}
+
+func V1_WebAuthn_LoginFinish(logger *slog.Logger, userService *users.UserService, publicKuuraDomain string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		payload, err := decodeValid[*webauthnLoginFinishRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		uid, serviceId, err := userService.FinishWebAuthnLogin(ctx, payload.Credential)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := startInternalSession(ctx, w, userService, uid, serviceId, publicKuuraDomain); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, map[string]any{
+			"success": true,
+		})
+	}
+}
+
+type mfaWebAuthnBeginRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+func (r *mfaWebAuthnBeginRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.MFAToken == "" {
+		problems["mfa_token"] = "'mfa_token' cannot be empty"
+	}
+
+	return problems
+}
+
+func V1_MFA_WebAuthnBegin(logger *slog.Logger, userService *users.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := decodeValid[*mfaWebAuthnBeginRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		options, err := userService.BeginMFAChallengeWebAuthn(r.Context(), payload.MFAToken)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, options)
+	}
+}
+
+type mfaWebAuthnRequest struct {
+	MFAToken   string                      `json:"mfa_token"`
+	Credential *webauthn.AssertionResponse `json:"credential"`
+}
+
+func (r *mfaWebAuthnRequest) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	if r.MFAToken == "" {
+		problems["mfa_token"] = "'mfa_token' cannot be empty"
+	}
+	if r.Credential == nil {
+		problems["credential"] = "'credential' cannot be empty"
+	}
+
+	return problems
+}
+
+// V1_MFA_WebAuthn finishes a login that V1_SRP_ClientVerify left waiting for a second factor
+func V1_MFA_WebAuthn(logger *slog.Logger, userService *users.UserService, publicKuuraDomain string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		payload, err := decodeValid[*mfaWebAuthnRequest](r)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		uid, serviceId, err := userService.CompleteMFAChallengeWebAuthn(ctx, payload.MFAToken, payload.Credential)
+		if err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		if err := startInternalSession(ctx, w, userService, uid, serviceId, publicKuuraDomain); err != nil {
+			handleErr(w, r, logger, err)
+			return
+		}
+
+		safeEncode(w, r, logger, http.StatusOK, map[string]any{
+			"success": true,
+		})
+	}
+}
@@ -9,19 +9,25 @@ type InstanceSetting int64
 
 const (
 	InternalServiceId InstanceSetting = iota
+	RegistrationMode
+	RegistrationUsernamePattern
 )
 
 func (s InstanceSetting) String() string {
 	switch s {
 	case InternalServiceId:
 		return "INTERNAL_SERVICE_ID"
+	case RegistrationMode:
+		return "REGISTRATION_MODE"
+	case RegistrationUsernamePattern:
+		return "REGISTRATION_USERNAME_PATTERN"
 	default:
 		return "UNKNOWN"
 	}
 }
 
 func (s InstanceSetting) IsValid() bool {
-	return s == InternalServiceId
+	return s == InternalServiceId || s == RegistrationMode || s == RegistrationUsernamePattern
 }
 
 func From(v interface{}) (InstanceSetting, error) {
@@ -30,6 +36,10 @@ func From(v interface{}) (InstanceSetting, error) {
 		switch val {
 		case "INTERNAL_SERVICE_ID":
 			return InternalServiceId, nil
+		case "REGISTRATION_MODE":
+			return RegistrationMode, nil
+		case "REGISTRATION_USERNAME_PATTERN":
+			return RegistrationUsernamePattern, nil
 		default:
 			// Try to parse the string as an int64 and convert to InstanceSetting
 			num, err := strconv.ParseInt(val, 10, 64)
@@ -52,5 +62,7 @@ func From(v interface{}) (InstanceSetting, error) {
 func AllPossibleStatuses() []InstanceSetting {
 	return []InstanceSetting{
 		InternalServiceId,
+		RegistrationMode,
+		RegistrationUsernamePattern,
 	}
 }
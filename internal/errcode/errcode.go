@@ -36,9 +36,24 @@ const (
 	// Category 01: M2M
 
 	// Category 02: Users
-	MissingCookie    ErrorCode = "K0201"
-	UserNotFound     ErrorCode = "K0202"
-	AlreadyLoggingIn ErrorCode = "K0203"
+	MissingCookie              ErrorCode = "K0201"
+	UserNotFound               ErrorCode = "K0202"
+	AlreadyLoggingIn           ErrorCode = "K0203"
+	InvalidMFACode             ErrorCode = "K0204"
+	MFAChallengeExpired        ErrorCode = "K0205"
+	TOTPAlreadyEnabled         ErrorCode = "K0206"
+	TOTPNotEnrolled            ErrorCode = "K0207"
+	WebAuthnFailed             ErrorCode = "K0208"
+	WebAuthnCredentialNotFound ErrorCode = "K0209"
+	MFANotEnabled              ErrorCode = "K0210"
+	RegistrationClosed         ErrorCode = "K0211"
+	InvitationRequired         ErrorCode = "K0212"
+	UsernameTaken              ErrorCode = "K0213"
+	UsernameNotAllowed         ErrorCode = "K0214"
+	InvitationInvalid          ErrorCode = "K0215"
+	InvitationNotFound         ErrorCode = "K0216"
+	UserDisabled               ErrorCode = "K0217"
+	ReauthenticationRequired   ErrorCode = "K0218"
 
 	// Category 03: JWKS
 	InvalidServiceId ErrorCode = "K0301"
@@ -47,7 +62,15 @@ const (
 	SettingNotFound ErrorCode = "K0401"
 
 	// Category 05: Services
-	ServiceNotFound ErrorCode = "K0501"
+	ServiceNotFound     ErrorCode = "K0501"
+	ServiceAccessDenied ErrorCode = "K0502"
+
+	// Category 06: OAuth2
+	InvalidRequest       ErrorCode = "K0601"
+	InvalidClient        ErrorCode = "K0602"
+	InvalidGrant         ErrorCode = "K0603"
+	UnsupportedGrantType ErrorCode = "K0604"
+	InvalidRedirectURI   ErrorCode = "K0605"
 )
 
 var errorDetailsMap = map[ErrorCode]ErrorDetail{
@@ -91,6 +114,81 @@ var errorDetailsMap = map[ErrorCode]ErrorDetail{
 		StatusCode:  http.StatusConflict,
 		Description: "You're already trying to login from another device.",
 	},
+	InvalidMFACode: {
+		Code:        InvalidMFACode,
+		StatusCode:  http.StatusUnauthorized,
+		Description: "Invalid verification code.",
+	},
+	MFAChallengeExpired: {
+		Code:        MFAChallengeExpired,
+		StatusCode:  http.StatusUnauthorized,
+		Description: "The login attempt has expired, please log in again.",
+	},
+	TOTPAlreadyEnabled: {
+		Code:        TOTPAlreadyEnabled,
+		StatusCode:  http.StatusConflict,
+		Description: "Authenticator app is already enabled.",
+	},
+	TOTPNotEnrolled: {
+		Code:        TOTPNotEnrolled,
+		StatusCode:  http.StatusBadRequest,
+		Description: "Authenticator app has not been set up.",
+	},
+	WebAuthnFailed: {
+		Code:        WebAuthnFailed,
+		StatusCode:  http.StatusUnauthorized,
+		Description: "Passkey verification failed.",
+	},
+	WebAuthnCredentialNotFound: {
+		Code:        WebAuthnCredentialNotFound,
+		StatusCode:  http.StatusNotFound,
+		Description: "Passkey not found.",
+	},
+	MFANotEnabled: {
+		Code:        MFANotEnabled,
+		StatusCode:  http.StatusBadRequest,
+		Description: "Two-factor authentication is not enabled.",
+	},
+	RegistrationClosed: {
+		Code:        RegistrationClosed,
+		StatusCode:  http.StatusForbidden,
+		Description: "Registration is closed.",
+	},
+	InvitationRequired: {
+		Code:        InvitationRequired,
+		StatusCode:  http.StatusForbidden,
+		Description: "Registration requires an invitation.",
+	},
+	UsernameTaken: {
+		Code:        UsernameTaken,
+		StatusCode:  http.StatusConflict,
+		Description: "Username is already taken.",
+	},
+	UsernameNotAllowed: {
+		Code:        UsernameNotAllowed,
+		StatusCode:  http.StatusBadRequest,
+		Description: "Username is not allowed.",
+	},
+	InvitationInvalid: {
+		Code:        InvitationInvalid,
+		StatusCode:  http.StatusBadRequest,
+		Description: "Invitation is invalid, expired or already used.",
+	},
+	InvitationNotFound: {
+		Code:        InvitationNotFound,
+		StatusCode:  http.StatusNotFound,
+		Description: "Invitation not found or already used.",
+	},
+	UserDisabled: {
+		Code:        UserDisabled,
+		StatusCode:  http.StatusForbidden,
+		Description: "User account is disabled.",
+	},
+	ReauthenticationRequired: {
+		Code:        ReauthenticationRequired,
+		StatusCode:  http.StatusForbidden,
+		Description: "Confirm your identity again to continue.",
+	},
 
 	// Category 03: JWKS
 	InvalidServiceId: {
@@ -112,4 +210,36 @@ var errorDetailsMap = map[ErrorCode]ErrorDetail{
 		StatusCode:  http.StatusNotFound,
 		Description: "Service not found.",
 	},
+	ServiceAccessDenied: {
+		Code:        ServiceAccessDenied,
+		StatusCode:  http.StatusForbidden,
+		Description: "You are not allowed to log into this service.",
+	},
+
+	// Category 06: OAuth2
+	InvalidRequest: {
+		Code:        InvalidRequest,
+		StatusCode:  http.StatusBadRequest,
+		Description: "The request is missing a required parameter or is otherwise malformed.",
+	},
+	InvalidClient: {
+		Code:        InvalidClient,
+		StatusCode:  http.StatusUnauthorized,
+		Description: "Client authentication failed.",
+	},
+	InvalidGrant: {
+		Code:        InvalidGrant,
+		StatusCode:  http.StatusBadRequest,
+		Description: "The provided grant is invalid, expired or revoked.",
+	},
+	UnsupportedGrantType: {
+		Code:        UnsupportedGrantType,
+		StatusCode:  http.StatusBadRequest,
+		Description: "The grant type is not supported.",
+	},
+	InvalidRedirectURI: {
+		Code:        InvalidRedirectURI,
+		StatusCode:  http.StatusBadRequest,
+		Description: "The redirect_uri does not match the one registered for the service.",
+	},
 }
@@ -55,6 +55,9 @@ func newManagementServer(
 	config *Config,
 	jwkManager *jwks.JWKManager,
 	m2mService *m2m.M2MService,
+	userService *users.UserService,
+	serviceManager *services.ServiceManager,
+	managementToken []byte,
 ) *http.Server {
 	mux := http.NewServeMux()
 
@@ -65,6 +68,9 @@ func newManagementServer(
 		serverLogger,
 		jwkManager,
 		m2mService,
+		userService,
+		serviceManager,
+		managementToken,
 	)
 
 	var handler http.Handler = mux
@@ -1,15 +1,17 @@
 package kuura
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
-	"os"
 
 	"github.com/kymppi/kuura/internal/db_gen"
 	"github.com/kymppi/kuura/internal/jwks"
+	"github.com/kymppi/kuura/internal/kek"
 	"github.com/kymppi/kuura/internal/services"
 	"github.com/kymppi/kuura/internal/users"
+	"github.com/kymppi/kuura/internal/webauthn"
 )
 
 // setup db, check migration status
@@ -34,14 +36,42 @@ func InitializeDatabaseConnection(ctx context.Context, logger *slog.Logger, conf
 	return db_gen.New(pool), cleanup, nil
 }
 
-func InitializeJWKManager(ctx context.Context, logger *slog.Logger, config *Config, queries *db_gen.Queries) (*jwks.JWKManager, error) {
-	encryptionKey, err := loadEncryptionKey(config.JWK_KEK_PATH)
+// LoadKEKs loads the current key encryption key and the previous ones still needed for decrypting, by their ids
+func LoadKEKs(ctx context.Context, logger *slog.Logger, config *Config) (map[string][]byte, error) {
+	keks := make(map[string][]byte, len(config.JWK_PREVIOUS_KEKS)+1)
+	for id, source := range config.JWK_PREVIOUS_KEKS {
+		kek, err := LoadKey(ctx, config, source)
+		if err != nil {
+			logger.Error("Failed to load previous encryption key", slog.String("kek_id", id), slog.String("error", err.Error()))
+			return nil, err
+		}
+		keks[id] = kek
+	}
+
+	encryptionKey, err := LoadKey(ctx, config, keySource(config.JWK_KEK, config.JWK_KEK_PATH))
 	if err != nil {
 		logger.Error("Failed to load encryption key", slog.String("error", err.Error()))
 		return nil, err
 	}
+	keks[config.JWK_KEK_ID] = encryptionKey
+
+	return keks, nil
+}
+
+func InitializeJWKManager(ctx context.Context, logger *slog.Logger, config *Config, queries *db_gen.Queries) (*jwks.JWKManager, error) {
+	keks, err := LoadKEKs(ctx, logger, config)
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := jwks.NewPostgresQLKeyStorage(queries, config.JWK_KEK_ID, keks)
+	if err != nil {
+		return nil, err
+	}
 
-	storage := jwks.NewPostgresQLKeyStorage(queries, encryptionKey)
+	if config.JWK_CACHE_TTL > 0 {
+		return jwks.NewJWKManager(jwks.NewCachingKeyStorage(storage, config.JWK_CACHE_TTL)), nil
+	}
 
 	return jwks.NewJWKManager(storage), nil
 }
@@ -54,12 +84,18 @@ func InitializeUserService(
 	jwkManager *jwks.JWKManager,
 	serviceManager *services.ServiceManager,
 ) (*users.UserService, error) {
-	secretKey, err := loadEncryptionKey(config.USER_CODE_SECRET_KEY_PATH)
+	secretKey, err := LoadKey(ctx, config, keySource(config.USER_CODE_SECRET_KEY, config.USER_CODE_SECRET_KEY_PATH))
 	if err != nil {
 		logger.Error("Failed to load secret key for user codes", slog.String("error", err.Error()))
 		return nil, err
 	}
 
+	// TOTP secrets are sealed with the same key encryption keys as the signing keys
+	keks, err := LoadKEKs(ctx, logger, config)
+	if err != nil {
+		return nil, err
+	}
+
 	return users.NewUserService(
 		logger,
 		queries,
@@ -67,13 +103,76 @@ func InitializeUserService(
 		jwkManager,
 		serviceManager,
 		secretKey,
+		config.JWK_KEK_ID,
+		keks,
+		RelyingParty(config),
 	), nil
 }
 
-func loadEncryptionKey(path string) ([]byte, error) {
-	data, err := os.ReadFile(path)
+// loadManagementToken returns nil when MANAGEMENT_TOKEN is not configured and refuses a key encryption key as the token
+func loadManagementToken(ctx context.Context, logger *slog.Logger, config *Config) ([]byte, error) {
+	if config.MANAGEMENT_TOKEN == "" {
+		logger.Warn("MANAGEMENT_TOKEN is not set, the authenticated management endpoints reject every request")
+		return nil, nil
+	}
+
+	token, err := LoadKey(ctx, config, config.MANAGEMENT_TOKEN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load management token: %w", err)
+	}
+
+	keks, err := LoadKEKs(ctx, logger, config)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, key := range keks {
+		if bytes.Equal(token, key) {
+			return nil, fmt.Errorf("management token must not be the key encryption key %q, generate one with `kuura management generate-token`", id)
+		}
+	}
+
+	return token, nil
+}
+
+// RelyingParty defaults to the public kuura domain
+func RelyingParty(config *Config) *webauthn.RelyingParty {
+	id := config.WEBAUTHN_RP_ID
+	if id == "" {
+		id = config.PUBLIC_KUURA_DOMAIN
+	}
+
+	origins := config.WEBAUTHN_ORIGINS
+	if len(origins) == 0 {
+		origins = []string{"https://" + id}
+	}
+
+	return webauthn.NewRelyingParty(id, config.WEBAUTHN_RP_NAME, origins)
+}
+
+// LoadKey loads a 32 byte key from a key source, see kek.ParseSource
+func LoadKey(ctx context.Context, config *Config, source string) ([]byte, error) {
+	provider, err := kek.ParseSource(source, TransitClient(config))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		return nil, err
+	}
+
+	return provider.Key(ctx)
+}
+
+// TransitClient returns nil when VAULT_ADDR is not configured
+func TransitClient(config *Config) *kek.TransitClient {
+	if config.VAULT_ADDR == "" {
+		return nil
+	}
+
+	return kek.NewTransitClient(config.VAULT_ADDR, config.VAULT_TOKEN, config.KEK_TRANSIT_MOUNT, config.KEK_TRANSIT_KEY)
+}
+
+func keySource(source string, path string) string {
+	if source != "" {
+		return source
 	}
-	return data, nil
+
+	return "file:" + path
 }
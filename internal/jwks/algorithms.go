@@ -0,0 +1,79 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// keys created before algorithms were configurable are P-384 ECDSA
+const DefaultAlgorithm = jwa.ES384
+
+var SupportedAlgorithms = []jwa.SignatureAlgorithm{
+	jwa.ES256,
+	jwa.ES384,
+	jwa.RS256,
+	jwa.EdDSA,
+}
+
+func ParseAlgorithm(name string) (jwa.SignatureAlgorithm, error) {
+	for _, alg := range SupportedAlgorithms {
+		if alg.String() == name {
+			return alg, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported key algorithm '%s', expected one of %v", name, SupportedAlgorithms)
+}
+
+func generateRawKey(alg jwa.SignatureAlgorithm) (any, error) {
+	switch alg {
+	case jwa.ES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwa.ES384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case jwa.RS256:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case jwa.EdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm '%s'", alg)
+	}
+}
+
+// validates the "alg" of a stored key, keys without one are legacy ES384 keys
+func keyAlgorithm(key jwk.Key) (jwa.SignatureAlgorithm, error) {
+	if key.Algorithm().String() == "" {
+		if err := key.Set(jwk.AlgorithmKey, DefaultAlgorithm); err != nil {
+			return "", err
+		}
+	}
+
+	alg, err := ParseAlgorithm(key.Algorithm().String())
+	if err != nil {
+		return "", err
+	}
+
+	var expectedType jwa.KeyType
+	switch alg {
+	case jwa.ES256, jwa.ES384:
+		expectedType = jwa.EC
+	case jwa.RS256:
+		expectedType = jwa.RSA
+	case jwa.EdDSA:
+		expectedType = jwa.OKP
+	}
+
+	if key.KeyType() != expectedType {
+		return "", fmt.Errorf("key type %s does not match algorithm %s", key.KeyType(), alg)
+	}
+
+	return alg, nil
+}
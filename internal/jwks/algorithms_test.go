@@ -0,0 +1,82 @@
+package jwks
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupportedAlgorithms(t *testing.T) {
+	for _, alg := range SupportedAlgorithms {
+		t.Run(alg.String(), func(t *testing.T) {
+			raw, err := generateRawKey(alg)
+			assert.NoError(t, err, "Key generation should succeed")
+
+			privateKey, err := jwk.FromRaw(raw)
+			assert.NoError(t, err)
+			privateKey.Set(jwk.AlgorithmKey, alg)
+
+			publicKey, err := privateKey.PublicKey()
+			assert.NoError(t, err)
+
+			// keys go through JSON when stored
+			privateJSON, err := json.Marshal(privateKey)
+			assert.NoError(t, err)
+			publicJSON, err := json.Marshal(publicKey)
+			assert.NoError(t, err)
+
+			storedPrivate, err := parsePrivateKey(privateJSON)
+			assert.NoError(t, err, "Stored private key should parse")
+			storedPrivate.Set(jwk.KeyIDKey, "kid") // like GetSigningKey
+			storedPublic, err := parsePublicKey(publicJSON, "kid")
+			assert.NoError(t, err, "Stored public key should parse")
+
+			token, err := jwt.NewBuilder().Subject("subject").Build()
+			assert.NoError(t, err)
+
+			signed, err := jwt.Sign(token, jwt.WithKey(storedPrivate.Algorithm(), storedPrivate))
+			assert.NoError(t, err, "Signing should succeed")
+
+			set := jwk.NewSet()
+			set.AddKey(storedPublic)
+
+			_, err = jwt.Parse(signed, jwt.WithKeySet(set))
+			assert.NoError(t, err, "Token should verify with the public key")
+		})
+	}
+}
+
+func TestKeyAlgorithm(t *testing.T) {
+	t.Run("Legacy key without alg is ES384", func(t *testing.T) {
+		raw, err := generateRawKey(jwa.ES384)
+		assert.NoError(t, err)
+
+		key, err := jwk.FromRaw(raw)
+		assert.NoError(t, err)
+
+		alg, err := keyAlgorithm(key)
+		assert.NoError(t, err)
+		assert.Equal(t, jwa.ES384, alg)
+	})
+
+	t.Run("Mismatched key type", func(t *testing.T) {
+		raw, err := generateRawKey(jwa.EdDSA)
+		assert.NoError(t, err)
+
+		key, err := jwk.FromRaw(raw)
+		assert.NoError(t, err)
+		key.Set(jwk.AlgorithmKey, jwa.RS256)
+
+		_, err = keyAlgorithm(key)
+		assert.Error(t, err)
+	})
+
+	t.Run("Unsupported algorithm", func(t *testing.T) {
+		_, err := ParseAlgorithm("HS256")
+		assert.Error(t, err)
+	})
+}
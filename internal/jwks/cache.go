@@ -0,0 +1,193 @@
+package jwks
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// CachingKeyStorage keeps the decrypted current key and the public keys of each service in memory.
+// Changes made through the cache invalidate it immediately, changes made by other instances are picked up after ttl.
+type CachingKeyStorage struct {
+	KeyStorage
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	services map[uuid.UUID]*cachedService
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cachedService struct {
+	generation uint64 // bumped on invalidation so in-flight loads don't store stale keys
+
+	current          *FullJWK
+	currentExpiresAt time.Time
+
+	public          []PublicJWK
+	publicExpiresAt time.Time
+
+	keySet          *KeySet
+	keySetExpiresAt time.Time
+}
+
+func NewCachingKeyStorage(storage KeyStorage, ttl time.Duration) *CachingKeyStorage {
+	return &CachingKeyStorage{
+		KeyStorage: storage,
+		ttl:        ttl,
+		now:        time.Now,
+		services:   make(map[uuid.UUID]*cachedService),
+	}
+}
+
+func (c *CachingKeyStorage) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+func (c *CachingKeyStorage) GetCurrentPrivateKey(ctx context.Context, serviceId uuid.UUID) (FullJWK, error) {
+	c.mu.Lock()
+	entry := c.entry(serviceId)
+	if entry.current != nil && c.now().Before(entry.currentExpiresAt) {
+		key := *entry.current
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return key, nil
+	}
+	generation := entry.generation
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+
+	key, err := c.KeyStorage.GetCurrentPrivateKey(ctx, serviceId)
+	if err != nil {
+		return FullJWK{}, err
+	}
+
+	c.mu.Lock()
+	if entry := c.entry(serviceId); entry.generation == generation {
+		entry.current = &key
+		entry.currentExpiresAt = c.now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+
+	return key, nil
+}
+
+func (c *CachingKeyStorage) GetPublicKeys(ctx context.Context, serviceId uuid.UUID) ([]PublicJWK, error) {
+	c.mu.Lock()
+	entry := c.entry(serviceId)
+	if entry.public != nil && c.now().Before(entry.publicExpiresAt) {
+		keys := entry.public
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return keys, nil
+	}
+	generation := entry.generation
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+
+	keys, err := c.KeyStorage.GetPublicKeys(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if entry := c.entry(serviceId); entry.generation == generation {
+		entry.public = append([]PublicJWK{}, keys...) // non-nil even without keys
+		entry.publicExpiresAt = c.now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+
+	return keys, nil
+}
+
+func (c *CachingKeyStorage) GetKeySet(ctx context.Context, serviceId uuid.UUID) (KeySet, error) {
+	c.mu.Lock()
+	entry := c.entry(serviceId)
+	if entry.keySet != nil && c.now().Before(entry.keySetExpiresAt) {
+		keySet := *entry.keySet
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return keySet, nil
+	}
+	generation := entry.generation
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+
+	keySet, err := c.KeyStorage.GetKeySet(ctx, serviceId)
+	if err != nil {
+		return KeySet{}, err
+	}
+
+	c.mu.Lock()
+	if entry := c.entry(serviceId); entry.generation == generation {
+		entry.keySet = &keySet
+		entry.keySetExpiresAt = c.now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+
+	return keySet, nil
+}
+
+func (c *CachingKeyStorage) StoreKey(ctx context.Context, serviceId uuid.UUID, key FullJWK) error {
+	defer c.Invalidate(serviceId)
+	return c.KeyStorage.StoreKey(ctx, serviceId, key)
+}
+
+func (c *CachingKeyStorage) DeleteKey(ctx context.Context, serviceId uuid.UUID, id string) error {
+	defer c.Invalidate(serviceId)
+	return c.KeyStorage.DeleteKey(ctx, serviceId, id)
+}
+
+func (c *CachingKeyStorage) SetCurrentKey(ctx context.Context, serviceId uuid.UUID, nextKey string) error {
+	defer c.Invalidate(serviceId)
+	return c.KeyStorage.SetCurrentKey(ctx, serviceId, nextKey)
+}
+
+func (c *CachingKeyStorage) RewrapKeys(ctx context.Context, kekId string, kek []byte) (int, error) {
+	defer c.InvalidateAll()
+	return c.KeyStorage.RewrapKeys(ctx, kekId, kek)
+}
+
+func (c *CachingKeyStorage) Invalidate(serviceId uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(serviceId)
+	*entry = cachedService{generation: entry.generation + 1}
+}
+
+func (c *CachingKeyStorage) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, entry := range c.services {
+		*entry = cachedService{generation: entry.generation + 1}
+	}
+}
+
+// callers must hold c.mu
+func (c *CachingKeyStorage) entry(serviceId uuid.UUID) *cachedService {
+	entry, ok := c.services[serviceId]
+	if !ok {
+		entry = &cachedService{}
+		c.services[serviceId] = entry
+	}
+
+	return entry
+}
@@ -0,0 +1,129 @@
+package jwks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingKeyStorage struct {
+	KeyStorage
+	currentKeyId string
+	currentLoads int
+	publicLoads  int
+	keySetLoads  int
+}
+
+func (s *countingKeyStorage) GetCurrentPrivateKey(ctx context.Context, serviceId uuid.UUID) (FullJWK, error) {
+	s.currentLoads++
+	return FullJWK{id: s.currentKeyId}, nil
+}
+
+func (s *countingKeyStorage) GetPublicKeys(ctx context.Context, serviceId uuid.UUID) ([]PublicJWK, error) {
+	s.publicLoads++
+	return []PublicJWK{{id: s.currentKeyId}}, nil
+}
+
+func (s *countingKeyStorage) GetKeySet(ctx context.Context, serviceId uuid.UUID) (KeySet, error) {
+	s.keySetLoads++
+	return KeySet{
+		Keys:   []PublicJWK{{id: s.currentKeyId}},
+		States: []KeyState{{Id: s.currentKeyId, Status: KeyStatusCurrent}},
+	}, nil
+}
+
+func (s *countingKeyStorage) SetCurrentKey(ctx context.Context, serviceId uuid.UUID, nextKey string) error {
+	s.currentKeyId = nextKey
+	return nil
+}
+
+func TestCachingKeyStorage(t *testing.T) {
+	ctx := context.Background()
+	serviceId := uuid.New()
+
+	t.Run("Hits within ttl", func(t *testing.T) {
+		storage := &countingKeyStorage{currentKeyId: "a"}
+		cache := NewCachingKeyStorage(storage, time.Minute)
+
+		for range 3 {
+			key, err := cache.GetCurrentPrivateKey(ctx, serviceId)
+			assert.NoError(t, err)
+			assert.Equal(t, "a", key.id)
+
+			_, err = cache.GetPublicKeys(ctx, serviceId)
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, 1, storage.currentLoads)
+		assert.Equal(t, 1, storage.publicLoads)
+		assert.Equal(t, CacheStats{Hits: 4, Misses: 2}, cache.Stats())
+	})
+
+	t.Run("Expires after ttl", func(t *testing.T) {
+		storage := &countingKeyStorage{currentKeyId: "a"}
+		cache := NewCachingKeyStorage(storage, time.Minute)
+
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		cache.GetCurrentPrivateKey(ctx, serviceId)
+		now = now.Add(time.Minute)
+		cache.GetCurrentPrivateKey(ctx, serviceId)
+
+		assert.Equal(t, 2, storage.currentLoads)
+	})
+
+	t.Run("SetCurrentKey invalidates", func(t *testing.T) {
+		storage := &countingKeyStorage{currentKeyId: "a"}
+		cache := NewCachingKeyStorage(storage, time.Minute)
+
+		cache.GetCurrentPrivateKey(ctx, serviceId)
+		cache.GetPublicKeys(ctx, serviceId)
+
+		assert.NoError(t, cache.SetCurrentKey(ctx, serviceId, "b"))
+
+		key, err := cache.GetCurrentPrivateKey(ctx, serviceId)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", key.id, "Promoted key should be used immediately")
+
+		keys, err := cache.GetPublicKeys(ctx, serviceId)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", keys[0].id)
+	})
+
+	t.Run("Key set and states are cached together", func(t *testing.T) {
+		storage := &countingKeyStorage{currentKeyId: "a"}
+		cache := NewCachingKeyStorage(storage, time.Minute)
+
+		for range 2 {
+			keySet, err := cache.GetKeySet(ctx, serviceId)
+			assert.NoError(t, err)
+			assert.Equal(t, "a", keySet.Keys[0].id)
+			assert.Equal(t, "a", keySet.States[0].Id)
+		}
+		assert.Equal(t, 1, storage.keySetLoads)
+
+		assert.NoError(t, cache.SetCurrentKey(ctx, serviceId, "b"))
+
+		keySet, err := cache.GetKeySet(ctx, serviceId)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", keySet.Keys[0].id)
+		assert.Equal(t, "b", keySet.States[0].Id)
+	})
+
+	t.Run("Services are cached separately", func(t *testing.T) {
+		storage := &countingKeyStorage{currentKeyId: "a"}
+		cache := NewCachingKeyStorage(storage, time.Minute)
+		otherServiceId := uuid.New()
+
+		cache.GetCurrentPrivateKey(ctx, serviceId)
+		cache.Invalidate(otherServiceId)
+		cache.GetCurrentPrivateKey(ctx, serviceId)
+		cache.GetCurrentPrivateKey(ctx, otherServiceId)
+
+		assert.Equal(t, 2, storage.currentLoads)
+	})
+}
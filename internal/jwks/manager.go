@@ -2,12 +2,10 @@ package jwks
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lestrrat-go/jwx/v2/jwk"
@@ -24,26 +22,28 @@ func NewJWKManager(storage KeyStorage) *JWKManager {
 	}
 }
 
+// CreateKey creates a future key with the algorithm currently configured for the service
 func (m *JWKManager) CreateKey(ctx context.Context, serviceId uuid.UUID) (keyId string, err error) {
 	keyId = ulid.Make().String()
 
-	raw, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
-
+	alg, err := m.storage.GetKeyAlgorithm(ctx, serviceId)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate new ECDSA private key: %w", err)
+		return "", fmt.Errorf("failed to get key algorithm: %w", err)
 	}
 
-	privateKey, err := jwk.FromRaw(raw)
+	raw, err := generateRawKey(alg)
+
 	if err != nil {
-		return "", fmt.Errorf("failed to create symmetric key: %w", err)
+		return "", fmt.Errorf("failed to generate new %s private key: %w", alg, err)
 	}
 
-	if _, ok := privateKey.(jwk.ECDSAPrivateKey); !ok {
-		return "", fmt.Errorf("expected jwk.ECDSAPrivateKey, got %T", privateKey)
+	privateKey, err := jwk.FromRaw(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to create private key: %w", err)
 	}
 
 	privateKey.Set(jwk.KeyUsageKey, jwk.ForSignature.String())
-	privateKey.Set(jwk.AlgorithmKey, "ES384")
+	privateKey.Set(jwk.AlgorithmKey, alg)
 
 	publicKey, err := privateKey.PublicKey()
 
@@ -51,14 +51,10 @@ func (m *JWKManager) CreateKey(ctx context.Context, serviceId uuid.UUID) (keyId
 		return "", fmt.Errorf("failed to get public key from private key: %w", err)
 	}
 
-	if _, ok := publicKey.(jwk.ECDSAPublicKey); !ok {
-		return "", fmt.Errorf("expected jwk.ECDSAPublicKey, got %T", publicKey)
-	}
-
 	fullJWK := FullJWK{
 		id:      keyId,
-		private: privateKey.(jwk.ECDSAPrivateKey),
-		public:  publicKey.(jwk.ECDSAPublicKey),
+		private: privateKey,
+		public:  publicKey,
 	}
 
 	err = m.storage.StoreKey(ctx, serviceId, fullJWK)
@@ -75,47 +71,121 @@ func (m *JWKManager) GetJWKS(ctx context.Context, serviceId uuid.UUID) (jwk.Set,
 		return nil, fmt.Errorf("failed to retrieve public keys: %w", err)
 	}
 
+	return newJWKSet(publicKeys), nil
+}
+
+// GetPublishedKeySet returns the JWKS together with the states it was read with,
+// so an ETag derived from the states always matches the keys that are served
+func (m *JWKManager) GetPublishedKeySet(ctx context.Context, serviceId uuid.UUID) (jwk.Set, []KeyState, error) {
+	keySet, err := m.storage.GetKeySet(ctx, serviceId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve key set: %w", err)
+	}
+
+	return newJWKSet(keySet.Keys), keySet.States, nil
+}
+
+func newJWKSet(publicKeys []PublicJWK) jwk.Set {
 	set := jwk.NewSet()
 
 	for _, publicKey := range publicKeys {
 		set.AddKey(publicKey.public)
 	}
 
-	return set, nil
+	return set
 }
 
-func (m *JWKManager) Rotate(ctx context.Context, serviceId uuid.UUID) error {
-	_, err := m.CreateKey(ctx, serviceId)
-
-	if err != nil {
-		return fmt.Errorf("failed to create a new key: %w", err)
+// Rotate promotes the upcoming key (creating one if there is none) and pre-creates the next future key so
+// verifiers can cache it before it is used. Retired keys are left for PruneRetired, tokens signed with them may still be valid.
+func (m *JWKManager) Rotate(ctx context.Context, serviceId uuid.UUID) (currentKeyId string, err error) {
+	if _, err := m.EnsureFutureKey(ctx, serviceId); err != nil {
+		return "", err
 	}
 
 	upcomingKeyId, err := m.storage.GetUpcomingKey(ctx, serviceId)
 
 	if err != nil {
-		return fmt.Errorf("failed to get upcoming key id: %w", err)
+		return "", fmt.Errorf("failed to get upcoming key id: %w", err)
 	}
 
 	err = m.storage.SetCurrentKey(ctx, serviceId, upcomingKeyId)
 
 	if err != nil {
-		return fmt.Errorf("failed to promote key: %w", err)
+		return "", fmt.Errorf("failed to promote key: %w", err)
 	}
 
-	oldestRetiredKeyId, err := m.storage.GetOldestRetired(ctx, serviceId)
+	if _, err := m.EnsureFutureKey(ctx, serviceId); err != nil {
+		return "", err
+	}
+
+	return upcomingKeyId, nil
+}
+
+// EnsureFutureKey creates a future key unless the service already has one with its configured algorithm.
+// Future keys of a previously configured algorithm have never signed anything, so they are deleted.
+func (m *JWKManager) EnsureFutureKey(ctx context.Context, serviceId uuid.UUID) (created bool, err error) {
+	states, err := m.storage.ListKeyStates(ctx, serviceId)
+	if err != nil {
+		return false, fmt.Errorf("failed to get key states: %w", err)
+	}
 
+	alg, err := m.storage.GetKeyAlgorithm(ctx, serviceId)
 	if err != nil {
-		return fmt.Errorf("failed to get oldest retired key: %w", err)
+		return false, fmt.Errorf("failed to get key algorithm: %w", err)
+	}
+
+	hasFutureKey := false
+	for _, state := range states {
+		if state.Status != KeyStatusFuture {
+			continue
+		}
+
+		key, err := m.storage.GetPublic(ctx, serviceId, state.Id)
+		if err != nil {
+			return false, fmt.Errorf("failed to get future key: %w", err)
+		}
+
+		if key.public.Algorithm().String() == alg.String() {
+			hasFutureKey = true
+			continue
+		}
+
+		if err := m.storage.DeleteKey(ctx, serviceId, state.Id); err != nil {
+			return false, fmt.Errorf("failed to remove future key with outdated algorithm: %w", err)
+		}
 	}
 
-	err = m.storage.DeleteKey(ctx, serviceId, oldestRetiredKeyId)
+	if hasFutureKey {
+		return false, nil
+	}
+
+	if _, err := m.CreateKey(ctx, serviceId); err != nil {
+		return false, fmt.Errorf("failed to create a new key: %w", err)
+	}
 
+	return true, nil
+}
+
+// PruneRetired deletes keys that have been retired for longer than retention
+func (m *JWKManager) PruneRetired(ctx context.Context, serviceId uuid.UUID, retention time.Duration) (deleted []string, err error) {
+	states, err := m.storage.ListKeyStates(ctx, serviceId)
 	if err != nil {
-		return fmt.Errorf("failed to remove oldest retired key: %w", err)
+		return nil, fmt.Errorf("failed to get key states: %w", err)
 	}
 
-	return nil
+	for _, state := range states {
+		if state.Status != KeyStatusRetired || time.Since(state.ChangedAt) < retention {
+			continue
+		}
+
+		if err := m.storage.DeleteKey(ctx, serviceId, state.Id); err != nil {
+			return deleted, fmt.Errorf("failed to remove retired key: %w", err)
+		}
+
+		deleted = append(deleted, state.Id)
+	}
+
+	return deleted, nil
 }
 
 func (m *JWKManager) Remove(ctx context.Context, serviceId uuid.UUID, id string) error {
@@ -143,6 +213,9 @@ func (m *JWKManager) Export(ctx context.Context, serviceId uuid.UUID, id string)
 	return fullKey.private, nil
 }
 
+// GetSigningKey returns the current private key of the service, sign with the algorithm of the key:
+//
+//	jwt.Sign(token, jwt.WithKey(key.Algorithm(), key))
 func (m *JWKManager) GetSigningKey(ctx context.Context, serviceId uuid.UUID) (jwk.Key, error) {
 	key, err := m.storage.GetCurrentPrivateKey(ctx, serviceId)
 	if err == nil {
@@ -187,3 +260,22 @@ func (m *JWKManager) promoteUpcomingKey(ctx context.Context, serviceId uuid.UUID
 func (m *JWKManager) KeyStatus(ctx context.Context, serviceId uuid.UUID) (map[string]string, error) {
 	return m.storage.GetKeyStates(ctx, serviceId)
 }
+
+func (m *JWKManager) ListKeyStates(ctx context.Context, serviceId uuid.UUID) ([]KeyState, error) {
+	return m.storage.ListKeyStates(ctx, serviceId)
+}
+
+// RewrapKeys re-encrypts the private keys of every service with a new key encryption key
+func (m *JWKManager) RewrapKeys(ctx context.Context, kekId string, kek []byte) (int, error) {
+	return m.storage.RewrapKeys(ctx, kekId, kek)
+}
+
+// CacheStats returns false when the storage is not cached
+func (m *JWKManager) CacheStats() (CacheStats, bool) {
+	cache, ok := m.storage.(*CachingKeyStorage)
+	if !ok {
+		return CacheStats{}, false
+	}
+
+	return cache.Stats(), true
+}
@@ -0,0 +1,143 @@
+package jwks
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/services"
+)
+
+// rotatorLockKey is the postgres advisory lock that lets one instance at a time apply the rotation policies
+const rotatorLockKey int64 = 0x6b75757261 // "kuura"
+
+// Rotator applies each service's JWK rotation policy in the background
+type Rotator struct {
+	logger         *slog.Logger
+	db             *db_gen.Queries
+	manager        *JWKManager
+	services       *services.ServiceManager
+	checkInterval  time.Duration
+	minKeyLifetime time.Duration // longest lifetime of tokens that don't depend on service settings
+}
+
+func NewRotator(logger *slog.Logger, queries *db_gen.Queries, manager *JWKManager, serviceManager *services.ServiceManager, checkInterval time.Duration, minKeyLifetime time.Duration) *Rotator {
+	return &Rotator{
+		logger:         logger,
+		db:             queries,
+		manager:        manager,
+		services:       serviceManager,
+		checkInterval:  checkInterval,
+		minKeyLifetime: minKeyLifetime,
+	}
+}
+
+// Run blocks until ctx is cancelled
+func (r *Rotator) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		r.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce skips the run when another instance is applying the policies, every instance runs the rotator
+func (r *Rotator) RunOnce(ctx context.Context) {
+	// the transaction only holds the lock, the rotation itself runs outside of it
+	err := r.db.InTx(ctx, func(tx *db_gen.Queries) error {
+		locked, err := tx.TryAdvisoryXactLock(ctx, rotatorLockKey)
+		if err != nil {
+			return err
+		}
+
+		if !locked {
+			r.logger.Debug("Key rotation is running on another instance")
+			return nil
+		}
+
+		r.applyPolicies(ctx)
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("Failed to lock key rotation", slog.String("error", err.Error()))
+	}
+}
+
+// WithRotationLock waits for the rotator lock and holds it while fn runs, so a manual rotation can't race the rotator
+func WithRotationLock(ctx context.Context, queries *db_gen.Queries, fn func() error) error {
+	// like RunOnce, the transaction only holds the lock
+	return queries.InTx(ctx, func(tx *db_gen.Queries) error {
+		if err := tx.AdvisoryXactLock(ctx, rotatorLockKey); err != nil {
+			return err
+		}
+
+		return fn()
+	})
+}
+
+func (r *Rotator) applyPolicies(ctx context.Context) {
+	appServices, err := r.services.GetServices(ctx)
+	if err != nil {
+		r.logger.Error("Failed to list services for key rotation", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, service := range appServices {
+		if err := r.applyPolicy(ctx, service); err != nil {
+			r.logger.Error("Failed to apply key rotation policy",
+				slog.String("service_id", service.Id.String()),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+func (r *Rotator) applyPolicy(ctx context.Context, service *models.AppService) error {
+	if service.JWKRotationInterval <= 0 {
+		return nil
+	}
+
+	states, err := r.manager.ListKeyStates(ctx, service.Id)
+	if err != nil {
+		return err
+	}
+
+	var current *KeyState
+	for i, state := range states {
+		if state.Status == KeyStatusCurrent && (current == nil || state.ChangedAt.After(current.ChangedAt)) {
+			current = &states[i]
+		}
+	}
+
+	if current == nil || time.Since(current.ChangedAt) >= service.JWKRotationInterval {
+		keyId, err := r.manager.Rotate(ctx, service.Id)
+		if err != nil {
+			return err
+		}
+
+		r.logger.Info("Rotated signing key", slog.String("service_id", service.Id.String()), slog.String("key_id", keyId))
+	} else if created, err := r.manager.EnsureFutureKey(ctx, service.Id); err != nil {
+		return err
+	} else if created {
+		r.logger.Info("Created future signing key", slog.String("service_id", service.Id.String()))
+	}
+
+	// a retired key must stay published until every token it signed has expired
+	retention := max(service.JWKRetirementPeriod, service.AccessTokenDuration, r.minKeyLifetime)
+
+	deleted, err := r.manager.PruneRetired(ctx, service.Id, retention)
+	if len(deleted) > 0 {
+		r.logger.Info("Deleted retired signing keys", slog.String("service_id", service.Id.String()), slog.Any("key_ids", deleted))
+	}
+
+	return err
+}
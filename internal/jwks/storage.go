@@ -1,6 +1,7 @@
 package jwks
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -13,22 +14,41 @@ import (
 	"github.com/kymppi/kuura/internal/db_gen"
 	jwk_storage "github.com/kymppi/kuura/internal/encrypted_storage"
 	"github.com/kymppi/kuura/internal/utils"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 )
 
 type FullJWK struct {
 	id        string
-	public    jwk.ECDSAPublicKey
-	private   jwk.ECDSAPrivateKey
+	public    jwk.Key
+	private   jwk.Key
 	createdAt time.Time // ignored when used as a param for StoreKey
 }
 
 type PublicJWK struct {
 	id        string
-	public    jwk.ECDSAPublicKey
+	public    jwk.Key
 	createdAt time.Time
 }
 
+const (
+	KeyStatusFuture  = "future"
+	KeyStatusCurrent = "current"
+	KeyStatusRetired = "retired"
+)
+
+type KeyState struct {
+	Id        string
+	Status    string // future | current | retired
+	ChangedAt time.Time
+}
+
+// KeySet is the published keys of a service with their states, both read at the same time
+type KeySet struct {
+	Keys   []PublicJWK
+	States []KeyState
+}
+
 type KeyStorage interface {
 	StoreKey(ctx context.Context, serviceId uuid.UUID, key FullJWK) error
 	GetPublic(ctx context.Context, serviceId uuid.UUID, id string) (PublicJWK, error)
@@ -40,20 +60,33 @@ type KeyStorage interface {
 	GetUpcomingKey(ctx context.Context, serviceId uuid.UUID) (id string, err error)
 	GetOldestRetired(ctx context.Context, serviceId uuid.UUID) (id string, err error)
 	GetKeyStates(ctx context.Context, serviceId uuid.UUID) (map[string]string, error)
+	ListKeyStates(ctx context.Context, serviceId uuid.UUID) ([]KeyState, error)
+	GetKeySet(ctx context.Context, serviceId uuid.UUID) (KeySet, error)
+	GetKeyAlgorithm(ctx context.Context, serviceId uuid.UUID) (jwa.SignatureAlgorithm, error)
+	RewrapKeys(ctx context.Context, kekId string, kek []byte) (rewrapped int, err error)
 }
 
+// PostgresQLKeyStorage encrypts private keys with the current key encryption key (KEK),
+// keys sealed with any other configured KEK can still be decrypted
 type PostgresQLKeyStorage struct {
-	db            *db_gen.Queries
-	encryptor     *jwk_storage.SymmetricKeyEncryptor
-	encryptionKey []byte
+	db           *db_gen.Queries
+	encryptor    *jwk_storage.SymmetricKeyEncryptor
+	currentKekId string
+	keks         map[string][]byte
 }
 
-func NewPostgresQLKeyStorage(databaseQueries *db_gen.Queries, encryptionKey []byte) *PostgresQLKeyStorage {
-	return &PostgresQLKeyStorage{
-		db:            databaseQueries,
-		encryptor:     jwk_storage.NewSymmetricKeyEncryptor(),
-		encryptionKey: encryptionKey,
+// keks must contain currentKekId
+func NewPostgresQLKeyStorage(databaseQueries *db_gen.Queries, currentKekId string, keks map[string][]byte) (*PostgresQLKeyStorage, error) {
+	if _, ok := keks[currentKekId]; !ok {
+		return nil, fmt.Errorf("current key encryption key %q is not configured", currentKekId)
 	}
+
+	return &PostgresQLKeyStorage{
+		db:           databaseQueries,
+		encryptor:    jwk_storage.NewSymmetricKeyEncryptor(),
+		currentKekId: currentKekId,
+		keks:         keks,
+	}, nil
 }
 
 func (ks *PostgresQLKeyStorage) StoreKey(ctx context.Context, serviceId uuid.UUID, key FullJWK) error {
@@ -62,7 +95,7 @@ func (ks *PostgresQLKeyStorage) StoreKey(ctx context.Context, serviceId uuid.UUI
 		return fmt.Errorf("failed to serialize private key: %w", err)
 	}
 
-	encryptedPrivateKey, nonce, err := ks.encryptor.Encrypt(privateKeyJSON, ks.encryptionKey)
+	encryptedPrivateKey, nonce, err := ks.encryptor.Encrypt(privateKeyJSON, ks.keks[ks.currentKekId])
 	if err != nil {
 		return fmt.Errorf("failed to encrypt private key: %w", err)
 	}
@@ -78,6 +111,7 @@ func (ks *PostgresQLKeyStorage) StoreKey(ctx context.Context, serviceId uuid.UUI
 		Nonce:            nonce,               // IV
 		KeyData:          publicKeyJSON,       // public key as json
 		ServiceID:        utils.UUIDToPgType(serviceId),
+		KekID:            ks.currentKekId,
 	})
 
 	if err != nil {
@@ -150,9 +184,9 @@ func (ks *PostgresQLKeyStorage) GetPrivate(ctx context.Context, serviceId uuid.U
 		return FullJWK{}, handlePgError("GetPrivate", err, id)
 	}
 
-	decryptedPrivateKey, err := ks.encryptor.Decrypt(row.EncryptedKeyData, ks.encryptionKey, row.Nonce)
+	decryptedPrivateKey, err := ks.decrypt(row.EncryptedKeyData, row.Nonce, row.KekID)
 	if err != nil {
-		return FullJWK{}, fmt.Errorf("failed to decrypt private key: %w", err)
+		return FullJWK{}, err
 	}
 
 	privateKey, err := parsePrivateKey(decryptedPrivateKey)
@@ -180,9 +214,9 @@ func (ks *PostgresQLKeyStorage) GetCurrentPrivateKey(ctx context.Context, servic
 		return FullJWK{}, handlePgError("GetCurrentPrivate", err, serviceId.String())
 	}
 
-	decryptedPrivateKey, err := ks.encryptor.Decrypt(row.EncryptedKeyData, ks.encryptionKey, row.Nonce)
+	decryptedPrivateKey, err := ks.decrypt(row.EncryptedKeyData, row.Nonce, row.KekID)
 	if err != nil {
-		return FullJWK{}, fmt.Errorf("failed to decrypt private key: %w", err)
+		return FullJWK{}, err
 	}
 
 	privateKey, err := parsePrivateKey(decryptedPrivateKey)
@@ -203,24 +237,37 @@ func (ks *PostgresQLKeyStorage) GetCurrentPrivateKey(ctx context.Context, servic
 	}, nil
 }
 
+// DeleteKey removes the key's state before the key itself, the state references the private key with ON DELETE RESTRICT
 func (ks *PostgresQLKeyStorage) DeleteKey(ctx context.Context, serviceId uuid.UUID, id string) error {
-	err := ks.db.DeleteJWKPublic(ctx, db_gen.DeleteJWKPublicParams{
-		ID:        id,
-		ServiceID: utils.UUIDToPgType(serviceId),
-	})
-	if err != nil {
-		return handlePgError("DeleteJWKPublic", err, id)
-	}
+	return ks.db.InTx(ctx, func(db *db_gen.Queries) error {
+		deleted, err := db.DeleteServiceKeyState(ctx, db_gen.DeleteServiceKeyStateParams{
+			ServiceID:    utils.UUIDToPgType(serviceId),
+			JwkPrivateID: id,
+		})
+		if err != nil {
+			return handlePgError("DeleteServiceKeyState", err, id)
+		} else if deleted == 0 {
+			return fmt.Errorf("DeleteKey: key with ID %s not found in service %s", id, serviceId)
+		}
 
-	err = ks.db.DeleteJWKPrivate(ctx, db_gen.DeleteJWKPrivateParams{
-		ID:        id,
-		ServiceID: utils.UUIDToPgType(serviceId),
-	})
-	if err != nil {
-		return handlePgError("DeleteJWKPrivate", err, id)
-	}
+		err = db.DeleteJWKPublic(ctx, db_gen.DeleteJWKPublicParams{
+			ID:        id,
+			ServiceID: utils.UUIDToPgType(serviceId),
+		})
+		if err != nil {
+			return handlePgError("DeleteJWKPublic", err, id)
+		}
 
-	return nil
+		err = db.DeleteJWKPrivate(ctx, db_gen.DeleteJWKPrivateParams{
+			ID:        id,
+			ServiceID: utils.UUIDToPgType(serviceId),
+		})
+		if err != nil {
+			return handlePgError("DeleteJWKPrivate", err, id)
+		}
+
+		return nil
+	})
 }
 
 func (ks *PostgresQLKeyStorage) SetCurrentKey(ctx context.Context, serviceId uuid.UUID, nextKey string) error {
@@ -289,6 +336,145 @@ func (ks *PostgresQLKeyStorage) GetKeyStates(ctx context.Context, serviceId uuid
 	return statusMap, nil
 }
 
+func (ks *PostgresQLKeyStorage) ListKeyStates(ctx context.Context, serviceId uuid.UUID) ([]KeyState, error) {
+	data, err := ks.db.GetKeyStatus(ctx, utils.UUIDToPgType(serviceId))
+
+	if err != nil {
+		return nil, handlePgError("ListKeyStates", err, "")
+	}
+
+	states := make([]KeyState, 0, len(data))
+	for _, row := range data {
+		states = append(states, KeyState{
+			Id:        row.JwkPrivateID,
+			Status:    row.Status,
+			ChangedAt: row.StatusChangedAt.Time,
+		})
+	}
+
+	return states, nil
+}
+
+func (ks *PostgresQLKeyStorage) GetKeySet(ctx context.Context, serviceId uuid.UUID) (KeySet, error) {
+	rows, err := ks.db.GetKeySet(ctx, utils.UUIDToPgType(serviceId))
+	if err != nil {
+		return KeySet{}, handlePgError("GetKeySet", err, "")
+	}
+
+	keySet := KeySet{
+		Keys:   make([]PublicJWK, 0, len(rows)),
+		States: make([]KeyState, 0, len(rows)),
+	}
+	for _, row := range rows {
+		publicKey, err := parsePublicKey(row.KeyData, row.ID)
+		if err != nil {
+			return KeySet{}, fmt.Errorf("failed to deserialize public key with ID %s: %w", row.ID, err)
+		}
+
+		keySet.Keys = append(keySet.Keys, PublicJWK{
+			id:     row.ID,
+			public: publicKey,
+		})
+		keySet.States = append(keySet.States, KeyState{
+			Id:        row.ID,
+			Status:    row.Status,
+			ChangedAt: row.StatusChangedAt.Time,
+		})
+	}
+
+	return keySet, nil
+}
+
+// GetKeyAlgorithm returns the algorithm new keys of the service should use
+func (ks *PostgresQLKeyStorage) GetKeyAlgorithm(ctx context.Context, serviceId uuid.UUID) (jwa.SignatureAlgorithm, error) {
+	name, err := ks.db.GetServiceJWKAlgorithm(ctx, utils.UUIDToPgType(serviceId))
+	if err != nil {
+		return "", handlePgError("GetKeyAlgorithm", err, "")
+	}
+
+	return ParseAlgorithm(name)
+}
+
+// RewrapKeys re-encrypts every private key with kek in one transaction, so either all keys move to the new KEK or none do.
+// Keys can't be created or changed while it runs, which makes sure no key is left behind under the old KEK.
+func (ks *PostgresQLKeyStorage) RewrapKeys(ctx context.Context, kekId string, kek []byte) (int, error) {
+	if configured, ok := ks.keks[kekId]; ok && !bytes.Equal(configured, kek) {
+		return 0, fmt.Errorf("key encryption key id %q is already used by a different key", kekId)
+	}
+
+	var rewrapped int64
+
+	err := ks.db.InTx(ctx, func(db *db_gen.Queries) error {
+		if err := db.LockJWKPrivateInserts(ctx); err != nil {
+			return handlePgError("RewrapKeys", err, "")
+		}
+
+		rows, err := db.GetAllJWKPrivate(ctx)
+		if err != nil {
+			return handlePgError("RewrapKeys", err, "")
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		params := db_gen.RewrapJWKPrivateParams{
+			KekID:            kekId,
+			Ids:              make([]string, 0, len(rows)),
+			EncryptedKeyData: make([][]byte, 0, len(rows)),
+			Nonces:           make([][]byte, 0, len(rows)),
+			PreviousNonces:   make([][]byte, 0, len(rows)),
+		}
+
+		for _, row := range rows {
+			privateKey, err := ks.decrypt(row.EncryptedKeyData, row.Nonce, row.KekID)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", row.ID, err)
+			}
+
+			encryptedPrivateKey, nonce, err := ks.encryptor.Encrypt(privateKey, kek)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt private key %s: %w", row.ID, err)
+			}
+
+			params.Ids = append(params.Ids, row.ID)
+			params.EncryptedKeyData = append(params.EncryptedKeyData, encryptedPrivateKey)
+			params.Nonces = append(params.Nonces, nonce)
+			params.PreviousNonces = append(params.PreviousNonces, row.Nonce)
+		}
+
+		rewrapped, err = db.RewrapJWKPrivate(ctx, params)
+		if err != nil {
+			return handlePgError("RewrapKeys", err, "")
+		}
+
+		if rewrapped != int64(len(rows)) {
+			return fmt.Errorf("rewrapped %d of %d keys, nothing was changed", rewrapped, len(rows))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rewrapped), nil
+}
+
+func (ks *PostgresQLKeyStorage) decrypt(encryptedPrivateKey []byte, nonce []byte, kekId string) ([]byte, error) {
+	kek, ok := ks.keks[kekId]
+	if !ok {
+		return nil, fmt.Errorf("private key is encrypted with unknown key encryption key %q", kekId)
+	}
+
+	decryptedPrivateKey, err := ks.encryptor.Decrypt(encryptedPrivateKey, kek, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+
+	return decryptedPrivateKey, nil
+}
+
 func handlePgError(operation string, err error, id string) error {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
@@ -307,36 +493,32 @@ func handlePgError(operation string, err error, id string) error {
 	return fmt.Errorf("%s: error with key ID %s: %w", operation, id, err)
 }
 
-func parsePublicKey(keyData []byte, id string) (jwk.ECDSAPublicKey, error) {
+func parsePublicKey(keyData []byte, id string) (jwk.Key, error) {
 	publicKey, err := jwk.ParseKey(keyData)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse public key: %w", err)
 	}
 
-	ecPublicKey, ok := publicKey.(jwk.ECDSAPublicKey)
-
-	if !ok {
-		return nil, errors.New("public key is not ECDSA")
+	if _, err := keyAlgorithm(publicKey); err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
 	}
 
-	ecPublicKey.Set("kid", id)
+	publicKey.Set("kid", id)
 
-	return ecPublicKey, nil
+	return publicKey, nil
 }
 
-func parsePrivateKey(keyData []byte) (jwk.ECDSAPrivateKey, error) {
+func parsePrivateKey(keyData []byte) (jwk.Key, error) {
 	privateKey, err := jwk.ParseKey(keyData)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
 
-	ecPublicKey, ok := privateKey.(jwk.ECDSAPrivateKey)
-
-	if !ok {
-		return nil, errors.New("private key is not ECDSA")
+	if _, err := keyAlgorithm(privateKey); err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
 	}
 
-	return ecPublicKey, nil
+	return privateKey, nil
 }
@@ -0,0 +1,172 @@
+package jwks
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/services"
+	"github.com/kymppi/kuura/internal/settings"
+	"github.com/kymppi/kuura/internal/testdb"
+	"github.com/kymppi/kuura/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestManager(t *testing.T) (*JWKManager, *db_gen.Queries, uuid.UUID) {
+	t.Helper()
+
+	ctx := context.Background()
+	queries := testdb.New(t)
+
+	serviceId := uuid.Must(uuid.NewV7())
+	if err := queries.CreateAppService(ctx, db_gen.CreateAppServiceParams{
+		ID:            utils.UUIDToPgType(serviceId),
+		JwtAudience:   "test",
+		Name:          "test",
+		LoginRedirect: "https://example.com",
+	}); err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+
+	kek := make([]byte, 32)
+	rand.Read(kek)
+
+	storage, err := NewPostgresQLKeyStorage(queries, "test", map[string][]byte{"test": kek})
+	if err != nil {
+		t.Fatalf("failed to create key storage: %s", err)
+	}
+
+	return NewJWKManager(storage), queries, serviceId
+}
+
+func keyIds(t *testing.T, manager *JWKManager, serviceId uuid.UUID) []string {
+	t.Helper()
+
+	states, err := manager.ListKeyStates(context.Background(), serviceId)
+	if err != nil {
+		t.Fatalf("failed to list key states: %s", err)
+	}
+
+	ids := make([]string, 0, len(states))
+	for _, state := range states {
+		ids = append(ids, state.Id)
+	}
+
+	return ids
+}
+
+func TestPruneRetired(t *testing.T) {
+	ctx := context.Background()
+	manager, _, serviceId := newTestManager(t)
+
+	retired, err := manager.Rotate(ctx, serviceId)
+	assert.NoError(t, err)
+
+	current, err := manager.Rotate(ctx, serviceId)
+	assert.NoError(t, err)
+
+	deleted, err := manager.PruneRetired(ctx, serviceId, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{retired}, deleted)
+
+	assert.NotContains(t, keyIds(t, manager, serviceId), retired)
+	assert.Contains(t, keyIds(t, manager, serviceId), current)
+
+	set, err := manager.GetJWKS(ctx, serviceId)
+	assert.NoError(t, err)
+	_, published := set.LookupKeyID(retired)
+	assert.False(t, published)
+
+	t.Run("Nothing left to prune", func(t *testing.T) {
+		deleted, err := manager.PruneRetired(ctx, serviceId, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, deleted)
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		assert.Error(t, manager.Remove(ctx, serviceId, retired))
+	})
+}
+
+func TestAlgorithmChange(t *testing.T) {
+	ctx := context.Background()
+	manager, queries, serviceId := newTestManager(t)
+
+	_, err := manager.Rotate(ctx, serviceId)
+	assert.NoError(t, err)
+
+	// each change replaces the future key that was created with the previous algorithm
+	for _, alg := range []string{"RS256", "EdDSA"} {
+		err := queries.UpdateServiceJWKAlgorithm(ctx, db_gen.UpdateServiceJWKAlgorithmParams{
+			ID:           utils.UUIDToPgType(serviceId),
+			JwkAlgorithm: alg,
+		})
+		assert.NoError(t, err)
+
+		created, err := manager.EnsureFutureKey(ctx, serviceId)
+		assert.NoError(t, err)
+		assert.True(t, created)
+		assert.Len(t, keyIds(t, manager, serviceId), 2)
+	}
+
+	current, err := manager.Rotate(ctx, serviceId)
+	assert.NoError(t, err)
+
+	signingKey, err := manager.GetSigningKey(ctx, serviceId)
+	assert.NoError(t, err)
+	assert.Equal(t, current, signingKey.KeyID())
+	assert.Equal(t, "EdDSA", signingKey.Algorithm().String())
+
+	// retired, current and the next future key
+	assert.Len(t, keyIds(t, manager, serviceId), 3)
+}
+
+func TestRewrapKeys(t *testing.T) {
+	ctx := context.Background()
+	manager, queries, serviceId := newTestManager(t)
+
+	_, err := manager.Rotate(ctx, serviceId)
+	assert.NoError(t, err)
+
+	newKek := make([]byte, 32)
+	rand.Read(newKek)
+
+	rewrapped, err := manager.RewrapKeys(ctx, "new", newKek)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rewrapped) // current and future
+
+	// the old KEK can be removed once every key has been rewrapped
+	storage, err := NewPostgresQLKeyStorage(queries, "new", map[string][]byte{"new": newKek})
+	assert.NoError(t, err)
+
+	_, err = NewJWKManager(storage).GetSigningKey(ctx, serviceId)
+	assert.NoError(t, err)
+}
+
+func TestRotatorLock(t *testing.T) {
+	ctx := context.Background()
+	manager, queries, serviceId := newTestManager(t)
+
+	logger := slog.New(slog.DiscardHandler)
+	serviceManager := services.NewServiceManager(logger, queries, settings.NewSettingsService(logger, queries))
+	rotator := NewRotator(logger, queries, manager, serviceManager, 0, 0)
+
+	// another instance holding the lock
+	err := queries.InTx(ctx, func(tx *db_gen.Queries) error {
+		locked, err := tx.TryAdvisoryXactLock(ctx, rotatorLockKey)
+		assert.NoError(t, err)
+		assert.True(t, locked)
+
+		rotator.RunOnce(ctx)
+		assert.Empty(t, keyIds(t, manager, serviceId))
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	rotator.RunOnce(ctx)
+	assert.NotEmpty(t, keyIds(t, manager, serviceId))
+}
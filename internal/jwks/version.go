@@ -0,0 +1,76 @@
+package jwks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// JWKSMaxAge is how long verifiers may cache a key set while no rotation is near
+	JWKSMaxAge = 10 * time.Minute
+	// JWKSMinMaxAge is used while a future key is about to be promoted
+	JWKSMinMaxAge = time.Minute
+)
+
+// KeySetETag identifies the published keys of a service and their states.
+// It is weak, the order of keys in the serialized set is not stable.
+func KeySetETag(states []KeyState) string {
+	sorted := slices.Clone(states)
+	slices.SortFunc(sorted, func(a, b KeyState) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	hash := sha256.New()
+	for _, state := range sorted {
+		fmt.Fprintf(hash, "%s:%s\n", state.Id, state.Status)
+	}
+
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(hash.Sum(nil)[:16]))
+}
+
+// KeySetLastModified returns the zero time when the service has no keys
+func KeySetLastModified(states []KeyState) time.Time {
+	var lastModified time.Time
+	for _, state := range states {
+		if state.ChangedAt.After(lastModified) {
+			lastModified = state.ChangedAt
+		}
+	}
+
+	return lastModified
+}
+
+// KeySetMaxAge shortens caching as the next promotion of the service's future key approaches
+func KeySetMaxAge(states []KeyState, rotationInterval time.Duration, now time.Time) time.Duration {
+	if rotationInterval <= 0 {
+		return JWKSMaxAge
+	}
+
+	var (
+		current   *KeyState
+		hasFuture bool
+	)
+	for i, state := range states {
+		switch state.Status {
+		case KeyStatusCurrent:
+			if current == nil || state.ChangedAt.After(current.ChangedAt) {
+				current = &states[i]
+			}
+		case KeyStatusFuture:
+			hasFuture = true
+		}
+	}
+
+	// the key set is about to change, either on the first signing or by the rotator
+	if current == nil || !hasFuture {
+		return JWKSMinMaxAge
+	}
+
+	untilPromotion := current.ChangedAt.Add(rotationInterval).Sub(now)
+
+	return min(max(untilPromotion, JWKSMinMaxAge), JWKSMaxAge)
+}
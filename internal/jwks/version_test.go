@@ -0,0 +1,72 @@
+package jwks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySetETag(t *testing.T) {
+	states := []KeyState{
+		{Id: "a", Status: KeyStatusCurrent},
+		{Id: "b", Status: KeyStatusFuture},
+	}
+
+	t.Run("Stable regardless of order", func(t *testing.T) {
+		reversed := []KeyState{states[1], states[0]}
+		assert.Equal(t, KeySetETag(states), KeySetETag(reversed))
+	})
+
+	t.Run("Changes with state", func(t *testing.T) {
+		promoted := []KeyState{
+			{Id: "a", Status: KeyStatusRetired},
+			{Id: "b", Status: KeyStatusCurrent},
+		}
+		assert.NotEqual(t, KeySetETag(states), KeySetETag(promoted))
+	})
+
+	t.Run("Changes with keys", func(t *testing.T) {
+		assert.NotEqual(t, KeySetETag(states), KeySetETag(states[:1]))
+	})
+}
+
+func TestKeySetMaxAge(t *testing.T) {
+	now := time.Now()
+	interval := 30 * 24 * time.Hour
+
+	t.Run("Far from rotation", func(t *testing.T) {
+		states := []KeyState{
+			{Id: "a", Status: KeyStatusCurrent, ChangedAt: now.Add(-time.Hour)},
+			{Id: "b", Status: KeyStatusFuture, ChangedAt: now.Add(-time.Hour)},
+		}
+		assert.Equal(t, JWKSMaxAge, KeySetMaxAge(states, interval, now))
+	})
+
+	t.Run("Promotion approaching", func(t *testing.T) {
+		states := []KeyState{
+			{Id: "a", Status: KeyStatusCurrent, ChangedAt: now.Add(-interval + 5*time.Minute)},
+			{Id: "b", Status: KeyStatusFuture, ChangedAt: now.Add(-interval)},
+		}
+		assert.Equal(t, 5*time.Minute, KeySetMaxAge(states, interval, now))
+	})
+
+	t.Run("Promotion overdue", func(t *testing.T) {
+		states := []KeyState{
+			{Id: "a", Status: KeyStatusCurrent, ChangedAt: now.Add(-2 * interval)},
+			{Id: "b", Status: KeyStatusFuture, ChangedAt: now.Add(-2 * interval)},
+		}
+		assert.Equal(t, JWKSMinMaxAge, KeySetMaxAge(states, interval, now))
+	})
+
+	t.Run("No future key", func(t *testing.T) {
+		states := []KeyState{
+			{Id: "a", Status: KeyStatusCurrent, ChangedAt: now},
+		}
+		assert.Equal(t, JWKSMinMaxAge, KeySetMaxAge(states, interval, now))
+	})
+
+	t.Run("Rotation disabled", func(t *testing.T) {
+		assert.Equal(t, JWKSMaxAge, KeySetMaxAge(nil, 0, now))
+	})
+}
@@ -0,0 +1,112 @@
+package kek
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeySize of every key encryption key, AES-256
+const KeySize = 32
+
+// Provider loads a key encryption key (KEK)
+type Provider interface {
+	Key(ctx context.Context) ([]byte, error)
+}
+
+// ParseSource builds a provider from a key source:
+//
+//	/var/kuura/.kek or file:/var/kuura/.kek  raw key in a file
+//	env:KUURA_KEK                            base64 encoded key in an environment variable
+//	systemd:kuura-kek                        raw key passed with systemd's LoadCredential=
+//	transit:vault:v1:...                     key wrapped by a Vault transit compatible API
+//
+// transit may be nil when transit sources are not used
+func ParseSource(source string, transit *TransitClient) (Provider, error) {
+	scheme, value, found := strings.Cut(source, ":")
+	if !found {
+		return &FileProvider{Path: source}, nil
+	}
+
+	switch scheme {
+	case "file":
+		return &FileProvider{Path: value}, nil
+	case "env":
+		return &EnvProvider{Variable: value}, nil
+	case "systemd":
+		return &SystemdCredentialProvider{Name: value}, nil
+	case "transit":
+		if transit == nil {
+			return nil, errors.New("transit key source requires VAULT_ADDR and VAULT_TOKEN")
+		}
+		return &TransitProvider{Client: transit, Ciphertext: value}, nil
+	default:
+		return &FileProvider{Path: source}, nil
+	}
+}
+
+type FileProvider struct {
+	Path string
+}
+
+func (p *FileProvider) Key(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+	}
+
+	return validateKey(data)
+}
+
+type EnvProvider struct {
+	Variable string
+}
+
+func (p *EnvProvider) Key(ctx context.Context) ([]byte, error) {
+	value, ok := os.LookupEnv(p.Variable)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", p.Variable)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s is not valid base64: %w", p.Variable, err)
+	}
+
+	return validateKey(data)
+}
+
+// SystemdCredentialProvider reads a credential from $CREDENTIALS_DIRECTORY, see systemd.exec(5)
+type SystemdCredentialProvider struct {
+	Name string
+}
+
+func (p *SystemdCredentialProvider) Key(ctx context.Context) ([]byte, error) {
+	directory := os.Getenv("CREDENTIALS_DIRECTORY")
+	if directory == "" {
+		return nil, errors.New("CREDENTIALS_DIRECTORY is not set, is the credential passed with LoadCredential=?")
+	}
+
+	if p.Name == "" || strings.ContainsRune(p.Name, filepath.Separator) {
+		return nil, fmt.Errorf("invalid credential name %q", p.Name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(directory, p.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential %s: %w", p.Name, err)
+	}
+
+	return validateKey(data)
+}
+
+func validateKey(key []byte) ([]byte, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	return key, nil
+}
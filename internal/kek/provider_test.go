@@ -0,0 +1,71 @@
+package kek
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestProviders(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ".kek")
+		assert.NoError(t, os.WriteFile(path, testKey, 0600))
+
+		for _, source := range []string{path, "file:" + path} {
+			provider, err := ParseSource(source, nil)
+			assert.NoError(t, err)
+
+			key, err := provider.Key(ctx)
+			assert.NoError(t, err, "Loading %s should succeed", source)
+			assert.Equal(t, testKey, key)
+		}
+	})
+
+	t.Run("File with wrong size", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ".kek")
+		assert.NoError(t, os.WriteFile(path, append(testKey, '\n'), 0600))
+
+		_, err := (&FileProvider{Path: path}).Key(ctx)
+		assert.Error(t, err, "A trailing newline must not be accepted")
+	})
+
+	t.Run("Environment variable", func(t *testing.T) {
+		t.Setenv("KUURA_TEST_KEK", base64.StdEncoding.EncodeToString(testKey))
+
+		provider, err := ParseSource("env:KUURA_TEST_KEK", nil)
+		assert.NoError(t, err)
+
+		key, err := provider.Key(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, testKey, key)
+	})
+
+	t.Run("Environment variable not set", func(t *testing.T) {
+		_, err := (&EnvProvider{Variable: "KUURA_TEST_KEK_MISSING"}).Key(ctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("Systemd credential", func(t *testing.T) {
+		directory := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "kuura-kek"), testKey, 0400))
+		t.Setenv("CREDENTIALS_DIRECTORY", directory)
+
+		provider, err := ParseSource("systemd:kuura-kek", nil)
+		assert.NoError(t, err)
+
+		key, err := provider.Key(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, testKey, key)
+
+		_, err = (&SystemdCredentialProvider{Name: "../kuura-kek"}).Key(ctx)
+		assert.Error(t, err, "Credential names must not escape the directory")
+	})
+}
@@ -0,0 +1,139 @@
+package kek
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TransitClient wraps and unwraps keys with a Vault transit compatible HTTP API,
+// the root key never leaves the transit service
+type TransitClient struct {
+	address    string
+	token      string
+	mount      string
+	keyName    string
+	httpClient *http.Client
+}
+
+func NewTransitClient(address string, token string, mount string, keyName string) *TransitClient {
+	return &TransitClient{
+		address:    strings.TrimRight(address, "/"),
+		token:      token,
+		mount:      strings.Trim(mount, "/"),
+		keyName:    keyName,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Wrap encrypts key and returns the ciphertext, e.g. "vault:v1:..."
+func (c *TransitClient) Wrap(ctx context.Context, key []byte) (string, error) {
+	var response struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+
+	err := c.post(ctx, "encrypt", map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(key),
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+
+	if response.Data.Ciphertext == "" {
+		return "", fmt.Errorf("transit encrypt returned no ciphertext")
+	}
+
+	return response.Data.Ciphertext, nil
+}
+
+func (c *TransitClient) Unwrap(ctx context.Context, ciphertext string) ([]byte, error) {
+	var response struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+
+	err := c.post(ctx, "decrypt", map[string]string{
+		"ciphertext": ciphertext,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(response.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("transit decrypt returned invalid base64: %w", err)
+	}
+
+	return key, nil
+}
+
+// GenerateWrapped creates a new random key and returns it wrapped, the plaintext is never returned
+func (c *TransitClient) GenerateWrapped(ctx context.Context) (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	return c.Wrap(ctx, key)
+}
+
+func (c *TransitClient) post(ctx context.Context, operation string, body any, result any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/%s/%s/%s", c.address, c.mount, operation, url.PathEscape(c.keyName))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", c.token)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("transit %s request failed: %w", operation, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var problem struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(res.Body).Decode(&problem)
+
+		return fmt.Errorf("transit %s failed with status %d: %s", operation, res.StatusCode, strings.Join(problem.Errors, ", "))
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode transit %s response: %w", operation, err)
+	}
+
+	return nil
+}
+
+type TransitProvider struct {
+	Client     *TransitClient
+	Ciphertext string
+}
+
+func (p *TransitProvider) Key(ctx context.Context) ([]byte, error) {
+	key, err := p.Client.Unwrap(ctx, p.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap encryption key: %w", err)
+	}
+
+	return validateKey(key)
+}
@@ -0,0 +1,122 @@
+package kek
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTransitStandIn mimics the encrypt/decrypt endpoints of Vault's transit engine
+func newTransitStandIn(t *testing.T, token string) *httptest.Server {
+	var (
+		mu      sync.Mutex
+		wrapped = map[string]string{}
+	)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v1/transit/encrypt/kuura", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		mu.Lock()
+		ciphertext := fmt.Sprintf("vault:v1:%d", len(wrapped))
+		wrapped[ciphertext] = body["plaintext"]
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": ciphertext}})
+	})
+
+	mux.HandleFunc("POST /v1/transit/decrypt/kuura", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		mu.Lock()
+		plaintext, ok := wrapped[body["ciphertext"]]
+		mu.Unlock()
+
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"invalid ciphertext"}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": plaintext}})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestTransitProvider(t *testing.T) {
+	ctx := context.Background()
+	server := newTransitStandIn(t, "root-token")
+
+	t.Run("Wrap and unwrap", func(t *testing.T) {
+		client := NewTransitClient(server.URL, "root-token", "transit", "kuura")
+		key := []byte("0123456789abcdef0123456789abcdef")
+
+		ciphertext, err := client.Wrap(ctx, key)
+		assert.NoError(t, err, "Wrapping should succeed")
+
+		provider, err := ParseSource("transit:"+ciphertext, client)
+		assert.NoError(t, err)
+
+		unwrapped, err := provider.Key(ctx)
+		assert.NoError(t, err, "Unwrapping should succeed")
+		assert.Equal(t, key, unwrapped)
+	})
+
+	t.Run("Generated key is 32 bytes", func(t *testing.T) {
+		client := NewTransitClient(server.URL, "root-token", "transit", "kuura")
+
+		ciphertext, err := client.GenerateWrapped(ctx)
+		assert.NoError(t, err)
+
+		key, err := (&TransitProvider{Client: client, Ciphertext: ciphertext}).Key(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, key, KeySize)
+	})
+
+	t.Run("Wrapped key of wrong size", func(t *testing.T) {
+		client := NewTransitClient(server.URL, "root-token", "transit", "kuura")
+
+		ciphertext, err := client.Wrap(ctx, []byte("short"))
+		assert.NoError(t, err)
+
+		_, err = (&TransitProvider{Client: client, Ciphertext: ciphertext}).Key(ctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		client := NewTransitClient(server.URL, "wrong-token", "transit", "kuura")
+
+		_, err := client.Wrap(ctx, make([]byte, KeySize))
+		assert.ErrorContains(t, err, "permission denied")
+	})
+
+	t.Run("Transit source without client", func(t *testing.T) {
+		_, err := ParseSource("transit:vault:v1:0", nil)
+		assert.Error(t, err)
+	})
+}
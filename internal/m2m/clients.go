@@ -0,0 +1,157 @@
+package m2m
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/utils"
+	"github.com/oklog/ulid/v2"
+)
+
+// CreateClient registers a machine client for the OAuth2 client_credentials grant, the secret is only returned once
+func (s *M2MService) CreateClient(ctx context.Context, serviceId uuid.UUID, subjectId string, template string) (clientId string, clientSecret string, err error) {
+	clientId = ulid.Make().String()
+
+	clientSecret, err = generateOpaqueToken(48)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate client secret: %w", err)
+	}
+
+	hashedSecret, err := s.tokenhasher.HashValue(clientSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash client secret: %w", err)
+	}
+
+	err = s.db.CreateM2MClient(ctx, db_gen.CreateM2MClientParams{
+		ID:         clientId,
+		ServiceID:  utils.UUIDToPgType(serviceId),
+		SubjectID:  subjectId,
+		TemplateID: template,
+		SecretHash: hashedSecret,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create client: %w", err)
+	}
+
+	return clientId, clientSecret, nil
+}
+
+func (s *M2MService) GetClients(ctx context.Context, serviceId uuid.UUID) ([]*models.M2MClient, error) {
+	rows, err := s.db.GetM2MClients(ctx, utils.UUIDToPgType(serviceId))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*models.M2MClient
+	for _, row := range rows {
+		client := &models.M2MClient{
+			Id:         row.ID,
+			ServiceId:  serviceId,
+			SubjectId:  row.SubjectID,
+			TemplateId: row.TemplateID,
+			CreatedAt:  row.CreatedAt.Time,
+		}
+
+		if row.LastUsedAt.Valid {
+			client.LastUsedAt = &row.LastUsedAt.Time
+		}
+
+		result = append(result, client)
+	}
+
+	return result, nil
+}
+
+func (s *M2MService) DeleteClient(ctx context.Context, clientId string) error {
+	return s.db.DeleteM2MClient(ctx, clientId)
+}
+
+// AuthenticateClient verifies the secret of a machine client
+func (s *M2MService) AuthenticateClient(ctx context.Context, clientId string, clientSecret string) (*models.M2MClient, error) {
+	client, err := s.authenticateClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceId, err := utils.PgTypeUUIDToUUID(client.ServiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client's service id")
+	}
+
+	return &models.M2MClient{
+		Id:         client.ID,
+		ServiceId:  serviceId,
+		SubjectId:  client.SubjectID,
+		TemplateId: client.TemplateID,
+	}, nil
+}
+
+// ClientExists reports whether the client still exists, tokens of deleted clients are no longer active
+func (s *M2MService) ClientExists(ctx context.Context, clientId string) (bool, error) {
+	_, err := s.db.GetM2MClientAndService(ctx, clientId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *M2MService) authenticateClient(ctx context.Context, clientId string, clientSecret string) (*db_gen.GetM2MClientAndServiceRow, error) {
+	client, err := s.db.GetM2MClientAndService(ctx, clientId)
+	if err != nil {
+		return nil, errs.New(errcode.InvalidClient, fmt.Errorf("failed to get client: %w", err))
+	}
+
+	valid, err := s.tokenhasher.CompareHashAndValue(client.SecretHash, clientSecret)
+	if err != nil {
+		return nil, errs.New(errcode.InvalidClient, err)
+	} else if !valid {
+		return nil, errs.New(errcode.InvalidClient, errors.New("invalid client secret"))
+	}
+
+	return &client, nil
+}
+
+// ClientCredentials authenticates a machine client and issues an access token with the roles of its template
+func (s *M2MService) ClientCredentials(ctx context.Context, clientId string, clientSecret string) (accessToken string, err error) {
+	client, err := s.authenticateClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return "", err
+	}
+
+	serviceId, err := utils.PgTypeUUIDToUUID(client.ServiceID)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse client's service id")
+	}
+
+	service := &models.AppService{
+		Id:          serviceId,
+		JWTAudience: client.ServiceJwtAudience,
+		CreatedAt:   client.ServiceCreatedAt.Time,
+		ModifiedAt:  client.ServiceModifiedAt,
+		Name:        client.ServiceName,
+		Description: client.ServiceDescription.String,
+	}
+
+	accessToken, err = s.buildAndSignAccessToken(ctx, service, client.SubjectID, client.Roles, map[string]any{
+		"client_id": client.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.db.UpdateM2MClientLastUsedAt(ctx, client.ID); err != nil {
+		return "", fmt.Errorf("failed to update client last usage date: %w", err)
+	}
+
+	return accessToken, nil
+}
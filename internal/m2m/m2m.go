@@ -5,31 +5,45 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math/big"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	tokenhasher "github.com/kymppi/kuura/internal/argon2"
 	"github.com/kymppi/kuura/internal/db_gen"
 	"github.com/kymppi/kuura/internal/jwks"
 	"github.com/kymppi/kuura/internal/models"
 	"github.com/kymppi/kuura/internal/utils"
-	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/oklog/ulid/v2"
 )
 
+const AccessTokenDuration = 30 * time.Minute //TODO: move to services db table
+
+// refreshTokenReuseGrace is how long the previous refresh token can still be exchanged after a rotation.
+// A client that lost the response to its refresh retries with the previous token and gets a new one,
+// rotated from the current generation. The token in the lost response becomes a previous generation,
+// so presenting it later still revokes the session. Outside the grace any previous generation revokes it.
+const refreshTokenReuseGrace = 30 * time.Second
+
+// errRefreshTokenJustRotated marks the previous refresh token presented within refreshTokenReuseGrace
+var errRefreshTokenJustRotated = errors.New("refresh token was just rotated")
+
 type M2MService struct {
+	logger      *slog.Logger
 	db          *db_gen.Queries
 	tokenhasher *tokenhasher.TokenHasher
 	jwtIssuer   string
 	jwkManager  *jwks.JWKManager
 }
 
-func NewM2MService(generatedQueries *db_gen.Queries, jwtIssuer string, jwkManager *jwks.JWKManager) *M2MService {
+func NewM2MService(logger *slog.Logger, generatedQueries *db_gen.Queries, jwtIssuer string, jwkManager *jwks.JWKManager) *M2MService {
 	return &M2MService{
-		db: generatedQueries,
+		logger: logger,
+		db:     generatedQueries,
 		tokenhasher: tokenhasher.NewTokenHasher(tokenhasher.Argon2Params{
 			Memory:      64 * 1024,
 			Iterations:  3,
@@ -77,10 +91,11 @@ func (s *M2MService) GetRoleTemplates(ctx context.Context, serviceId uuid.UUID)
 func (s *M2MService) CreateSession(ctx context.Context, serviceId uuid.UUID, subjectId string, template string) (id string, initialToken string, err error) {
 	id = ulid.Make().String()
 
-	initialToken, err = generateOpaqueToken(32)
+	opaqueToken, err := generateOpaqueToken(32)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate opaque token: %w", err)
 	}
+	initialToken = utils.FormatRefreshToken(0, opaqueToken)
 
 	hashedToken, err := s.tokenhasher.HashValue(initialToken)
 
@@ -108,55 +123,36 @@ func (s *M2MService) CreateSession(ctx context.Context, serviceId uuid.UUID, sub
 }
 
 func (s *M2MService) CreateAccessToken(ctx context.Context, sessionId string, refreshToken string) (accessToken string, newRefreshToken string, err error) {
-	valid, roles, service, subjectId, err := s.validateRefreshTokenAndGetRolesAndServiceAndSubjectId(ctx, sessionId, refreshToken)
-
-	if err != nil || !valid {
-		//TODO: log real error to console, could be like "role doesn't exist"
-		return "", "", errors.New("invalid token")
-	}
-
-	err = s.db.UpdateM2MSessionLastAuthenticatedAt(ctx, sessionId)
-
+	session, err := s.validateRefreshToken(ctx, sessionId, refreshToken)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to update session last authentication date: %w", err)
+		s.logger.Error("Failed to validate refresh token", slog.String("session", sessionId), slog.String("error", err.Error()))
+		return "", "", errors.New("invalid token")
 	}
 
-	// important that we try to generate the jwt BEFORE updating refresh token, if it fails then the client can't even retry
-	exp := time.Now().Add(30 * time.Minute) //TODO: move to services db table
-
-	token, err := jwt.NewBuilder().
-		Audience([]string{service.JWTAudience}).
-		Issuer(s.jwtIssuer).
-		Subject(subjectId).
-		IssuedAt(time.Now()).
-		Expiration(exp).
-		Claim("session_id", sessionId).
-		Claim("roles", roles).
-		Claim("client_type", "machine").
-		Build()
-
+	service, err := serviceFromSession(session)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to build jwt: %w", err)
+		return "", "", err
 	}
 
-	signingKey, err := s.jwkManager.GetSigningKey(ctx, service.Id)
+	err = s.db.UpdateM2MSessionLastAuthenticatedAt(ctx, sessionId)
 
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get signing key: %w", err)
+		return "", "", fmt.Errorf("failed to update session last authentication date: %w", err)
 	}
 
-	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.ES384, signingKey))
-
+	// important that we try to generate the jwt BEFORE updating refresh token, if it fails then the client can't even retry
+	accessToken, err = s.buildAndSignAccessToken(ctx, service, session.SubjectID, session.Roles, map[string]any{
+		"session_id": sessionId,
+	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to sign jwt: %w", err)
+		return "", "", err
 	}
 
-	accessToken = string(signedToken)
-
-	newRefreshToken, err = generateOpaqueToken(32)
+	opaqueToken, err := generateOpaqueToken(32)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to rotate refresh token: generate opaque token: %w", err)
 	}
+	newRefreshToken = utils.FormatRefreshToken(session.RefreshTokenGeneration+1, opaqueToken)
 
 	hashedToken, err := s.tokenhasher.HashValue(newRefreshToken)
 
@@ -164,56 +160,189 @@ func (s *M2MService) CreateAccessToken(ctx context.Context, sessionId string, re
 		return "", "", fmt.Errorf("failed to hash new refresh token: %w", err)
 	}
 
-	err = s.db.RotateM2MSessionRefreshToken(ctx, db_gen.RotateM2MSessionRefreshTokenParams{
+	// the generation check makes concurrent refreshes with the same token fail instead of forking the chain
+	_, err = s.db.RotateM2MSessionRefreshToken(ctx, db_gen.RotateM2MSessionRefreshTokenParams{
 		RefreshToken: hashedToken,
 		ID:           sessionId,
 		ExpiresAt: pgtype.Timestamptz{
 			Time:  time.Now().Add(time.Hour * 24),
 			Valid: true,
 		},
+		RefreshTokenGeneration: session.RefreshTokenGeneration,
 	})
-	if err != nil {
+	if errors.Is(err, pgx.ErrNoRows) {
+		// another refresh rotated the token first, the client retries and falls within refreshTokenReuseGrace
+		return "", "", errors.New("invalid token")
+	} else if err != nil {
 		return "", "", fmt.Errorf("failed to rotate refresh token: %w", err)
 	}
 
 	return accessToken, newRefreshToken, nil
 }
 
-func (s *M2MService) validateRefreshTokenAndGetRolesAndServiceAndSubjectId(ctx context.Context, sessionId string, refreshToken string) (valid bool, roles []string, service *models.AppService, subjectId string, err error) {
+// RevokeSession deletes the session if the refresh token matches, revoked is false when nothing was deleted
+func (s *M2MService) RevokeSession(ctx context.Context, sessionId string, refreshToken string) (revoked bool, err error) {
 	session, err := s.db.GetM2MSessionAndService(ctx, sessionId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	valid, err := s.tokenhasher.CompareHashAndValue(session.RefreshToken, refreshToken)
+	if err != nil || !valid {
+		return false, nil
+	}
 
+	if err := s.db.DeleteM2MSession(ctx, sessionId); err != nil {
+		return false, fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return true, nil
+}
+
+// SessionActive reports whether the session exists and has not expired
+func (s *M2MService) SessionActive(ctx context.Context, sessionId string) (bool, error) {
+	session, err := s.db.GetM2MSessionAndService(ctx, sessionId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return time.Now().Before(session.ExpiresAt.Time), nil
+}
+
+func (s *M2MService) buildAndSignAccessToken(
+	ctx context.Context,
+	service *models.AppService,
+	subjectId string,
+	roles []string,
+	claims map[string]any,
+) (string, error) {
+	builder := jwt.NewBuilder().
+		Audience([]string{service.JWTAudience}).
+		Issuer(s.jwtIssuer).
+		Subject(subjectId).
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(AccessTokenDuration)).
+		Claim("roles", roles).
+		Claim("client_type", "machine").
+		Claim("service_id", service.Id.String())
+
+	for key, value := range claims {
+		builder = builder.Claim(key, value)
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build jwt: %w", err)
+	}
+
+	signingKey, err := s.jwkManager.GetSigningKey(ctx, service.Id)
 	if err != nil {
-		return false, nil, nil, "", err
+		return "", fmt.Errorf("failed to get signing key: %w", err)
+	}
+
+	signedToken, err := jwt.Sign(token, jwt.WithKey(signingKey.Algorithm(), signingKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign jwt: %w", err)
+	}
+
+	return string(signedToken), nil
+}
+
+func (s *M2MService) validateRefreshToken(ctx context.Context, sessionId string, refreshToken string) (*db_gen.GetM2MSessionAndServiceRow, error) {
+	session, err := s.db.GetM2MSessionAndService(ctx, sessionId)
+
+	if err != nil {
+		return nil, err
 	}
 
 	if time.Now().After(session.ExpiresAt.Time) {
-		return false, nil, nil, "", errors.New("the session is expired")
+		return nil, errors.New("the session is expired")
+	}
+
+	// tokens without a generation predate reuse detection and are compared against the current hash
+	if generation, ok := utils.ParseRefreshTokenGeneration(refreshToken); ok {
+		if generation < session.RefreshTokenGeneration {
+			if err := s.detectRefreshTokenReuse(ctx, &session, generation, refreshToken); !errors.Is(err, errRefreshTokenJustRotated) {
+				return nil, err
+			}
+
+			s.logger.Info("Previous refresh token presented within the reuse grace, rotating again",
+				slog.String("session_id", session.ID),
+				slog.Int("presented_generation", int(generation)),
+			)
+
+			return &session, nil
+		} else if generation > session.RefreshTokenGeneration {
+			return nil, errors.New("unknown refresh token generation")
+		}
 	}
 
-	valid, err = s.tokenhasher.CompareHashAndValue(session.RefreshToken, refreshToken)
+	valid, err := s.tokenhasher.CompareHashAndValue(session.RefreshToken, refreshToken)
 
 	if err != nil {
-		return false, nil, nil, "", err
+		return nil, err
 	} else if !valid {
-		return false, nil, nil, "", errors.New("invalid token")
+		return nil, errors.New("invalid token")
+	}
+
+	return &session, nil
+}
+
+// a rotated token being presented again means it has leaked, so the whole session is revoked (OAuth 2.0 Security BCP section 4.14)
+func (s *M2MService) detectRefreshTokenReuse(ctx context.Context, session *db_gen.GetM2MSessionAndServiceRow, generation int32, refreshToken string) error {
+	previous, err := s.db.GetM2MSessionPreviousRefreshToken(ctx, db_gen.GetM2MSessionPreviousRefreshTokenParams{
+		SessionID:  session.ID,
+		Generation: generation,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get previous refresh token: %w", err)
 	}
 
+	valid, err := s.tokenhasher.CompareHashAndValue(previous.TokenHash, refreshToken)
+	if err != nil {
+		return err
+	} else if !valid {
+		return errors.New("invalid token")
+	}
+
+	if generation == session.RefreshTokenGeneration-1 && time.Since(previous.RotatedAt.Time) < refreshTokenReuseGrace {
+		return errRefreshTokenJustRotated
+	}
+
+	s.logger.Warn("Refresh token reuse detected, revoking session",
+		slog.String("security_event", "refresh_token_reuse"),
+		slog.String("session_id", session.ID),
+		slog.String("subject_id", session.SubjectID),
+		slog.Int("presented_generation", int(generation)),
+		slog.Int("current_generation", int(session.RefreshTokenGeneration)),
+	)
+
+	if err := s.db.DeleteM2MSession(ctx, session.ID); err != nil {
+		return fmt.Errorf("failed to revoke session after refresh token reuse: %w", err)
+	}
+
+	return errors.New("refresh token reuse detected")
+}
+
+func serviceFromSession(session *db_gen.GetM2MSessionAndServiceRow) (*models.AppService, error) {
 	serviceId, err := utils.PgTypeUUIDToUUID(session.ServiceID)
 
 	if err != nil {
-		return false, nil, nil, "", fmt.Errorf("failed to parse session's service id")
+		return nil, fmt.Errorf("failed to parse session's service id")
 	}
 
-	service = &models.AppService{
+	return &models.AppService{
 		Id:          serviceId,
 		JWTAudience: session.ServiceJwtAudience,
 		CreatedAt:   session.ServiceCreatedAt.Time,
 		ModifiedAt:  session.ServiceModifiedAt,
 		Name:        session.ServiceName,
 		Description: session.ServiceDescription.String,
-	}
-
-	return true, session.Roles, service, session.SubjectID, nil
+	}, nil
 }
 
 func generateOpaqueToken(length int) (string, error) {
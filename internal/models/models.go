@@ -17,6 +17,9 @@ type AppService struct {
 	ContactEmail        string        `json:"contact_email" yaml:"contact_email"`
 	LoginRedirect       string        `json:"login_redirect" yaml:"login_redirect"`
 	AccessTokenDuration time.Duration `json:"access_token_duration" yaml:"access_token_duration"`
+	JWKRotationInterval time.Duration `json:"jwk_rotation_interval" yaml:"jwk_rotation_interval"` // 0 disables automatic rotation
+	JWKRetirementPeriod time.Duration `json:"jwk_retirement_period" yaml:"jwk_retirement_period"`
+	JWKAlgorithm        string        `json:"jwk_algorithm" yaml:"jwk_algorithm"` // ES256 | ES384 | RS256 | EdDSA
 }
 
 type M2MRoleTemplate struct {
@@ -24,6 +27,15 @@ type M2MRoleTemplate struct {
 	Roles []string `json:"roles" yaml:"roles"`
 }
 
+type M2MClient struct {
+	Id         string     `json:"id" yaml:"id"` // client_id
+	ServiceId  uuid.UUID  `json:"service_id" yaml:"service_id"`
+	SubjectId  string     `json:"subject_id" yaml:"subject_id"`
+	TemplateId string     `json:"template_id" yaml:"template_id"`
+	CreatedAt  time.Time  `json:"created_at" yaml:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" yaml:"last_used_at"`
+}
+
 type User struct {
 	Id          string
 	Username    string
@@ -31,11 +43,36 @@ type User struct {
 }
 
 type UserSession struct {
-	Id                  string
-	UserId              string
-	ServiceId           *uuid.UUID
-	RefreshTokenHash    *string
-	ExpiresAt           time.Time
-	CreatedAt           time.Time
-	LastAuthenticatedAt *time.Time
+	Id                     string
+	UserId                 string
+	ServiceId              *uuid.UUID
+	RefreshTokenHash       *string
+	ExpiresAt              time.Time
+	CreatedAt              time.Time
+	LastAuthenticatedAt    *time.Time
+	RefreshTokenGeneration int32
+}
+
+type WebAuthnCredential struct {
+	Id         string     `json:"id" yaml:"id"` // base64url credential id
+	Name       string     `json:"name" yaml:"name"`
+	Transports []string   `json:"transports" yaml:"transports"`
+	CreatedAt  time.Time  `json:"created_at" yaml:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" yaml:"last_used_at"`
+}
+
+type UserInvitation struct {
+	Id        uuid.UUID   `json:"id" yaml:"id"`
+	Roles     []string    `json:"roles" yaml:"roles"`
+	Services  []uuid.UUID `json:"services" yaml:"services"` // allowlists the invited user is added to
+	ExpiresAt time.Time   `json:"expires_at" yaml:"expires_at"`
+	CreatedAt time.Time   `json:"created_at" yaml:"created_at"`
+	UsedAt    *time.Time  `json:"used_at" yaml:"used_at"`
+	UsedBy    *string     `json:"used_by" yaml:"used_by"` // username
+}
+
+type ServiceRoles struct {
+	ServiceId   uuid.UUID `json:"service_id" yaml:"service_id"`
+	ServiceName string    `json:"service_name" yaml:"service_name"`
+	Roles       []string  `json:"roles" yaml:"roles"`
 }
@@ -25,20 +25,53 @@ func addMainRoutes(
 	publicKuuraDomain string,
 	jwtIssuer string,
 ) {
-	mux.Handle("GET /v1/service/{serviceId}/jwks.json", endpoints.V1JwksHandler(logger, jwkManager))
+	mux.Handle(fmt.Sprintf("GET %s", constants.OPENID_CONFIGURATION_PATH), endpoints.V1_OpenIDConfiguration(logger, serviceManager, publicKuuraDomain, jwtIssuer))
+	mux.Handle(fmt.Sprintf("GET %s", constants.SERVICE_OPENID_CONFIGURATION_PATH), endpoints.V1_ServiceOpenIDConfiguration(logger, serviceManager, publicKuuraDomain, jwtIssuer))
+
+	mux.Handle(fmt.Sprintf("GET %s", constants.SERVICE_JWKS_PATH), endpoints.V1JwksHandler(logger, jwkManager, serviceManager))
 	mux.Handle("GET /v1/service/{serviceId}", endpoints.V1_ServiceInfo(logger, serviceManager))
 
-	mux.Handle("POST /v1/m2m/access", endpoints.V1M2MRefreshAccessToken(logger, m2mService))
+	mux.Handle(fmt.Sprintf("POST %s", constants.M2M_ACCESS_PATH), endpoints.V1M2MRefreshAccessToken(logger, m2mService))
 
 	mux.Handle("POST /v1/logout", endpoints.V1_User_Logout(logger, userService, publicKuuraDomain, jwkManager, jwtIssuer))
-	mux.Handle("POST /v1/user/tokens/external", endpoints.V1_User_ExternalTokens(logger, userService))
+	mux.Handle(fmt.Sprintf("POST %s", constants.EXTERNAL_USER_TOKENS_PATH), endpoints.V1_User_ExternalTokens(logger, userService))
 	mux.Handle("POST /v1/user/login/external", endpoints.V1_User_LoginExternal(logger, userService, jwkManager, jwtIssuer))
 	mux.Handle(fmt.Sprintf("POST %s", constants.INTERNAL_USER_REFRESH_PATH), endpoints.V1_User_RefreshInternalToken(logger, userService, publicKuuraDomain))
 
+	mux.Handle(fmt.Sprintf("GET %s", constants.OAUTH2_AUTHORIZE_PATH), endpoints.V1_OAuth2_Authorize(logger, userService, serviceManager, jwkManager, jwtIssuer))
+	mux.Handle(fmt.Sprintf("POST %s", constants.OAUTH2_TOKEN_PATH), endpoints.V1_OAuth2_Token(logger, userService, m2mService))
+	mux.Handle(fmt.Sprintf("POST %s", constants.OAUTH2_INTROSPECT_PATH), endpoints.V1_OAuth2_Introspect(logger, userService, m2mService, jwkManager, jwtIssuer))
+	mux.Handle(fmt.Sprintf("POST %s", constants.OAUTH2_REVOKE_PATH), endpoints.V1_OAuth2_Revoke(logger, userService, m2mService))
+	mux.Handle(fmt.Sprintf("GET %s", constants.OAUTH2_USERINFO_PATH), endpoints.V1_OAuth2_UserInfo(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle(fmt.Sprintf("POST %s", constants.OAUTH2_USERINFO_PATH), endpoints.V1_OAuth2_UserInfo(logger, userService, jwkManager, jwtIssuer))
+
 	mux.Handle("GET /v1/me", endpoints.V1_ME(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/totp", endpoints.V1_User_TOTPEnroll(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/totp/confirm", endpoints.V1_User_TOTPConfirm(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("DELETE /v1/me/totp", endpoints.V1_User_TOTPDisable(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/password/begin", endpoints.V1_User_PasswordChangeBegin(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/password", endpoints.V1_User_PasswordChange(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/reauth/srp/begin", endpoints.V1_User_ReauthSRPBegin(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/reauth/srp", endpoints.V1_User_ReauthSRP(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/reauth/totp", endpoints.V1_User_ReauthTOTP(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/reauth/webauthn/begin", endpoints.V1_User_ReauthWebAuthnBegin(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/reauth/webauthn", endpoints.V1_User_ReauthWebAuthn(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/recovery-codes", endpoints.V1_User_RecoveryCodesRegenerate(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("GET /v1/me/webauthn", endpoints.V1_User_WebAuthnCredentials(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/webauthn/register/begin", endpoints.V1_User_WebAuthnRegisterBegin(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("POST /v1/me/webauthn/register/finish", endpoints.V1_User_WebAuthnRegisterFinish(logger, userService, jwkManager, jwtIssuer))
+	mux.Handle("DELETE /v1/me/webauthn/{credentialId}", endpoints.V1_User_WebAuthnDelete(logger, userService, jwkManager, jwtIssuer))
 
+	mux.Handle("GET /v1/register", endpoints.V1_RegistrationPolicy(logger, userService))
+	mux.Handle("POST /v1/register", endpoints.V1_Register(logger, userService))
 	mux.Handle("POST /v1/srp/begin", endpoints.V1_SRP_ClientBegin(logger, userService))
 	mux.Handle("POST /v1/srp/verify", endpoints.V1_SRP_ClientVerify(logger, userService, publicKuuraDomain))
+	mux.Handle("POST /v1/mfa/totp", endpoints.V1_MFA_TOTP(logger, userService, publicKuuraDomain))
+	mux.Handle("POST /v1/mfa/recovery", endpoints.V1_MFA_RecoveryCode(logger, userService, publicKuuraDomain))
+	mux.Handle("POST /v1/mfa/webauthn/begin", endpoints.V1_MFA_WebAuthnBegin(logger, userService))
+	mux.Handle("POST /v1/mfa/webauthn", endpoints.V1_MFA_WebAuthn(logger, userService, publicKuuraDomain))
+	mux.Handle("POST /v1/webauthn/login/begin", endpoints.V1_WebAuthn_LoginBegin(logger, userService))
+	mux.Handle("POST /v1/webauthn/login/finish", endpoints.V1_WebAuthn_LoginFinish(logger, userService, publicKuuraDomain))
 
 	mux.Handle("GET /", endpoints.FrontendHandler(logger, frontendFS))
 
@@ -50,10 +83,21 @@ func addManagementRoutes(
 	logger *slog.Logger,
 	jwkManager *jwks.JWKManager,
 	m2mService *m2m.M2MService,
+	userService *users.UserService,
+	serviceManager *services.ServiceManager,
+	managementToken []byte,
 ) {
 	mux.Handle("/", http.NotFoundHandler())
-	mux.Handle("GET /v1/{serviceId}/jwks.json", endpoints.V1JwksHandler(logger, jwkManager))
+	mux.Handle("GET /v1/{serviceId}/jwks.json", endpoints.V1JwksHandler(logger, jwkManager, serviceManager))
 
 	// unauthenticated management endpoints
 	mux.Handle("POST /v1/m2m/sessions", endpoints.V1CreateM2MSession(logger, m2mService))
+
+	// authenticated management endpoints, MANAGEMENT_TOKEN is required as a bearer token.
+	// New management endpoints belong here.
+	mux.Handle("GET /v1/jwks/cache", endpoints.ManagementAuth(logger, managementToken, endpoints.V1JwksCacheStats(logger, jwkManager)))
+	mux.Handle("POST /v1/m2m/clients", endpoints.ManagementAuth(logger, managementToken, endpoints.V1CreateM2MClient(logger, m2mService)))
+	mux.Handle("GET /v1/users/{username}/roles", endpoints.ManagementAuth(logger, managementToken, endpoints.V1_Admin_UserRoles(logger, userService)))
+	mux.Handle("POST /v1/users/{username}/roles/{serviceId}", endpoints.ManagementAuth(logger, managementToken, endpoints.V1_Admin_AddUserRoles(logger, userService, serviceManager)))
+	mux.Handle("DELETE /v1/users/{username}/roles/{serviceId}/{role}", endpoints.ManagementAuth(logger, managementToken, endpoints.V1_Admin_RemoveUserRole(logger, userService, serviceManager)))
 }
@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/kymppi/kuura/internal/jwks"
 	"github.com/kymppi/kuura/internal/m2m"
 	"github.com/kymppi/kuura/internal/services"
 	"github.com/kymppi/kuura/internal/settings"
+	"github.com/kymppi/kuura/internal/users"
 )
 
 func RunServer(ctx context.Context, logger *slog.Logger, config *Config, frontendFS embed.FS) error {
@@ -31,15 +34,23 @@ func RunServer(ctx context.Context, logger *slog.Logger, config *Config, fronten
 		return fmt.Errorf("faied to create internal service for kuura: %w", err)
 	}
 
-	m2mService := m2m.NewM2MService(queries, config.JWT_ISSUER, jwkManager)
+	m2mService := m2m.NewM2MService(logger, queries, config.JWT_ISSUER, jwkManager)
+
+	rotator := jwks.NewRotator(logger, queries, jwkManager, serviceManager, 5*time.Minute, max(m2m.AccessTokenDuration, users.IDTokenDuration))
+	go rotator.Run(ctx)
 
 	userService, err := InitializeUserService(ctx, logger, config, queries, jwkManager, serviceManager)
 	if err != nil {
 		return err
 	}
 
+	managementToken, err := loadManagementToken(ctx, logger, config)
+	if err != nil {
+		return err
+	}
+
 	mainServer := newHTTPServer(logger, config, jwkManager, m2mService, frontendFS, userService, serviceManager)
-	managementServer := newManagementServer(logger, config, jwkManager, m2mService)
+	managementServer := newManagementServer(logger, config, jwkManager, m2mService, userService, serviceManager, managementToken)
 
 	errChan := make(chan error, 2)
 
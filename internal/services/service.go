@@ -35,6 +35,9 @@ func serviceToModel(service db_gen.Service) (*models.AppService, error) {
 		ContactEmail:        service.ContactEmail,
 		LoginRedirect:       service.LoginRedirect,
 		AccessTokenDuration: time.Duration(service.AccessTokenDuration) * time.Second,
+		JWKRotationInterval: time.Duration(service.JwkRotationInterval) * time.Second,
+		JWKRetirementPeriod: time.Duration(service.JwkRetirementPeriod) * time.Second,
+		JWKAlgorithm:        service.JwkAlgorithm,
 	}, nil
 }
 
@@ -126,6 +129,31 @@ func (m *ServiceManager) UpdateService(ctx context.Context, service *models.AppS
 	})
 }
 
+// SetJWKRotationPolicy controls how often the background rotator promotes a new signing key and how long retired keys stay published
+func (m *ServiceManager) SetJWKRotationPolicy(ctx context.Context, id uuid.UUID, rotationInterval time.Duration, retirementPeriod time.Duration) error {
+	if rotationInterval < 0 || retirementPeriod < 0 {
+		return errs.New(errcode.InvalidArgumentError, errors.New("durations cannot be negative"))
+	}
+
+	if rotationInterval > 0 && rotationInterval < time.Hour {
+		return errs.New(errcode.InvalidArgumentError, errors.New("rotation interval must be at least an hour"))
+	}
+
+	return m.db.UpdateServiceJWKPolicy(ctx, db_gen.UpdateServiceJWKPolicyParams{
+		ID:                  utils.UUIDToPgType(id),
+		JwkRotationInterval: int32(rotationInterval.Seconds()),
+		JwkRetirementPeriod: int32(retirementPeriod.Seconds()),
+	})
+}
+
+// SetJWKAlgorithm changes the algorithm of keys created from now on, the current key is replaced on the next rotation
+func (m *ServiceManager) SetJWKAlgorithm(ctx context.Context, id uuid.UUID, algorithm string) error {
+	return m.db.UpdateServiceJWKAlgorithm(ctx, db_gen.UpdateServiceJWKAlgorithmParams{
+		ID:           utils.UUIDToPgType(id),
+		JwkAlgorithm: algorithm,
+	})
+}
+
 func (m *ServiceManager) CreateInternalServiceIfNotExists(ctx context.Context, publicKuuraDomain string) error {
 	existingServiceId, err := m.settings.GetValue(ctx, instance_setting.InternalServiceId)
 	if err != nil && !errs.IsErrorCode(err, errcode.SettingNotFound) {
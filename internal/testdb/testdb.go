@@ -0,0 +1,70 @@
+// Package testdb gives tests a migrated database schema of their own.
+// Tests using it are skipped unless KUURA_TEST_DATABASE_URL points to a postgres database they may create schemas in.
+package testdb
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/db_migrations"
+	"github.com/oklog/ulid/v2"
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+const DatabaseURLEnv = "KUURA_TEST_DATABASE_URL"
+
+// New creates an empty schema with every migration applied, it is dropped when the test ends
+func New(t *testing.T) *db_gen.Queries {
+	t.Helper()
+
+	dsn := os.Getenv(DatabaseURLEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", DatabaseURLEnv)
+	}
+
+	ctx := context.Background()
+
+	schema := pgx.Identifier{"test_" + strings.ToLower(ulid.Make().String())}.Sanitize()
+
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %s", err)
+	}
+	t.Cleanup(func() { admin.Close(context.Background()) })
+
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("failed to create test schema: %s", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("failed to drop test schema: %s", err)
+		}
+	})
+
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %s", DatabaseURLEnv, err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %s", err)
+	}
+	t.Cleanup(pool.Close)
+
+	sqlDB := stdlib.OpenDBFromPool(pool)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if _, err := migrate.Exec(sqlDB, "postgres", db_migrations.Migrations, migrate.Up); err != nil {
+		t.Fatalf("failed to apply migrations: %s", err)
+	}
+
+	return db_gen.New(pool)
+}
@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	// RFC 6238 Appendix B, SHA1
+	secret := []byte("12345678901234567890")
+
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		t.Run(v.code, func(t *testing.T) {
+			assert.Equal(t, v.code, Code(secret, Step(time.Unix(v.unix, 0)), 8))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	t.Run("Current step", func(t *testing.T) {
+		step, ok := Validate(secret, Code(secret, current, Digits), now)
+		assert.True(t, ok)
+		assert.Equal(t, current, step)
+	})
+
+	t.Run("Adjacent steps", func(t *testing.T) {
+		step, ok := Validate(secret, Code(secret, current-1, Digits), now)
+		assert.True(t, ok)
+		assert.Equal(t, current-1, step)
+
+		step, ok = Validate(secret, Code(secret, current+1, Digits), now)
+		assert.True(t, ok)
+		assert.Equal(t, current+1, step)
+	})
+
+	t.Run("Outside skew", func(t *testing.T) {
+		_, ok := Validate(secret, Code(secret, current-2, Digits), now)
+		assert.False(t, ok)
+	})
+
+	t.Run("Wrong length", func(t *testing.T) {
+		_, ok := Validate(secret, Code(secret, current, 8), now)
+		assert.False(t, ok)
+	})
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Kuura", "alice", []byte("12345678901234567890"))
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Kuura:alice?"))
+
+	parsed, err := url.Parse(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", parsed.Query().Get("secret"))
+	assert.Equal(t, "Kuura", parsed.Query().Get("issuer"))
+	assert.Equal(t, "6", parsed.Query().Get("digits"))
+}
+
+func TestQRCode(t *testing.T) {
+	code, err := QRCode(URI("Kuura", "alice", []byte("12345678901234567890")))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(code, "data:image/png;base64,"))
+
+	png, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(code, "data:image/png;base64,"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("\x89PNG"), png[:4])
+}
@@ -0,0 +1,256 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/utils"
+)
+
+type ServiceAccessMode string
+
+const (
+	ServiceAccessOpen      ServiceAccessMode = "open" // every enabled user, the default
+	ServiceAccessAllowlist ServiceAccessMode = "allowlist"
+	ServiceAccessRoles     ServiceAccessMode = "roles" // users with every required role in the service
+)
+
+func ParseServiceAccessMode(value string) (ServiceAccessMode, error) {
+	switch mode := ServiceAccessMode(value); mode {
+	case ServiceAccessOpen, ServiceAccessAllowlist, ServiceAccessRoles:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown service access mode %q, expected open, allowlist or roles", value)
+	}
+}
+
+type ServiceAccessPolicy struct {
+	Mode          ServiceAccessMode `json:"mode"`
+	RequiredRoles []string          `json:"required_roles"`
+	AllowedUsers  []string          `json:"allowed_users"` // usernames, kept when switching modes
+}
+
+// CheckServiceAccess decides whether the user may log into the service, it runs before any session or code exchange is created
+// and again whenever a session is exchanged for new tokens.
+// The internal service is always allowed so every user can manage their account.
+func (s *UserService) CheckServiceAccess(ctx context.Context, uid string, serviceId uuid.UUID) error {
+	internal, err := s.services.GetInternalKuuraService(ctx)
+	if err != nil {
+		return err
+	}
+
+	if internal.Id == serviceId {
+		return nil
+	}
+
+	allowed, err := s.passesAccessPolicy(ctx, uid, serviceId)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		s.logger.Info("Service access denied",
+			slog.String("security_event", "service_access_denied"),
+			slog.String("uid", uid),
+			slog.String("service_id", serviceId.String()),
+		)
+
+		return errs.New(errcode.ServiceAccessDenied, fmt.Errorf("user %s is not allowed into service %s", uid, serviceId))
+	}
+
+	return nil
+}
+
+func (s *UserService) passesAccessPolicy(ctx context.Context, uid string, serviceId uuid.UUID) (bool, error) {
+	policy, err := s.db.GetServiceAccessPolicy(ctx, utils.UUIDToPgType(serviceId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get service access policy: %w", err)
+	}
+
+	switch ServiceAccessMode(policy.Mode) {
+	case ServiceAccessOpen:
+		return true, nil
+	case ServiceAccessAllowlist:
+		allowed, err := s.db.IsUserAllowedInService(ctx, db_gen.IsUserAllowedInServiceParams{
+			ServiceID: utils.UUIDToPgType(serviceId),
+			UserID:    uid,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to check service allowlist: %w", err)
+		}
+
+		return allowed, nil
+	case ServiceAccessRoles:
+		roles, err := s.GetRoles(ctx, uid, serviceId)
+		if err != nil {
+			return false, err
+		}
+
+		return hasRoles(roles, policy.RequiredRoles), nil
+	default:
+		return false, fmt.Errorf("service %s has an unknown access mode %q", serviceId, policy.Mode)
+	}
+}
+
+// GetServiceAccessPolicy defaults to open access when nothing has been configured
+func (s *UserService) GetServiceAccessPolicy(ctx context.Context, serviceId uuid.UUID) (*ServiceAccessPolicy, error) {
+	if err := s.checkServiceExists(ctx, serviceId); err != nil {
+		return nil, err
+	}
+
+	policy := &ServiceAccessPolicy{Mode: ServiceAccessOpen, RequiredRoles: []string{}}
+
+	row, err := s.db.GetServiceAccessPolicy(ctx, utils.UUIDToPgType(serviceId))
+	if err == nil {
+		policy.Mode = ServiceAccessMode(row.Mode)
+		policy.RequiredRoles = row.RequiredRoles
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get service access policy: %w", err)
+	}
+
+	policy.AllowedUsers, err = s.db.GetServiceAllowedUsers(ctx, utils.UUIDToPgType(serviceId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service allowlist: %w", err)
+	}
+
+	return policy, nil
+}
+
+// SetServiceAccessPolicy applies to new logins at once, sessions of users who lost access fail at their next token refresh
+func (s *UserService) SetServiceAccessPolicy(ctx context.Context, serviceId uuid.UUID, mode ServiceAccessMode, requiredRoles []string) error {
+	if _, err := ParseServiceAccessMode(string(mode)); err != nil {
+		return errs.New(errcode.InvalidArgumentError, err)
+	}
+
+	if mode == ServiceAccessRoles {
+		if err := validateRoles(requiredRoles); err != nil {
+			return err
+		}
+	} else if len(requiredRoles) > 0 {
+		return errs.New(errcode.InvalidArgumentError, fmt.Errorf("required roles only apply to the %s mode", ServiceAccessRoles))
+	}
+
+	if err := s.checkRestrictableService(ctx, serviceId); err != nil {
+		return err
+	}
+
+	requiredRoles = slices.Compact(slices.Sorted(slices.Values(requiredRoles)))
+	if requiredRoles == nil {
+		requiredRoles = []string{}
+	}
+
+	if err := s.db.SetServiceAccessPolicy(ctx, db_gen.SetServiceAccessPolicyParams{
+		ServiceID:     utils.UUIDToPgType(serviceId),
+		Mode:          string(mode),
+		RequiredRoles: requiredRoles,
+	}); err != nil {
+		return fmt.Errorf("failed to set service access policy: %w", err)
+	}
+
+	s.logger.Warn("Service access policy changed",
+		slog.String("security_event", "service_access_policy_changed"),
+		slog.String("service_id", serviceId.String()),
+		slog.String("mode", string(mode)),
+		slog.Any("required_roles", requiredRoles),
+	)
+
+	return nil
+}
+
+// AllowServiceUser adds the user to the service's allowlist, it only matters while the service is in the allowlist mode
+func (s *UserService) AllowServiceUser(ctx context.Context, serviceId uuid.UUID, uid string) error {
+	if err := s.checkRestrictableService(ctx, serviceId); err != nil {
+		return err
+	}
+
+	if err := s.db.AddServiceAllowedUser(ctx, db_gen.AddServiceAllowedUserParams{
+		ServiceID: utils.UUIDToPgType(serviceId),
+		UserID:    uid,
+	}); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+			return errs.New(errcode.UserNotFound, err)
+		}
+
+		return fmt.Errorf("failed to add user to service allowlist: %w", err)
+	}
+
+	s.logger.Warn("User allowed into service",
+		slog.String("security_event", "service_user_allowed"),
+		slog.String("uid", uid),
+		slog.String("service_id", serviceId.String()),
+	)
+
+	return nil
+}
+
+// DisallowServiceUser removes the user from the service's allowlist, users who are not on it are ignored.
+// Their sessions fail at the next token refresh while the service is in the allowlist mode.
+func (s *UserService) DisallowServiceUser(ctx context.Context, serviceId uuid.UUID, uid string) error {
+	removed, err := s.db.RemoveServiceAllowedUser(ctx, db_gen.RemoveServiceAllowedUserParams{
+		ServiceID: utils.UUIDToPgType(serviceId),
+		UserID:    uid,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove user from service allowlist: %w", err)
+	}
+
+	if removed > 0 {
+		s.logger.Warn("User removed from service allowlist",
+			slog.String("security_event", "service_user_disallowed"),
+			slog.String("uid", uid),
+			slog.String("service_id", serviceId.String()),
+		)
+	}
+
+	return nil
+}
+
+// IsInternalService reports whether tokens issued for the service may manage the user's account
+func (s *UserService) IsInternalService(ctx context.Context, serviceId string) (bool, error) {
+	internal, err := s.services.GetInternalKuuraService(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return internal.Id.String() == serviceId, nil
+}
+
+func (s *UserService) checkRestrictableService(ctx context.Context, serviceId uuid.UUID) error {
+	if err := s.checkServiceExists(ctx, serviceId); err != nil {
+		return err
+	}
+
+	internal, err := s.services.GetInternalKuuraService(ctx)
+	if err != nil {
+		return err
+	}
+
+	if internal.Id == serviceId {
+		return errs.New(errcode.InvalidArgumentError, errors.New("the internal service is open to every user so they can manage their account"))
+	}
+
+	return nil
+}
+
+func hasRoles(roles []string, required []string) bool {
+	for _, role := range required {
+		if !slices.Contains(roles, role) {
+			return false
+		}
+	}
+
+	return true
+}
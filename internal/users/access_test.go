@@ -0,0 +1,129 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/testdb"
+	"github.com/kymppi/kuura/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServiceAccessMode(t *testing.T) {
+	for _, value := range []string{"open", "allowlist", "roles"} {
+		t.Run(value, func(t *testing.T) {
+			mode, err := ParseServiceAccessMode(value)
+			assert.NoError(t, err)
+			assert.Equal(t, ServiceAccessMode(value), mode)
+		})
+	}
+
+	t.Run("Unknown mode", func(t *testing.T) {
+		_, err := ParseServiceAccessMode("closed")
+		assert.Error(t, err)
+	})
+}
+
+func TestHasRoles(t *testing.T) {
+	t.Run("Every required role", func(t *testing.T) {
+		assert.True(t, hasRoles([]string{"admin", "finance"}, []string{"finance"}))
+	})
+
+	t.Run("Missing a required role", func(t *testing.T) {
+		assert.False(t, hasRoles([]string{"finance"}, []string{"admin", "finance"}))
+	})
+
+	t.Run("No roles", func(t *testing.T) {
+		assert.False(t, hasRoles([]string{}, []string{"finance"}))
+	})
+}
+
+func TestCheckServiceAccess(t *testing.T) {
+	ctx := context.Background()
+	queries := testdb.New(t)
+	service := newTestUserService(queries, "test", map[string][]byte{"test": newTestKey()})
+
+	// every check looks up the internal service first
+	assert.NoError(t, service.services.CreateInternalServiceIfNotExists(ctx, "kuura.example.com"))
+
+	uid := createTestUser(t, queries, "user")
+
+	t.Run("Open", func(t *testing.T) {
+		serviceId := createTestService(t, queries)
+		assert.NoError(t, service.CheckServiceAccess(ctx, uid, serviceId))
+
+		assert.NoError(t, service.SetServiceAccessPolicy(ctx, serviceId, ServiceAccessOpen, nil))
+		assert.NoError(t, service.CheckServiceAccess(ctx, uid, serviceId))
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		serviceId := createTestService(t, queries)
+		assert.NoError(t, service.SetServiceAccessPolicy(ctx, serviceId, ServiceAccessAllowlist, nil))
+		assertErrorCode(t, service.CheckServiceAccess(ctx, uid, serviceId), errcode.ServiceAccessDenied)
+
+		assert.NoError(t, service.AllowServiceUser(ctx, serviceId, uid))
+		assert.NoError(t, service.CheckServiceAccess(ctx, uid, serviceId))
+
+		assert.NoError(t, service.DisallowServiceUser(ctx, serviceId, uid))
+		assertErrorCode(t, service.CheckServiceAccess(ctx, uid, serviceId), errcode.ServiceAccessDenied)
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		serviceId := createTestService(t, queries)
+		assert.NoError(t, service.SetServiceAccessPolicy(ctx, serviceId, ServiceAccessRoles, []string{"admin", "finance"}))
+
+		_, err := service.AddRoles(ctx, uid, serviceId, []string{"finance"})
+		assert.NoError(t, err)
+		assertErrorCode(t, service.CheckServiceAccess(ctx, uid, serviceId), errcode.ServiceAccessDenied)
+
+		_, err = service.AddRoles(ctx, uid, serviceId, []string{"admin"})
+		assert.NoError(t, err)
+		assert.NoError(t, service.CheckServiceAccess(ctx, uid, serviceId))
+
+		_, err = service.RemoveRoles(ctx, uid, serviceId, []string{"admin"})
+		assert.NoError(t, err)
+		assertErrorCode(t, service.CheckServiceAccess(ctx, uid, serviceId), errcode.ServiceAccessDenied)
+	})
+
+	t.Run("Internal service", func(t *testing.T) {
+		internal, err := service.services.GetInternalKuuraService(ctx)
+		assert.NoError(t, err)
+
+		// SetServiceAccessPolicy refuses the internal service, a policy stored anyway must not lock users out
+		assert.NoError(t, queries.SetServiceAccessPolicy(ctx, db_gen.SetServiceAccessPolicyParams{
+			ServiceID:     utils.UUIDToPgType(internal.Id),
+			Mode:          string(ServiceAccessAllowlist),
+			RequiredRoles: []string{},
+		}))
+		assert.NoError(t, service.CheckServiceAccess(ctx, uid, internal.Id))
+	})
+
+	t.Run("Invitation restricted", func(t *testing.T) {
+		invited, other := createTestService(t, queries), createTestService(t, queries)
+		for _, serviceId := range []uuid.UUID{invited, other} {
+			assert.NoError(t, service.SetServiceAccessPolicy(ctx, serviceId, ServiceAccessAllowlist, nil))
+		}
+
+		token, _, err := service.CreateInvitation(ctx, nil, []uuid.UUID{invited}, time.Hour)
+		assert.NoError(t, err)
+		invitedUid, err := service.RegisterWithInvitation(ctx, token, "invited", "verifier")
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.CheckServiceAccess(ctx, invitedUid, invited))
+		assertErrorCode(t, service.CheckServiceAccess(ctx, invitedUid, other), errcode.ServiceAccessDenied)
+	})
+
+	t.Run("Refresh after losing access", func(t *testing.T) {
+		serviceId := createTestService(t, queries)
+		session := &models.UserSession{UserId: uid, ServiceId: &serviceId}
+		assert.NoError(t, service.checkSessionAllowed(ctx, session))
+
+		assert.NoError(t, service.SetServiceAccessPolicy(ctx, serviceId, ServiceAccessAllowlist, nil))
+		assertErrorCode(t, service.checkSessionAllowed(ctx, session), errcode.ServiceAccessDenied)
+	})
+}
@@ -0,0 +1,50 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/testdb"
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisableUser(t *testing.T) {
+	ctx := context.Background()
+	queries := testdb.New(t)
+	service := newTestUserService(queries, "test", map[string][]byte{"test": newTestKey()})
+
+	// every session checks the service access, which looks up the internal service first
+	assert.NoError(t, service.services.CreateInternalServiceIfNotExists(ctx, "kuura.example.com"))
+
+	uid := createTestUser(t, queries, "user")
+	serviceId := createTestService(t, queries)
+
+	t.Run("Deletes the sessions", func(t *testing.T) {
+		sessionId, err := service.CreateSessionForFutureUse(ctx, uid, serviceId)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.DisableUser(ctx, uid))
+
+		_, err = queries.GetUserSession(ctx, sessionId)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	t.Run("No new sessions", func(t *testing.T) {
+		_, err := service.CreateSessionForFutureUse(ctx, uid, serviceId)
+		assertErrorCode(t, err, errcode.UserDisabled)
+	})
+
+	t.Run("Sessions after enabling", func(t *testing.T) {
+		assert.NoError(t, service.EnableUser(ctx, uid))
+
+		_, err := service.CreateSessionForFutureUse(ctx, uid, serviceId)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		assertErrorCode(t, service.DisableUser(ctx, ulid.Make().String()), errcode.UserNotFound)
+	})
+}
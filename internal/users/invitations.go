@@ -0,0 +1,201 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/utils"
+)
+
+// CreateInvitation returns a single-use token, only its HMAC is stored.
+// The invited user is added to the allowlist of each service and gets the roles in them. Every service must be in
+// the allowlist mode, otherwise listing it would not limit who gets in and the invitation is refused.
+func (s *UserService) CreateInvitation(ctx context.Context, roles []string, serviceIds []uuid.UUID, validFor time.Duration) (token string, invitation *models.UserInvitation, err error) {
+	if validFor <= 0 {
+		return "", nil, errs.New(errcode.InvalidArgumentError, errors.New("invitation must be valid for a positive duration"))
+	}
+
+	if len(roles) > 0 {
+		if err := validateRoles(roles); err != nil {
+			return "", nil, err
+		}
+
+		// roles are granted per service
+		if len(serviceIds) == 0 {
+			return "", nil, errs.New(errcode.InvalidArgumentError, errors.New("roles require the services they are granted in"))
+		}
+	}
+
+	// a repeated service would break the allowlist insert when the invitation is used
+	serviceIds = slices.Compact(slices.SortedFunc(slices.Values(serviceIds), func(a, b uuid.UUID) int {
+		return bytes.Compare(a[:], b[:])
+	}))
+	for _, serviceId := range serviceIds {
+		if err := s.checkServiceExists(ctx, serviceId); err != nil {
+			return "", nil, err
+		}
+
+		if err := s.checkAllowlistService(ctx, serviceId); err != nil {
+			return "", nil, err
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create new uuid: %w", err)
+	}
+
+	token, err = generateOpaqueToken(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+
+	if roles == nil {
+		roles = []string{}
+	}
+
+	expiresAt := time.Now().Add(validFor)
+
+	if err := s.db.CreateUserInvitation(ctx, db_gen.CreateUserInvitationParams{
+		ID:          utils.UUIDToPgType(id),
+		HashedToken: hashCodeHMAC(token, s.tokenCodeHashingSecret),
+		Roles:       roles,
+		Services:    utils.MapSlice(serviceIds, utils.UUIDToPgType),
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  expiresAt,
+			Valid: true,
+		},
+	}); err != nil {
+		return "", nil, fmt.Errorf("failed to save invitation: %w", err)
+	}
+
+	s.logger.Info("Invitation created",
+		slog.String("security_event", "invitation_created"),
+		slog.String("invitation_id", id.String()),
+		slog.Any("roles", roles),
+	)
+
+	return token, &models.UserInvitation{
+		Id:        id,
+		Roles:     roles,
+		Services:  serviceIds,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (s *UserService) checkAllowlistService(ctx context.Context, serviceId uuid.UUID) error {
+	policy, err := s.db.GetServiceAccessPolicy(ctx, utils.UUIDToPgType(serviceId))
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && ServiceAccessMode(policy.Mode) != ServiceAccessAllowlist) {
+		return errs.New(errcode.InvalidArgumentError, fmt.Errorf("service %s is not in the %s mode, an invitation could not limit who gets in", serviceId, ServiceAccessAllowlist))
+	} else if err != nil {
+		return fmt.Errorf("failed to get service access policy: %w", err)
+	}
+
+	return nil
+}
+
+func (s *UserService) GetInvitations(ctx context.Context) ([]*models.UserInvitation, error) {
+	rows, err := s.db.GetUserInvitations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*models.UserInvitation{}
+	for _, row := range rows {
+		id, err := utils.PgTypeUUIDToUUID(row.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		serviceIds, err := utils.MapSliceE(row.Services, utils.PgTypeUUIDToUUID)
+		if err != nil {
+			return nil, err
+		}
+
+		invitation := &models.UserInvitation{
+			Id:        id,
+			Roles:     row.Roles,
+			Services:  serviceIds,
+			ExpiresAt: row.ExpiresAt.Time,
+			CreatedAt: row.CreatedAt.Time,
+		}
+
+		if row.UsedAt.Valid {
+			invitation.UsedAt = &row.UsedAt.Time
+		}
+		if row.UsedBy.Valid {
+			invitation.UsedBy = &row.UsedBy.String
+		}
+
+		result = append(result, invitation)
+	}
+
+	return result, nil
+}
+
+// RevokeInvitation deletes an invitation that has not been used yet
+func (s *UserService) RevokeInvitation(ctx context.Context, id uuid.UUID) error {
+	deleted, err := s.db.DeleteUnusedUserInvitation(ctx, utils.UUIDToPgType(id))
+	if err != nil {
+		return fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	if deleted == 0 {
+		return errs.New(errcode.InvitationNotFound, fmt.Errorf("no unused invitation %s", id))
+	}
+
+	s.logger.Info("Invitation revoked",
+		slog.String("security_event", "invitation_revoked"),
+		slog.String("invitation_id", id.String()),
+	)
+
+	return nil
+}
+
+// RegisterWithInvitation is Register for invited users, the invitation is used up in the same statement that creates the user
+func (s *UserService) RegisterWithInvitation(ctx context.Context, token string, username string, verifier string) (uid string, err error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("failed to create new uuid: %w", err)
+	}
+
+	_, err = s.db.CreateInvitedUser(ctx, db_gen.CreateInvitedUserParams{
+		ID:              id.String(),
+		HashedToken:     hashCodeHMAC(token, s.tokenCodeHashingSecret),
+		Username:        username,
+		HashedUsername:  hashUsername(username),
+		EncodedVerifier: verifier,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errs.New(errcode.InvitationInvalid, errors.New("invitation is unknown, expired, used or one of its services is no longer in the allowlist mode"))
+	} else if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return "", errs.New(errcode.UsernameTaken, err)
+		}
+
+		return "", fmt.Errorf("failed to create user in db: %w", err)
+	}
+
+	s.logger.Info("Created new user from an invitation",
+		slog.String("security_event", "invitation_used"),
+		slog.String("username", username),
+	)
+
+	return id.String(), nil
+}
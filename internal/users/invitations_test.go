@@ -0,0 +1,70 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/testdb"
+	"github.com/kymppi/kuura/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterWithInvitation(t *testing.T) {
+	ctx := context.Background()
+	queries := testdb.New(t)
+	service := newTestUserService(queries, "test", map[string][]byte{"test": newTestKey()})
+
+	invited, other := createTestService(t, queries), createTestService(t, queries)
+	for _, serviceId := range []uuid.UUID{invited, other} {
+		assert.NoError(t, service.SetServiceAccessPolicy(ctx, serviceId, ServiceAccessAllowlist, nil))
+	}
+
+	token, invitation, err := service.CreateInvitation(ctx, []string{"editor"}, []uuid.UUID{invited, invited}, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{invited}, invitation.Services)
+
+	uid, err := service.RegisterWithInvitation(ctx, token, "invited", "verifier")
+	assert.NoError(t, err)
+
+	for serviceId, expected := range map[uuid.UUID]bool{invited: true, other: false} {
+		allowed, err := queries.IsUserAllowedInService(ctx, db_gen.IsUserAllowedInServiceParams{
+			ServiceID: utils.UUIDToPgType(serviceId),
+			UserID:    uid,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, allowed)
+	}
+
+	roles, err := service.GetRoles(ctx, uid, invited)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"editor"}, roles)
+
+	t.Run("Used once", func(t *testing.T) {
+		_, err := service.RegisterWithInvitation(ctx, token, "again", "verifier")
+		assert.Error(t, err)
+	})
+
+	t.Run("Roles need services", func(t *testing.T) {
+		_, _, err := service.CreateInvitation(ctx, []string{"editor"}, nil, time.Hour)
+		assert.Error(t, err)
+	})
+
+	t.Run("Open service", func(t *testing.T) {
+		_, _, err := service.CreateInvitation(ctx, nil, []uuid.UUID{createTestService(t, queries)}, time.Hour)
+		assertErrorCode(t, err, errcode.InvalidArgumentError)
+	})
+
+	t.Run("Service opened before use", func(t *testing.T) {
+		token, _, err := service.CreateInvitation(ctx, nil, []uuid.UUID{other}, time.Hour)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.SetServiceAccessPolicy(ctx, other, ServiceAccessOpen, nil))
+
+		_, err = service.RegisterWithInvitation(ctx, token, "late", "verifier")
+		assertErrorCode(t, err, errcode.InvitationInvalid)
+	})
+}
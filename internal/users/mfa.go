@@ -0,0 +1,122 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/utils"
+)
+
+const MFAMethodTOTP = "totp"
+
+const (
+	mfaChallengeDuration    = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+)
+
+// MFAMethods lists the second factors the user has enabled, empty when the password alone is enough
+func (s *UserService) MFAMethods(ctx context.Context, uid string) ([]string, error) {
+	methods := []string{}
+
+	totpEnabled, err := s.TOTPEnabled(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check totp status: %w", err)
+	}
+
+	if totpEnabled {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	webauthnEnabled, err := s.WebAuthnEnabled(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check passkeys: %w", err)
+	}
+
+	if webauthnEnabled {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+
+	return methods, nil
+}
+
+// BeginMFAChallenge records a login that passed SRP, the token is exchanged for a session once a second factor is verified
+func (s *UserService) BeginMFAChallenge(ctx context.Context, uid string, serviceId uuid.UUID) (token string, err error) {
+	token, err = generateOpaqueToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate mfa token: %w", err)
+	}
+
+	if err := s.db.CreateMFAChallenge(ctx, db_gen.CreateMFAChallengeParams{
+		HashedToken: hashCodeHMAC(token, s.tokenCodeHashingSecret),
+		UserID:      uid,
+		ServiceID:   utils.UUIDToPgType(serviceId),
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(mfaChallengeDuration),
+			Valid: true,
+		},
+	}); err != nil {
+		return "", fmt.Errorf("failed to create mfa challenge: %w", err)
+	}
+
+	s.logger.Info("User login is waiting for a second factor", slog.String("uid", uid))
+
+	return token, nil
+}
+
+// CompleteMFAChallengeTOTP verifies a TOTP code for a pending login and returns who logged in to which service
+func (s *UserService) CompleteMFAChallengeTOTP(ctx context.Context, token string, code string) (uid string, serviceId uuid.UUID, err error) {
+	hashedToken := hashCodeHMAC(token, s.tokenCodeHashingSecret)
+
+	challenge, err := s.attemptMFAChallenge(ctx, hashedToken)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	if err := s.VerifyTOTP(ctx, challenge.UserID, code); err != nil {
+		return "", uuid.Nil, err
+	}
+
+	return s.consumeMFAChallenge(ctx, hashedToken, challenge)
+}
+
+// every attempt is counted before the factor is checked so guessing stops after mfaChallengeMaxAttempts
+func (s *UserService) attemptMFAChallenge(ctx context.Context, hashedToken string) (*db_gen.AttemptMFAChallengeRow, error) {
+	challenge, err := s.db.AttemptMFAChallenge(ctx, db_gen.AttemptMFAChallengeParams{
+		HashedToken: hashedToken,
+		Attempts:    mfaChallengeMaxAttempts,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.New(errcode.MFAChallengeExpired, errors.New("mfa challenge not found, expired or out of attempts"))
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+
+	return &challenge, nil
+}
+
+func (s *UserService) consumeMFAChallenge(ctx context.Context, hashedToken string, challenge *db_gen.AttemptMFAChallengeRow) (string, uuid.UUID, error) {
+	deleted, err := s.db.DeleteMFAChallenge(ctx, hashedToken)
+	if err != nil {
+		return "", uuid.Nil, fmt.Errorf("failed to delete mfa challenge: %w", err)
+	} else if deleted == 0 {
+		return "", uuid.Nil, errs.New(errcode.MFAChallengeExpired, errors.New("mfa challenge was already used"))
+	}
+
+	serviceId, err := utils.PgTypeUUIDToUUID(challenge.ServiceID)
+	if err != nil {
+		return "", uuid.Nil, fmt.Errorf("failed to parse challenge's service id: %w", err)
+	}
+
+	s.logger.Info("User completed second factor", slog.String("uid", challenge.UserID))
+
+	return challenge.UserID, serviceId, nil
+}
@@ -0,0 +1,193 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const CodeChallengeMethodS256 = "S256"
+const IDTokenDuration = 10 * time.Minute
+
+// CreateAuthorizationCode creates a session for future use and a PKCE bound code that can be exchanged for it
+func (s *UserService) CreateAuthorizationCode(ctx context.Context, uid string, serviceId uuid.UUID, redirectUri string, codeChallenge string, nonce string) (string, error) {
+	service, err := s.services.GetService(ctx, serviceId)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.GetUser(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+
+	if redirectUri != service.LoginRedirect {
+		return "", errs.New(errcode.InvalidRedirectURI, fmt.Errorf("redirect_uri '%s' is not registered", redirectUri))
+	}
+
+	code, err := generateOpaqueToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate opaque code: %w", err)
+	}
+
+	sessionId, err := s.CreateSessionForFutureUse(ctx, uid, serviceId)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.db.InsertAuthorizationCode(ctx, db_gen.InsertAuthorizationCodeParams{
+		SessionID: sessionId,
+		ExpiresAt: pgtype.Timestamptz{
+			Valid: true,
+			Time:  time.Now().Add(5 * time.Minute),
+		},
+		HashedCode: hashCodeHMAC(code, s.tokenCodeHashingSecret),
+		CodeChallenge: pgtype.Text{
+			String: codeChallenge,
+			Valid:  true,
+		},
+		RedirectUri: pgtype.Text{
+			String: redirectUri,
+			Valid:  true,
+		},
+		Nonce: pgtype.Text{
+			String: nonce,
+			Valid:  nonce != "",
+		},
+		AuthTime: authTime(user),
+	}); err != nil {
+		return "", fmt.Errorf("failed to insert authorization code: %w", err)
+	}
+
+	s.logger.Info("Issued authorization code", slog.String("uid", uid), slog.String("service_id", serviceId.String()))
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode redeems a code created by CreateAuthorizationCode, the code is single-use even when the exchange fails
+func (s *UserService) ExchangeAuthorizationCode(ctx context.Context, code string, clientId uuid.UUID, redirectUri string, codeVerifier string) (*TokenInfo, error) {
+	row, err := s.db.UseAuthorizationCode(ctx, hashCodeHMAC(code, s.tokenCodeHashingSecret))
+	if err != nil {
+		return nil, errs.New(errcode.InvalidGrant, fmt.Errorf("failed to use authorization code: %w", err))
+	}
+
+	if !VerifyCodeChallenge(row.CodeChallenge.String, codeVerifier) {
+		return nil, errs.New(errcode.InvalidGrant, errors.New("code_verifier does not match code_challenge"))
+	}
+
+	if row.RedirectUri.String != redirectUri {
+		return nil, errs.New(errcode.InvalidGrant, errors.New("redirect_uri does not match the authorization request"))
+	}
+
+	session, err := s.GetSession(ctx, row.SessionID)
+	if err != nil {
+		return nil, errs.New(errcode.InvalidGrant, fmt.Errorf("failed to get session: %w", err))
+	}
+
+	if session.ServiceId == nil || *session.ServiceId != clientId {
+		return nil, errs.New(errcode.InvalidGrant, errors.New("authorization code was not issued to this client"))
+	}
+
+	if err := s.checkSessionAllowed(ctx, session); err != nil {
+		return nil, errs.New(errcode.InvalidGrant, err)
+	}
+
+	roles, err := s.sessionRoles(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	tokenInfo, err := s.buildAndSignAccessToken(ctx, session, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUser(ctx, session.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := s.buildAndSignIDToken(ctx, user, clientId, row.Nonce.String, row.AuthTime)
+	if err != nil {
+		return nil, err
+	}
+	tokenInfo.IDToken = idToken
+
+	return tokenInfo, nil
+}
+
+// OIDC Core section 2, the audience of an id_token is the client (service id), not the service's API audience
+func (s *UserService) buildAndSignIDToken(ctx context.Context, user *models.User, clientId uuid.UUID, nonce string, authTime pgtype.Timestamptz) (string, error) {
+	builder := jwt.NewBuilder().
+		Audience([]string{clientId.String()}).
+		Issuer(s.jwtIssuer).
+		Subject(user.Id).
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(IDTokenDuration)).
+		Claim("azp", clientId.String()).
+		Claim("preferred_username", user.Username).
+		Claim("service_id", clientId.String())
+
+	if nonce != "" {
+		builder = builder.Claim("nonce", nonce)
+	}
+
+	if authTime.Valid {
+		builder = builder.Claim("auth_time", authTime.Time.Unix())
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build id token: %w", err)
+	}
+
+	signingKey, err := s.jwkManager.GetSigningKey(ctx, clientId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get signing key: %w", err)
+	}
+
+	signedToken, err := jwt.Sign(token, jwt.WithKey(signingKey.Algorithm(), signingKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign id token: %w", err)
+	}
+
+	return string(signedToken), nil
+}
+
+// the last SRP login is when the user actually authenticated
+func authTime(user *models.User) pgtype.Timestamptz {
+	if user.LastLoginAt == nil {
+		return pgtype.Timestamptz{}
+	}
+
+	return pgtype.Timestamptz{
+		Time:  *user.LastLoginAt,
+		Valid: true,
+	}
+}
+
+// VerifyCodeChallenge checks a PKCE code_verifier against an S256 code_challenge (RFC 7636)
+func VerifyCodeChallenge(challenge string, verifier string) bool {
+	// 43-128 characters from the unreserved set, RFC 7636 section 4.1
+	if len(verifier) < 43 || len(verifier) > 128 || challenge == "" {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
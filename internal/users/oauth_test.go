@@ -0,0 +1,34 @@
+package users
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// RFC 7636 Appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	t.Run("Matching verifier", func(t *testing.T) {
+		assert.True(t, VerifyCodeChallenge(challenge, verifier))
+	})
+
+	t.Run("Wrong verifier", func(t *testing.T) {
+		assert.False(t, VerifyCodeChallenge(challenge, strings.Repeat("a", 43)))
+	})
+
+	t.Run("Verifier too short", func(t *testing.T) {
+		assert.False(t, VerifyCodeChallenge(challenge, verifier[:42]))
+	})
+
+	t.Run("Verifier too long", func(t *testing.T) {
+		assert.False(t, VerifyCodeChallenge(challenge, strings.Repeat("a", 129)))
+	})
+
+	t.Run("Empty challenge", func(t *testing.T) {
+		assert.False(t, VerifyCodeChallenge("", verifier))
+	})
+}
@@ -0,0 +1,122 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/opencoff/go-srp"
+)
+
+// BeginPasswordChange starts a fresh SRP handshake, a logged in user has to prove the current password again
+func (s *UserService) BeginPasswordChange(ctx context.Context, uid string, creds string) (string, error) {
+	return s.beginReproof(ctx, uid, creds)
+}
+
+// ChangePassword finishes the handshake of BeginPasswordChange and replaces the verifier,
+// every other session of the user is revoked
+func (s *UserService) ChangePassword(ctx context.Context, uid string, currentSessionId string, ih string, data string, verifier string) (proof string, err error) {
+	if err := s.checkIdentity(ctx, uid, ih); err != nil {
+		return "", err
+	}
+
+	if err := s.validateVerifier(ctx, uid, verifier); err != nil {
+		return "", err
+	}
+
+	proof, err = s.finishHandshake(ctx, uid, data)
+	if err != nil {
+		return "", err
+	}
+
+	// the new password must not take effect while sessions made with the old one survive
+	var revoked int64
+	err = s.db.InTx(ctx, func(db *db_gen.Queries) error {
+		updated, err := db.UpdateUserVerifier(ctx, db_gen.UpdateUserVerifierParams{
+			ID:              uid,
+			EncodedVerifier: verifier,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update verifier: %w", err)
+		} else if updated == 0 {
+			return errs.New(errcode.UserNotFound, errors.New("user not found"))
+		}
+
+		revoked, err = db.DeleteOtherUserSessions(ctx, db_gen.DeleteOtherUserSessionsParams{
+			UserID: uid,
+			ID:     currentSessionId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revoke other sessions: %w", err)
+		}
+
+		// logins that passed SRP with the old password must not finish either
+		if err := db.DeleteUserMFAChallenges(ctx, uid); err != nil {
+			return fmt.Errorf("failed to delete pending mfa challenges: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.Warn("User changed their password",
+		slog.String("security_event", "password_changed"),
+		slog.String("uid", uid),
+		slog.Int64("revoked_sessions", revoked),
+	)
+
+	return proof, nil
+}
+
+// SRP handshake of a user who is already logged in, the identity must be their own
+func (s *UserService) beginReproof(ctx context.Context, uid string, creds string) (string, error) {
+	ih, A, err := srp.ServerBegin(creds)
+	if err != nil {
+		return "", errs.New(errcode.InvalidArgumentError, fmt.Errorf("failed to begin server: %w", err))
+	}
+
+	if err := s.checkIdentity(ctx, uid, ih); err != nil {
+		return "", err
+	}
+
+	return s.beginHandshake(ctx, uid, A)
+}
+
+func (s *UserService) checkIdentity(ctx context.Context, uid string, ih string) error {
+	owner, err := s.db.GetUserIDFromUsernameHash(ctx, ih)
+	if err != nil || owner != uid {
+		return errs.New(errcode.Unauthorized, errors.New("srp identity does not belong to the user"))
+	}
+
+	return nil
+}
+
+// the browser computes the verifier, it has to carry the user's own identity
+func (s *UserService) validateVerifier(ctx context.Context, uid string, verifier string) error {
+	ih, err := verifierIdentity(verifier)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkIdentity(ctx, uid, ih); err != nil {
+		return errs.New(errcode.InvalidArgumentError, errors.New("verifier was made for another identity"))
+	}
+
+	return nil
+}
+
+func verifierIdentity(verifier string) (string, error) {
+	_, v, err := srp.MakeSRPVerifier(verifier)
+	if err != nil {
+		return "", errs.New(errcode.InvalidArgumentError, fmt.Errorf("invalid verifier: %w", err))
+	}
+
+	ih, _ := v.Encode()
+	return ih, nil
+}
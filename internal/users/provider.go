@@ -5,8 +5,11 @@ import (
 
 	tokenhasher "github.com/kymppi/kuura/internal/argon2"
 	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/encrypted_storage"
 	"github.com/kymppi/kuura/internal/jwks"
 	"github.com/kymppi/kuura/internal/services"
+	"github.com/kymppi/kuura/internal/settings"
+	"github.com/kymppi/kuura/internal/webauthn"
 )
 
 type UserService struct {
@@ -16,11 +19,18 @@ type UserService struct {
 	jwtIssuer   string
 	jwkManager  *jwks.JWKManager
 	services    *services.ServiceManager
+	settings    *settings.SettingsService
+	encryptor   *encrypted_storage.SymmetricKeyEncryptor
+
+	relyingParty *webauthn.RelyingParty
 
 	tokenCodeHashingSecret []byte
+
+	currentKekId string
+	keks         map[string][]byte // key encryption keys of TOTP secrets
 }
 
-func NewUserService(logger *slog.Logger, db *db_gen.Queries, jwtIssuer string, jwkManager *jwks.JWKManager, services *services.ServiceManager, tokenCodeHashingSecret []byte) *UserService {
+func NewUserService(logger *slog.Logger, db *db_gen.Queries, jwtIssuer string, jwkManager *jwks.JWKManager, services *services.ServiceManager, tokenCodeHashingSecret []byte, currentKekId string, keks map[string][]byte, relyingParty *webauthn.RelyingParty) *UserService {
 	return &UserService{
 		logger: logger,
 		db:     db,
@@ -34,6 +44,11 @@ func NewUserService(logger *slog.Logger, db *db_gen.Queries, jwtIssuer string, j
 		jwtIssuer:              jwtIssuer,
 		jwkManager:             jwkManager,
 		services:               services,
+		settings:               settings.NewSettingsService(logger, db),
+		encryptor:              encrypted_storage.NewSymmetricKeyEncryptor(),
 		tokenCodeHashingSecret: tokenCodeHashingSecret,
+		currentKekId:           currentKekId,
+		keks:                   keks,
+		relyingParty:           relyingParty,
 	}
 }
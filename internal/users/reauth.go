@@ -0,0 +1,120 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/webauthn"
+)
+
+// how long proving the identity again unlocks sensitive account changes in the same session
+const reauthenticationWindow = 5 * time.Minute
+
+// RequireReauthentication fails unless the user proved their identity again in this session within the last few minutes,
+// a stolen session cookie alone must not be enough to add second factors or replace recovery codes
+func (s *UserService) RequireReauthentication(ctx context.Context, uid string, sessionId string) error {
+	session, err := s.db.GetUserSession(ctx, sessionId)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && session.UserID != uid) {
+		return errs.New(errcode.Unauthorized, errors.New("session not found"))
+	} else if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if !session.ReauthenticatedAt.Valid || time.Since(session.ReauthenticatedAt.Time) > reauthenticationWindow {
+		return errs.New(errcode.ReauthenticationRequired, errors.New("session was not reauthenticated recently"))
+	}
+
+	return nil
+}
+
+// BeginReauthenticationSRP is the SRP begin step of ReauthenticateSRP
+func (s *UserService) BeginReauthenticationSRP(ctx context.Context, uid string, creds string) (string, error) {
+	return s.beginReproof(ctx, uid, creds)
+}
+
+// ReauthenticateSRP checks the proof of the current password
+func (s *UserService) ReauthenticateSRP(ctx context.Context, uid string, sessionId string, ih string, data string) (proof string, err error) {
+	if err := s.checkIdentity(ctx, uid, ih); err != nil {
+		return "", err
+	}
+
+	proof, err = s.finishHandshake(ctx, uid, data)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.markReauthenticated(ctx, uid, sessionId, "password"); err != nil {
+		return "", err
+	}
+
+	return proof, nil
+}
+
+func (s *UserService) ReauthenticateTOTP(ctx context.Context, uid string, sessionId string, code string) error {
+	if err := s.VerifyTOTP(ctx, uid, code); err != nil {
+		return err
+	}
+
+	return s.markReauthenticated(ctx, uid, sessionId, MFAMethodTOTP)
+}
+
+// BeginReauthenticationWebAuthn returns the options for asserting one of the user's own passkeys
+func (s *UserService) BeginReauthenticationWebAuthn(ctx context.Context, uid string) (*webauthn.RequestOptions, error) {
+	credentials, err := s.db.GetUserWebAuthnCredentials(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkeys: %w", err)
+	} else if len(credentials) == 0 {
+		return nil, errs.New(errcode.WebAuthnCredentialNotFound, errors.New("user has no passkeys"))
+	}
+
+	challenge, err := s.createWebAuthnChallenge(ctx, webauthnCeremonyReauth, uid, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.relyingParty.RequestOptions(challenge, credentialDescriptors(credentials), webauthn.UserVerificationPreferred), nil
+}
+
+func (s *UserService) ReauthenticateWebAuthn(ctx context.Context, uid string, sessionId string, response *webauthn.AssertionResponse) error {
+	challenge, pending, err := s.useWebAuthnChallenge(ctx, response.Response.ClientDataJSON, webauthnCeremonyReauth)
+	if err != nil {
+		return err
+	}
+
+	if pending.UserID.String != uid {
+		return errs.New(errcode.WebAuthnFailed, errors.New("passkey challenge belongs to another user"))
+	}
+
+	if _, err := s.verifyWebAuthnAssertion(ctx, response, challenge, uid, false); err != nil {
+		return err
+	}
+
+	return s.markReauthenticated(ctx, uid, sessionId, MFAMethodWebAuthn)
+}
+
+func (s *UserService) markReauthenticated(ctx context.Context, uid string, sessionId string, method string) error {
+	updated, err := s.db.UpdateUserSessionReauthenticatedAt(ctx, db_gen.UpdateUserSessionReauthenticatedAtParams{
+		ID:     sessionId,
+		UserID: uid,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	} else if updated == 0 {
+		return errs.New(errcode.Unauthorized, errors.New("session not found"))
+	}
+
+	s.logger.Info("User reauthenticated",
+		slog.String("uid", uid),
+		slog.String("session_id", sessionId),
+		slog.String("method", method),
+	)
+
+	return nil
+}
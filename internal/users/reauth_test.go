@@ -0,0 +1,64 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/testdb"
+	"github.com/kymppi/kuura/internal/utils"
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestSession(t *testing.T, queries *db_gen.Queries, uid string) string {
+	t.Helper()
+
+	ctx := context.Background()
+
+	serviceId := createTestService(t, queries)
+
+	sessionId := ulid.Make().String()
+	if _, err := queries.CreateUserSession(ctx, db_gen.CreateUserSessionParams{
+		ID:        sessionId,
+		UserID:    uid,
+		ServiceID: utils.UUIDToPgType(serviceId),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true},
+	}); err != nil {
+		t.Fatalf("failed to create session: %s", err)
+	}
+
+	return sessionId
+}
+
+func TestRequireReauthentication(t *testing.T) {
+	ctx := context.Background()
+	queries := testdb.New(t)
+	service := newTestUserService(queries, "test", map[string][]byte{"test": newTestKey()})
+
+	uid := createTestUser(t, queries, "user")
+	sessionId := createTestSession(t, queries, uid)
+
+	assertErrorCode(t, service.RequireReauthentication(ctx, uid, sessionId), errcode.ReauthenticationRequired)
+
+	assert.NoError(t, service.markReauthenticated(ctx, uid, sessionId, "test"))
+	assert.NoError(t, service.RequireReauthentication(ctx, uid, sessionId))
+
+	t.Run("Other session", func(t *testing.T) {
+		other := createTestSession(t, queries, uid)
+		assertErrorCode(t, service.RequireReauthentication(ctx, uid, other), errcode.ReauthenticationRequired)
+	})
+
+	t.Run("Other user", func(t *testing.T) {
+		attacker := createTestUser(t, queries, "attacker")
+		assertErrorCode(t, service.RequireReauthentication(ctx, attacker, sessionId), errcode.Unauthorized)
+		assertErrorCode(t, service.markReauthenticated(ctx, attacker, sessionId, "test"), errcode.Unauthorized)
+	})
+
+	t.Run("No session", func(t *testing.T) {
+		assertErrorCode(t, service.RequireReauthentication(ctx, uid, ""), errcode.Unauthorized)
+	})
+}
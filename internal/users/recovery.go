@@ -0,0 +1,199 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10 // shown as two groups of five
+	// Crockford's base32, the letters that are easy to mix up are left out
+	recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+)
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes, the earlier ones stop working
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, uid string) ([]string, error) {
+	methods, err := s.MFAMethods(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(methods) == 0 {
+		return nil, errs.New(errcode.MFANotEnabled, errors.New("recovery codes require a second factor"))
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Warn("Recovery codes regenerated",
+		slog.String("security_event", "recovery_codes_regenerated"),
+		slog.String("uid", uid),
+	)
+
+	return codes, nil
+}
+
+func (s *UserService) RecoveryCodesRemaining(ctx context.Context, uid string) (int64, error) {
+	return s.db.CountUnusedRecoveryCodes(ctx, uid)
+}
+
+// CompleteMFAChallengeRecoveryCode accepts a recovery code in place of the second factor of a pending login
+func (s *UserService) CompleteMFAChallengeRecoveryCode(ctx context.Context, token string, code string) (uid string, serviceId uuid.UUID, err error) {
+	hashedToken := hashCodeHMAC(token, s.tokenCodeHashingSecret)
+
+	challenge, err := s.attemptMFAChallenge(ctx, hashedToken)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	if err := s.useRecoveryCode(ctx, challenge.UserID, code); err != nil {
+		return "", uuid.Nil, err
+	}
+
+	return s.consumeMFAChallenge(ctx, hashedToken, challenge)
+}
+
+// the codes are salted so every unused one has to be compared, there are at most recoveryCodeCount of them
+func (s *UserService) useRecoveryCode(ctx context.Context, uid string, code string) error {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLength {
+		return errs.New(errcode.InvalidMFACode, errors.New("malformed recovery code"))
+	}
+
+	hashes, err := s.db.GetUnusedRecoveryCodes(ctx, uid)
+	if err != nil {
+		return fmt.Errorf("failed to get recovery codes: %w", err)
+	}
+
+	for _, hash := range hashes {
+		match, err := s.tokenhasher.CompareHashAndValue(hash, code)
+		if err != nil {
+			return fmt.Errorf("failed to compare recovery code: %w", err)
+		} else if !match {
+			continue
+		}
+
+		used, err := s.db.UseRecoveryCode(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("failed to mark recovery code used: %w", err)
+		} else if used == 0 {
+			return errs.New(errcode.InvalidMFACode, errors.New("recovery code was already used"))
+		}
+
+		s.logger.Warn("User logged in with a recovery code",
+			slog.String("security_event", "recovery_code_used"),
+			slog.String("uid", uid),
+			slog.Int("remaining", len(hashes)-1),
+		)
+
+		return nil
+	}
+
+	return errs.New(errcode.InvalidMFACode, errors.New("invalid recovery code"))
+}
+
+// recovery codes are created with the first second factor, later enrollments keep the existing ones
+func (s *UserService) ensureRecoveryCodes(ctx context.Context, uid string) ([]string, error) {
+	remaining, err := s.db.CountUnusedRecoveryCodes(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	if remaining > 0 {
+		return nil, nil
+	}
+
+	return s.replaceRecoveryCodes(ctx, uid)
+}
+
+// recovery codes only stand in for a second factor, they go away with the last one
+func (s *UserService) deleteUnusableRecoveryCodes(ctx context.Context, uid string) error {
+	methods, err := s.MFAMethods(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	if len(methods) > 0 {
+		return nil
+	}
+
+	if err := s.db.DeleteUserRecoveryCodes(ctx, uid); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+func (s *UserService) replaceRecoveryCodes(ctx context.Context, uid string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		hashes[i], err = s.tokenhasher.HashValue(code)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash recovery code: %w", err)
+		}
+
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+	}
+
+	if err := s.db.ReplaceRecoveryCodes(ctx, db_gen.ReplaceRecoveryCodesParams{
+		UserID:     uid,
+		CodeHashes: hashes,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+func generateRecoveryCode() (string, error) {
+	random := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	// the alphabet has 32 characters so the modulo is unbiased
+	for i, b := range random {
+		random[i] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+	}
+
+	return string(random), nil
+}
+
+// normalizeRecoveryCode ignores case, separators and the characters left out of the alphabet that look like others
+func normalizeRecoveryCode(code string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(code) {
+		switch r {
+		case '-', ' ':
+			continue
+		case 'o':
+			r = '0'
+		case 'i', 'l':
+			r = '1'
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,28 @@
+package users
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateRecoveryCode(t *testing.T) {
+	code, err := generateRecoveryCode()
+	assert.NoError(t, err)
+	assert.Len(t, code, recoveryCodeLength)
+
+	for _, r := range code {
+		assert.True(t, strings.ContainsRune(recoveryCodeAlphabet, r), "unexpected character %q", r)
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	t.Run("Separators and case", func(t *testing.T) {
+		assert.Equal(t, "ab2cd3ef4g", normalizeRecoveryCode(" AB2CD-3EF4G "))
+	})
+
+	t.Run("Lookalike characters", func(t *testing.T) {
+		assert.Equal(t, "01100", normalizeRecoveryCode("OIl0o"))
+	})
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
 )
 
 func (s *UserService) Register(ctx context.Context, username string, verifier string) (uid string, err error) {
@@ -17,17 +22,17 @@ func (s *UserService) Register(ctx context.Context, username string, verifier st
 		return "", fmt.Errorf("failed to create new uuid: %w", err)
 	}
 
-	hash := sha256.New()
-	hash.Write([]byte(username))
-	hashInBytes := hash.Sum(nil)
-	hashedUsername := hex.EncodeToString(hashInBytes)
-
 	if err = s.db.CreateUser(ctx, db_gen.CreateUserParams{
 		ID:              id.String(),
 		Username:        username,
 		EncodedVerifier: verifier,
-		HashedUsername:  hashedUsername,
+		HashedUsername:  hashUsername(username),
 	}); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return "", errs.New(errcode.UsernameTaken, err)
+		}
+
 		return "", fmt.Errorf("failed to create user in db: %w", err)
 	}
 
@@ -35,3 +40,9 @@ func (s *UserService) Register(ctx context.Context, username string, verifier st
 
 	return id.String(), nil
 }
+
+// the SRP identity hash, users are looked up by it during the handshake
+func hashUsername(username string) string {
+	hash := sha256.Sum256([]byte(username))
+	return hex.EncodeToString(hash[:])
+}
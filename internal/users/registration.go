@@ -0,0 +1,156 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/kymppi/kuura/internal/enums/instance_setting"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+)
+
+type RegistrationMode string
+
+const (
+	RegistrationClosed     RegistrationMode = "closed" // only `kuura user create`
+	RegistrationOpen       RegistrationMode = "open"
+	RegistrationInviteOnly RegistrationMode = "invite-only"
+)
+
+func ParseRegistrationMode(value string) (RegistrationMode, error) {
+	switch mode := RegistrationMode(value); mode {
+	case RegistrationClosed, RegistrationOpen, RegistrationInviteOnly:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown registration mode %q, expected closed, open or invite-only", value)
+	}
+}
+
+type RegistrationPolicy struct {
+	Mode            RegistrationMode `json:"mode"`
+	UsernamePattern string           `json:"username_pattern,omitempty"` // must match the whole username, empty allows any
+}
+
+// GetRegistrationPolicy defaults to closed registration when nothing has been configured
+func (s *UserService) GetRegistrationPolicy(ctx context.Context) (*RegistrationPolicy, error) {
+	policy := &RegistrationPolicy{Mode: RegistrationClosed}
+
+	mode, err := s.getOptionalSetting(ctx, instance_setting.RegistrationMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != "" {
+		if policy.Mode, err = ParseRegistrationMode(mode); err != nil {
+			return nil, err
+		}
+	}
+
+	policy.UsernamePattern, err = s.getOptionalSetting(ctx, instance_setting.RegistrationUsernamePattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (s *UserService) SetRegistrationPolicy(ctx context.Context, policy *RegistrationPolicy) error {
+	if _, err := ParseRegistrationMode(string(policy.Mode)); err != nil {
+		return err
+	}
+
+	if _, err := compileUsernamePattern(policy.UsernamePattern); err != nil {
+		return err
+	}
+
+	if err := s.settings.SaveValue(ctx, instance_setting.RegistrationMode, string(policy.Mode)); err != nil {
+		return fmt.Errorf("failed to save registration mode: %w", err)
+	}
+
+	if err := s.settings.SaveValue(ctx, instance_setting.RegistrationUsernamePattern, policy.UsernamePattern); err != nil {
+		return fmt.Errorf("failed to save username pattern: %w", err)
+	}
+
+	s.logger.Info("Registration policy changed",
+		slog.String("mode", string(policy.Mode)),
+		slog.String("username_pattern", policy.UsernamePattern),
+	)
+
+	return nil
+}
+
+// SelfRegister creates a user whose verifier was computed in the browser, if the registration policy allows it.
+// An invitation is accepted in every mode, an admin created it.
+func (s *UserService) SelfRegister(ctx context.Context, username string, verifier string, invitation string) (uid string, err error) {
+	policy, err := s.GetRegistrationPolicy(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if invitation == "" {
+		switch policy.Mode {
+		case RegistrationOpen:
+		case RegistrationInviteOnly:
+			return "", errs.New(errcode.InvitationRequired, errors.New("registration requires an invitation"))
+		default:
+			return "", errs.New(errcode.RegistrationClosed, errors.New("registration is closed"))
+		}
+	}
+
+	if err := checkUsername(policy, username); err != nil {
+		return "", err
+	}
+
+	ih, err := verifierIdentity(verifier)
+	if err != nil {
+		return "", err
+	}
+
+	if ih != hashUsername(username) {
+		return "", errs.New(errcode.InvalidArgumentError, errors.New("verifier was made for another username"))
+	}
+
+	if invitation != "" {
+		return s.RegisterWithInvitation(ctx, invitation, username, verifier)
+	}
+
+	return s.Register(ctx, username, verifier)
+}
+
+func checkUsername(policy *RegistrationPolicy, username string) error {
+	pattern, err := compileUsernamePattern(policy.UsernamePattern)
+	if err != nil {
+		return err
+	}
+
+	if pattern != nil && !pattern.MatchString(username) {
+		return errs.New(errcode.UsernameNotAllowed, fmt.Errorf("username does not match %q", policy.UsernamePattern))
+	}
+
+	return nil
+}
+
+func compileUsernamePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid username pattern: %w", err)
+	}
+
+	return compiled, nil
+}
+
+func (s *UserService) getOptionalSetting(ctx context.Context, key instance_setting.InstanceSetting) (string, error) {
+	value, err := s.settings.GetValue(ctx, key)
+	if errs.IsErrorCode(err, errcode.SettingNotFound) {
+		return "", nil
+	}
+
+	return value, err
+}
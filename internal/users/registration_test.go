@@ -0,0 +1,41 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRegistrationMode(t *testing.T) {
+	for _, value := range []string{"closed", "open", "invite-only"} {
+		mode, err := ParseRegistrationMode(value)
+		assert.NoError(t, err)
+		assert.Equal(t, RegistrationMode(value), mode)
+	}
+
+	_, err := ParseRegistrationMode("invite")
+	assert.Error(t, err)
+}
+
+func TestCheckUsername(t *testing.T) {
+	t.Run("No pattern", func(t *testing.T) {
+		assert.NoError(t, checkUsername(&RegistrationPolicy{}, "anything goes"))
+	})
+
+	policy := &RegistrationPolicy{UsernamePattern: "[a-z][a-z0-9]{2,15}"}
+
+	t.Run("Matching username", func(t *testing.T) {
+		assert.NoError(t, checkUsername(policy, "kymppi"))
+	})
+
+	t.Run("Pattern must match the whole username", func(t *testing.T) {
+		err := checkUsername(policy, "kymppi!")
+		assert.True(t, errs.IsErrorCode(err, errcode.UsernameNotAllowed))
+	})
+
+	t.Run("Invalid pattern", func(t *testing.T) {
+		assert.Error(t, checkUsername(&RegistrationPolicy{UsernamePattern: "("}, "kymppi"))
+	})
+}
@@ -0,0 +1,158 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/utils"
+)
+
+// role names end up in access tokens and in the role checks of services, so they are kept boring
+var roleNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,63}$`)
+
+// GetRoles returns the roles the user has in the service, they are what its access tokens carry
+func (s *UserService) GetRoles(ctx context.Context, uid string, serviceId uuid.UUID) ([]string, error) {
+	roles, err := s.db.GetUserServiceRoles(ctx, db_gen.GetUserServiceRolesParams{
+		UserID:    uid,
+		ServiceID: utils.UUIDToPgType(serviceId),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// GetAllRoles returns the user's roles in every service where they have any
+func (s *UserService) GetAllRoles(ctx context.Context, uid string) ([]*models.ServiceRoles, error) {
+	rows, err := s.db.GetUserRolesByService(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	result := []*models.ServiceRoles{}
+	for _, row := range rows {
+		serviceId, err := utils.PgTypeUUIDToUUID(row.ServiceID)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &models.ServiceRoles{
+			ServiceId:   serviceId,
+			ServiceName: row.ServiceName,
+			Roles:       row.Roles,
+		})
+	}
+
+	return result, nil
+}
+
+// AddRoles returns the user's roles in the service after the change, roles the user already has are ignored
+func (s *UserService) AddRoles(ctx context.Context, uid string, serviceId uuid.UUID, roles []string) ([]string, error) {
+	if err := validateRoles(roles); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkServiceExists(ctx, serviceId); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.db.AddUserServiceRoles(ctx, db_gen.AddUserServiceRolesParams{
+		UserID:    uid,
+		ServiceID: utils.UUIDToPgType(serviceId),
+		Roles:     roles,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+			return nil, errs.New(errcode.UserNotFound, err)
+		}
+
+		return nil, fmt.Errorf("failed to add user roles: %w", err)
+	}
+
+	s.logger.Warn("User roles added",
+		slog.String("security_event", "user_roles_added"),
+		slog.String("uid", uid),
+		slog.String("service_id", serviceId.String()),
+		slog.Any("roles", roles),
+	)
+
+	return updated, nil
+}
+
+// RemoveRoles returns the user's roles in the service after the change, roles the user does not have are ignored
+func (s *UserService) RemoveRoles(ctx context.Context, uid string, serviceId uuid.UUID, roles []string) ([]string, error) {
+	if err := validateRoles(roles); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkServiceExists(ctx, serviceId); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.db.RemoveUserServiceRoles(ctx, db_gen.RemoveUserServiceRolesParams{
+		UserID:    uid,
+		ServiceID: utils.UUIDToPgType(serviceId),
+		Roles:     roles,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to remove user roles: %w", err)
+	}
+
+	s.logger.Warn("User roles removed",
+		slog.String("security_event", "user_roles_removed"),
+		slog.String("uid", uid),
+		slog.String("service_id", serviceId.String()),
+		slog.Any("roles", roles),
+	)
+
+	return updated, nil
+}
+
+func (s *UserService) sessionRoles(ctx context.Context, session *models.UserSession) ([]string, error) {
+	if session.ServiceId == nil {
+		return nil, fmt.Errorf("session %s has no service", session.Id)
+	}
+
+	return s.GetRoles(ctx, session.UserId, *session.ServiceId)
+}
+
+func (s *UserService) checkServiceExists(ctx context.Context, serviceId uuid.UUID) error {
+	if _, err := s.services.GetService(ctx, serviceId); errors.Is(err, pgx.ErrNoRows) {
+		return errs.New(errcode.ServiceNotFound, fmt.Errorf("service %s: %w", serviceId, err))
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateRoles(roles []string) error {
+	if len(roles) == 0 {
+		return errs.New(errcode.InvalidArgumentError, errors.New("at least one role is required"))
+	}
+
+	for _, role := range roles {
+		if !roleNamePattern.MatchString(role) {
+			return errs.New(errcode.InvalidArgumentError, fmt.Errorf("invalid role name %q, use at most 64 letters, digits and _ . : -", role))
+		}
+	}
+
+	return nil
+}
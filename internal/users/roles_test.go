@@ -0,0 +1,28 @@
+package users
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRoles(t *testing.T) {
+	t.Run("Valid names", func(t *testing.T) {
+		assert.NoError(t, validateRoles([]string{"admin", "finance:read", "Team_Lead", "v1.editor"}))
+	})
+
+	t.Run("No roles", func(t *testing.T) {
+		err := validateRoles(nil)
+		assert.True(t, errs.IsErrorCode(err, errcode.InvalidArgumentError))
+	})
+
+	for _, role := range []string{"", " admin", "-admin", "admin role", "admin,user", "äiti", strings.Repeat("a", 65)} {
+		t.Run("Invalid "+role, func(t *testing.T) {
+			err := validateRoles([]string{"admin", role})
+			assert.True(t, errs.IsErrorCode(err, errcode.InvalidArgumentError))
+		})
+	}
+}
@@ -2,11 +2,13 @@ package users
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/kymppi/kuura/internal/db_gen"
 	"github.com/kymppi/kuura/internal/errcode"
@@ -32,6 +34,15 @@ func (s *UserService) GetUser(ctx context.Context, uid string) (*models.User, er
 	return obj, nil
 }
 
+func (s *UserService) GetUserIdByUsername(ctx context.Context, username string) (string, error) {
+	uid, err := s.db.GetUserIDFromUsername(ctx, username)
+	if err != nil {
+		return "", errs.New(errcode.UserNotFound, err)
+	}
+
+	return uid, nil
+}
+
 func (s *UserService) Logout(ctx context.Context, sessionId string, uid string) error {
 	s.logger.Info("User logging out", slog.String("session_id", sessionId), slog.String("uid", uid))
 
@@ -41,6 +52,36 @@ func (s *UserService) Logout(ctx context.Context, sessionId string, uid string)
 	})
 }
 
+// RevokeSession deletes the session if the refresh token matches, revoked is false when nothing was deleted
+func (s *UserService) RevokeSession(ctx context.Context, sessionId string, refreshToken string) (revoked bool, err error) {
+	session, err := s.db.GetUserSession(ctx, sessionId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if !session.RefreshTokenHash.Valid {
+		return false, nil
+	}
+
+	valid, err := s.tokenhasher.CompareHashAndValue(session.RefreshTokenHash.String, refreshToken)
+	if err != nil || !valid {
+		return false, nil
+	}
+
+	s.logger.Info("Revoking user session", slog.String("session_id", sessionId), slog.String("uid", session.UserID))
+
+	if err := s.db.DeleteUserSession(ctx, db_gen.DeleteUserSessionParams{
+		ID:     sessionId,
+		UserID: session.UserID,
+	}); err != nil {
+		return false, fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return true, nil
+}
+
 func (s *UserService) LoginToService(ctx context.Context, uid string, serviceId uuid.UUID) (string, error) {
 	code, err := generateOpaqueToken(32)
 	if err != nil {
@@ -0,0 +1,71 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/services"
+	"github.com/kymppi/kuura/internal/settings"
+	"github.com/kymppi/kuura/internal/utils"
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// helpers of the tests that run against testdb
+
+func newTestKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+func newTestUserService(queries *db_gen.Queries, currentKekId string, keks map[string][]byte) *UserService {
+	logger := slog.New(slog.DiscardHandler)
+	serviceManager := services.NewServiceManager(logger, queries, settings.NewSettingsService(logger, queries))
+
+	return NewUserService(logger, queries, "https://kuura.example.com", nil, serviceManager, []byte("test secret"), currentKekId, keks, nil)
+}
+
+func createTestUser(t *testing.T, queries *db_gen.Queries, username string) string {
+	t.Helper()
+
+	uid := ulid.Make().String()
+	if err := queries.CreateUser(context.Background(), db_gen.CreateUserParams{
+		ID:              uid,
+		Username:        username,
+		HashedUsername:  username,
+		EncodedVerifier: "verifier",
+	}); err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	return uid
+}
+
+func createTestService(t *testing.T, queries *db_gen.Queries) uuid.UUID {
+	t.Helper()
+
+	serviceId := uuid.Must(uuid.NewV7())
+	if err := queries.CreateAppService(context.Background(), db_gen.CreateAppServiceParams{
+		ID:            utils.UUIDToPgType(serviceId),
+		JwtAudience:   "test",
+		Name:          "test " + serviceId.String(),
+		LoginRedirect: "https://example.com",
+	}); err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+
+	return serviceId
+}
+
+func assertErrorCode(t *testing.T, err error, code errcode.ErrorCode) {
+	t.Helper()
+
+	assert.True(t, errs.IsErrorCode(err, code), "expected %s, got %v", code, err)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math/big"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
@@ -21,19 +22,9 @@ func (s *UserService) ClientVerify(ctx context.Context, ih string, data string)
 		return "", "", fmt.Errorf("failed to get uid from identity hash: %w", err)
 	}
 
-	row, err := s.db.GetAndDeleteSRPServer(ctx, uid)
+	proof, err = s.finishHandshake(ctx, uid, data)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to retrieve srp server: %w", err)
-	}
-
-	srv, err := srp.UnmarshalServer(string(row.EncodedServer))
-	if err != nil {
-		return "", "", fmt.Errorf("failed to unmarshal server: %w", err)
-	}
-
-	proof, ok := srv.ClientOk(data)
-	if !ok {
-		return "", "", errs.New(errcode.Unauthorized, errors.New("client proof not ok"))
+		return "", "", err
 	}
 
 	s.logger.Info("User logged in", slog.String("uid", uid))
@@ -52,8 +43,17 @@ func (s *UserService) ClientBegin(ctx context.Context, creds string) (string, er
 		return "", fmt.Errorf("failed to get uid from identity hash: %w", err)
 	}
 
+	if err := s.checkUserEnabled(ctx, uid); err != nil {
+		return "", err
+	}
+
 	s.logger.Info("User initiated login", slog.String("uid", uid))
 
+	return s.beginHandshake(ctx, uid, A)
+}
+
+// the server state lives in user_srp for a few seconds, until finishHandshake checks the client's proof
+func (s *UserService) beginHandshake(ctx context.Context, uid string, A *big.Int) (string, error) {
 	encodedVerifier, err := s.db.GetSRPVerifier(ctx, uid)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch user verifier and salt: %w", err)
@@ -69,7 +69,7 @@ func (s *UserService) ClientBegin(ctx context.Context, creds string) (string, er
 		return "", fmt.Errorf("failed to compute the shared secret: %w", err)
 	}
 
-	creds = srv.Credentials()
+	creds := srv.Credentials()
 
 	expired, err := s.db.CheckSRPServerNotExpired(ctx, uid)
 	if err != nil {
@@ -93,3 +93,22 @@ func (s *UserService) ClientBegin(ctx context.Context, creds string) (string, er
 
 	return creds, nil
 }
+
+func (s *UserService) finishHandshake(ctx context.Context, uid string, data string) (proof string, err error) {
+	row, err := s.db.GetAndDeleteSRPServer(ctx, uid)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve srp server: %w", err)
+	}
+
+	srv, err := srp.UnmarshalServer(string(row.EncodedServer))
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal server: %w", err)
+	}
+
+	proof, ok := srv.ClientOk(data)
+	if !ok {
+		return "", errs.New(errcode.Unauthorized, errors.New("client proof not ok"))
+	}
+
+	return proof, nil
+}
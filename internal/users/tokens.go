@@ -13,29 +13,36 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
 	"github.com/kymppi/kuura/internal/models"
 	"github.com/kymppi/kuura/internal/utils"
-	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/oklog/ulid/v2"
 )
 
 func (s *UserService) CreateSession(ctx context.Context, uid string, serviceId uuid.UUID) (id string, refreshToken string, err error) {
+	if err := s.CheckServiceAccess(ctx, uid, serviceId); err != nil {
+		return "", "", err
+	}
+
 	id = ulid.Make().String()
 
-	refreshToken, err = generateOpaqueToken(32)
+	opaqueToken, err := generateOpaqueToken(32)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate opaque token: %w", err)
 	}
+	refreshToken = utils.FormatRefreshToken(0, opaqueToken)
 
 	hashedToken, err := s.tokenhasher.HashValue(refreshToken)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to hash refresh token: %w", err)
 	}
 
-	if err = s.db.CreateUserSession(ctx, db_gen.CreateUserSessionParams{
+	if err = s.createSession(ctx, db_gen.CreateUserSessionParams{
 		ID:     id,
 		UserID: uid,
 		ExpiresAt: pgtype.Timestamptz{
@@ -59,9 +66,13 @@ func (s *UserService) CreateSession(ctx context.Context, uid string, serviceId u
 }
 
 func (s *UserService) CreateSessionForFutureUse(ctx context.Context, uid string, serviceId uuid.UUID) (id string, err error) {
+	if err := s.CheckServiceAccess(ctx, uid, serviceId); err != nil {
+		return "", err
+	}
+
 	id = ulid.Make().String()
 
-	if err = s.db.CreateUserSession(ctx, db_gen.CreateUserSessionParams{
+	if err = s.createSession(ctx, db_gen.CreateUserSessionParams{
 		ID:     id,
 		UserID: uid,
 		ExpiresAt: pgtype.Timestamptz{
@@ -76,17 +87,100 @@ func (s *UserService) CreateSessionForFutureUse(ctx context.Context, uid string,
 	return id, nil
 }
 
+// createSession checks that the user is enabled in the insert itself, a separate read could miss a concurrent DisableUser
+func (s *UserService) createSession(ctx context.Context, params db_gen.CreateUserSessionParams) error {
+	created, err := s.db.CreateUserSession(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	if created == 0 {
+		if err := s.checkUserEnabled(ctx, params.UserID); err != nil {
+			return err
+		}
+
+		return errs.New(errcode.UserDisabled, fmt.Errorf("user %s is disabled", params.UserID))
+	}
+
+	return nil
+}
+
 type TokenInfo struct {
 	AccessToken         string
 	AccessTokenDuration time.Duration
 	SessionId           string
 	RefreshToken        string
+	IDToken             string // only set for the OIDC authorization code flow
 }
 
+// refreshTokenReuseGrace is how long the previous refresh token keeps working after a rotation,
+// so tabs or clients refreshing at the same time are not logged out by reuse detection.
+// This is a deliberate exception to revoking the session as soon as a rotated token is reused:
+// within the grace the immediately previous token is still exchanged for an access token, but never for a
+// new refresh token. Older generations, and the previous one after the grace, revoke the session at once.
+const refreshTokenReuseGrace = 30 * time.Second
+
+// errRefreshTokenJustRotated marks a refresh token rotated within refreshTokenReuseGrace,
+// it is exchanged for an access token but no new refresh token
+var errRefreshTokenJustRotated = errors.New("refresh token was just rotated")
+
 func (s *UserService) buildAndSignAccessToken(
 	ctx context.Context,
 	session *models.UserSession,
 	roles []string,
+) (*TokenInfo, error) {
+	tokenInfo, err := s.signAccessToken(ctx, session, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	opaqueToken, err := generateOpaqueToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	newRefreshToken := utils.FormatRefreshToken(session.RefreshTokenGeneration+1, opaqueToken)
+
+	hashedToken, err := s.tokenhasher.HashValue(newRefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash refresh token: %w", err)
+	}
+
+	// the generation check makes concurrent refreshes with the same token fail instead of forking the chain
+	_, err = s.db.RotateUserSessionRefreshToken(ctx, db_gen.RotateUserSessionRefreshTokenParams{
+		RefreshTokenHash: pgtype.Text{
+			String: hashedToken,
+			Valid:  true,
+		},
+		ID:                     session.Id,
+		RefreshTokenGeneration: session.RefreshTokenGeneration,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.lostRotationRace(ctx, session, tokenInfo)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	tokenInfo.RefreshToken = newRefreshToken
+
+	return tokenInfo, nil
+}
+
+// lostRotationRace handles a concurrent refresh with the same token having rotated it first,
+// the winner received the new refresh token so only the access token is returned
+func (s *UserService) lostRotationRace(ctx context.Context, session *models.UserSession, tokenInfo *TokenInfo) (*TokenInfo, error) {
+	current, err := s.GetSession(ctx, session.Id)
+	if err != nil || current.RefreshTokenGeneration != session.RefreshTokenGeneration+1 {
+		return nil, errs.New(errcode.InvalidGrant, errors.New("refresh token was already rotated"))
+	}
+
+	return tokenInfo, nil
+}
+
+// signAccessToken returns a TokenInfo without a refresh token
+func (s *UserService) signAccessToken(
+	ctx context.Context,
+	session *models.UserSession,
+	roles []string,
 ) (*TokenInfo, error) {
 	service, err := s.services.GetService(ctx, *session.ServiceId)
 	if err != nil {
@@ -119,34 +213,13 @@ func (s *UserService) buildAndSignAccessToken(
 		return nil, fmt.Errorf("failed to get signing key: %w", err)
 	}
 
-	signedToken, err := jwt.Sign(token, jwt.WithKey(jwa.ES384, signingKey))
+	signedToken, err := jwt.Sign(token, jwt.WithKey(signingKey.Algorithm(), signingKey))
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign jwt: %w", err)
 	}
 
-	newRefreshToken, err := generateOpaqueToken(32)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
-	}
-
-	hashedToken, err := s.tokenhasher.HashValue(newRefreshToken)
-	if err != nil {
-		return nil, fmt.Errorf("failed to hash refresh token: %w", err)
-	}
-
-	if err := s.db.RotateUserSessionRefreshToken(ctx, db_gen.RotateUserSessionRefreshTokenParams{
-		RefreshTokenHash: pgtype.Text{
-			String: hashedToken,
-			Valid:  true,
-		},
-		ID: session.Id,
-	}); err != nil {
-		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
-	}
-
 	return &TokenInfo{
 		AccessToken:         string(signedToken),
-		RefreshToken:        newRefreshToken,
 		AccessTokenDuration: service.AccessTokenDuration,
 		SessionId:           session.Id,
 	}, nil
@@ -155,23 +228,29 @@ func (s *UserService) buildAndSignAccessToken(
 func (s *UserService) CreateAccessToken(ctx context.Context, sessionId string, refreshToken string) (*TokenInfo, error) {
 	session, err := s.GetSession(ctx, sessionId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session: %w", err)
+		return nil, errs.New(errcode.InvalidGrant, fmt.Errorf("failed to get session: %w", err))
 	}
 
-	roles, err := s.db.GetUserRoles(ctx, session.UserId)
+	if err := s.checkSessionAllowed(ctx, session); err != nil {
+		return nil, errs.New(errcode.InvalidGrant, err)
+	}
+
+	roles, err := s.sessionRoles(ctx, session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user roles: %w", err)
 	}
 
-	tokenValid, err := s.validateRefreshToken(session, refreshToken)
-	if err != nil || !tokenValid {
+	tokenValid, err := s.validateRefreshToken(ctx, session, refreshToken)
+	if errors.Is(err, errRefreshTokenJustRotated) {
+		return s.signAccessToken(ctx, session, roles)
+	} else if err != nil || !tokenValid {
 		logFields := []any{slog.String("session", sessionId)}
 		if err != nil {
 			logFields = append(logFields, slog.String("error", err.Error()))
 		}
 
 		s.logger.Error("Failed to validate refresh token", logFields...)
-		return nil, errors.New("invalid refresh token")
+		return nil, errs.New(errcode.InvalidGrant, errors.New("invalid refresh token"))
 	}
 
 	tokenInfo, err := s.buildAndSignAccessToken(ctx, session, roles)
@@ -200,7 +279,11 @@ func (s *UserService) CreateAccessTokenUsingCode(ctx context.Context, code strin
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
-	roles, err := s.db.GetUserRoles(ctx, session.UserId)
+	if err := s.checkSessionAllowed(ctx, session); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.sessionRoles(ctx, session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user roles: %w", err)
 	}
@@ -223,10 +306,11 @@ func (s *UserService) GetSession(ctx context.Context, sessionId string) (*models
 	}
 
 	obj := &models.UserSession{
-		Id:        session.ID,
-		UserId:    session.UserID,
-		ExpiresAt: session.ExpiresAt.Time,
-		CreatedAt: session.CreatedAt.Time,
+		Id:                     session.ID,
+		UserId:                 session.UserID,
+		ExpiresAt:              session.ExpiresAt.Time,
+		CreatedAt:              session.CreatedAt.Time,
+		RefreshTokenGeneration: session.RefreshTokenGeneration,
 	}
 
 	if session.ServiceID.Valid {
@@ -249,11 +333,46 @@ func (s *UserService) GetSession(ctx context.Context, sessionId string) (*models
 	return obj, nil
 }
 
-func (s *UserService) validateRefreshToken(session *models.UserSession, token string) (bool, error) {
+// checkSessionAllowed repeats the login checks whenever a session is exchanged for new tokens,
+// so disabling the user or taking away their access to the service takes effect at the next refresh
+func (s *UserService) checkSessionAllowed(ctx context.Context, session *models.UserSession) error {
+	if err := s.checkUserEnabled(ctx, session.UserId); err != nil {
+		return err
+	}
+
+	if session.ServiceId == nil {
+		return errors.New("session has no service")
+	}
+
+	return s.CheckServiceAccess(ctx, session.UserId, *session.ServiceId)
+}
+
+// SessionActive reports whether the session exists, belongs to the user and has not expired
+func (s *UserService) SessionActive(ctx context.Context, sessionId string, uid string) (bool, error) {
+	session, err := s.db.GetUserSession(ctx, sessionId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return session.UserID == uid && time.Now().Before(session.ExpiresAt.Time), nil
+}
+
+func (s *UserService) validateRefreshToken(ctx context.Context, session *models.UserSession, token string) (bool, error) {
 	if session.RefreshTokenHash == nil {
 		return false, nil
 	}
 
+	// tokens without a generation predate reuse detection and are compared against the current hash
+	if generation, ok := utils.ParseRefreshTokenGeneration(token); ok {
+		if generation < session.RefreshTokenGeneration {
+			return false, s.detectRefreshTokenReuse(ctx, session, generation, token)
+		} else if generation > session.RefreshTokenGeneration {
+			return false, errors.New("unknown refresh token generation")
+		}
+	}
+
 	valid, err := s.tokenhasher.CompareHashAndValue(*session.RefreshTokenHash, token)
 	if err != nil {
 		return false, err
@@ -266,6 +385,45 @@ func (s *UserService) validateRefreshToken(session *models.UserSession, token st
 	return true, nil
 }
 
+// a rotated token being presented again means it has leaked, so the whole session is revoked (OAuth 2.0 Security BCP section 4.14)
+func (s *UserService) detectRefreshTokenReuse(ctx context.Context, session *models.UserSession, generation int32, token string) error {
+	previous, err := s.db.GetUserSessionPreviousRefreshToken(ctx, db_gen.GetUserSessionPreviousRefreshTokenParams{
+		SessionID:  session.Id,
+		Generation: generation,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get previous refresh token: %w", err)
+	}
+
+	valid, err := s.tokenhasher.CompareHashAndValue(previous.TokenHash, token)
+	if err != nil {
+		return err
+	} else if !valid {
+		return errors.New("invalid token")
+	}
+
+	if generation == session.RefreshTokenGeneration-1 && time.Since(previous.RotatedAt.Time) < refreshTokenReuseGrace {
+		return errRefreshTokenJustRotated
+	}
+
+	s.logger.Warn("Refresh token reuse detected, revoking session",
+		slog.String("security_event", "refresh_token_reuse"),
+		slog.String("session_id", session.Id),
+		slog.String("uid", session.UserId),
+		slog.Int("presented_generation", int(generation)),
+		slog.Int("current_generation", int(session.RefreshTokenGeneration)),
+	)
+
+	if err := s.db.DeleteUserSession(ctx, db_gen.DeleteUserSessionParams{
+		ID:     session.Id,
+		UserID: session.UserId,
+	}); err != nil {
+		return fmt.Errorf("failed to revoke session after refresh token reuse: %w", err)
+	}
+
+	return errs.New(errcode.InvalidGrant, errors.New("refresh token reuse detected"))
+}
+
 func generateOpaqueToken(length int) (string, error) {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	if length <= 0 {
@@ -0,0 +1,272 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/totp"
+)
+
+type TOTPEnrollment struct {
+	Secret string // base32, for entering the secret manually
+	URI    string // otpauth:// URI
+	QRCode string // PNG data URL of the URI
+}
+
+// BeginTOTPEnrollment generates a new secret, it replaces an earlier unconfirmed one until ConfirmTOTPEnrollment succeeds
+func (s *UserService) BeginTOTPEnrollment(ctx context.Context, uid string) (*TOTPEnrollment, error) {
+	user, err := s.GetUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	encryptedSecret, nonce, err := s.encryptor.Encrypt(secret, s.keks[s.currentKekId])
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt totp secret: %w", err)
+	}
+
+	stored, err := s.db.UpsertUserTOTP(ctx, db_gen.UpsertUserTOTPParams{
+		UserID:          uid,
+		EncryptedSecret: encryptedSecret,
+		Nonce:           nonce,
+		KekID:           s.currentKekId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", err)
+	} else if stored == 0 {
+		return nil, errs.New(errcode.TOTPAlreadyEnabled, errors.New("totp is already confirmed"))
+	}
+
+	uri := totp.URI(s.totpIssuer(), user.Username, secret)
+
+	code, err := totp.QRCode(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode qr code: %w", err)
+	}
+
+	return &TOTPEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    uri,
+		QRCode: code,
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables TOTP once the user proves their authenticator produces valid codes,
+// recovery codes are returned when this is the user's first second factor
+func (s *UserService) ConfirmTOTPEnrollment(ctx context.Context, uid string, code string) (recoveryCodes []string, err error) {
+	row, err := s.db.GetUserTOTP(ctx, uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.New(errcode.TOTPNotEnrolled, errors.New("totp enrollment has not been started"))
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get totp secret: %w", err)
+	}
+
+	if row.ConfirmedAt.Valid {
+		return nil, errs.New(errcode.TOTPAlreadyEnabled, errors.New("totp is already confirmed"))
+	}
+
+	secret, err := s.decryptTOTPSecret(row.EncryptedSecret, row.Nonce, row.KekID)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, errs.New(errcode.InvalidMFACode, errors.New("invalid totp code"))
+	}
+
+	confirmed, err := s.db.ConfirmUserTOTP(ctx, db_gen.ConfirmUserTOTPParams{
+		UserID:       uid,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm totp: %w", err)
+	} else if confirmed == 0 {
+		return nil, errs.New(errcode.TOTPAlreadyEnabled, errors.New("totp was confirmed concurrently"))
+	}
+
+	s.logger.Info("User enabled TOTP", slog.String("uid", uid))
+
+	return s.ensureRecoveryCodes(ctx, uid)
+}
+
+// VerifyTOTP checks a code of an enabled authenticator, each code is only accepted once
+func (s *UserService) VerifyTOTP(ctx context.Context, uid string, code string) error {
+	row, err := s.db.GetUserTOTP(ctx, uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errs.New(errcode.TOTPNotEnrolled, errors.New("user has no totp secret"))
+	} else if err != nil {
+		return fmt.Errorf("failed to get totp secret: %w", err)
+	}
+
+	if !row.ConfirmedAt.Valid {
+		return errs.New(errcode.TOTPNotEnrolled, errors.New("totp enrollment is not confirmed"))
+	}
+
+	secret, err := s.decryptTOTPSecret(row.EncryptedSecret, row.Nonce, row.KekID)
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return errs.New(errcode.InvalidMFACode, errors.New("invalid totp code"))
+	}
+
+	// the step check makes a replayed (or concurrently used) code fail
+	used, err := s.db.UseUserTOTPStep(ctx, db_gen.UseUserTOTPStepParams{
+		UserID:       uid,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update totp step: %w", err)
+	} else if used == 0 {
+		return errs.New(errcode.InvalidMFACode, errors.New("totp code was already used"))
+	}
+
+	return nil
+}
+
+// DisableTOTP lets the user remove their authenticator, a current code is required
+func (s *UserService) DisableTOTP(ctx context.Context, uid string, code string) error {
+	if err := s.VerifyTOTP(ctx, uid, code); err != nil {
+		return err
+	}
+
+	if _, err := s.db.DeleteUserTOTP(ctx, uid); err != nil {
+		return fmt.Errorf("failed to delete totp secret: %w", err)
+	}
+
+	s.logger.Info("User disabled TOTP", slog.String("uid", uid))
+
+	return s.deleteUnusableRecoveryCodes(ctx, uid)
+}
+
+// ResetTOTP removes the user's authenticator without a code, for admins helping users who lost theirs
+func (s *UserService) ResetTOTP(ctx context.Context, uid string) (reset bool, err error) {
+	deleted, err := s.db.DeleteUserTOTP(ctx, uid)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete totp secret: %w", err)
+	}
+
+	if err := s.db.DeleteUserMFAChallenges(ctx, uid); err != nil {
+		return false, fmt.Errorf("failed to delete pending mfa challenges: %w", err)
+	}
+
+	if err := s.deleteUnusableRecoveryCodes(ctx, uid); err != nil {
+		return false, err
+	}
+
+	if deleted > 0 {
+		s.logger.Warn("TOTP reset by an administrator",
+			slog.String("security_event", "totp_reset"),
+			slog.String("uid", uid),
+		)
+	}
+
+	return deleted > 0, nil
+}
+
+func (s *UserService) TOTPEnabled(ctx context.Context, uid string) (bool, error) {
+	return s.db.CheckUserTOTPEnabled(ctx, uid)
+}
+
+// RewrapTOTPSecrets re-encrypts every TOTP secret with kek in one transaction, like jwks.KeyStorage.RewrapKeys
+func (s *UserService) RewrapTOTPSecrets(ctx context.Context, kekId string, kek []byte) (int, error) {
+	if configured, ok := s.keks[kekId]; ok && !bytes.Equal(configured, kek) {
+		return 0, fmt.Errorf("key encryption key id %q is already used by a different key", kekId)
+	}
+
+	var rewrapped int64
+
+	err := s.db.InTx(ctx, func(db *db_gen.Queries) error {
+		if err := db.LockUserTOTPInserts(ctx); err != nil {
+			return fmt.Errorf("failed to lock totp secrets: %w", err)
+		}
+
+		rows, err := db.GetAllUserTOTP(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get totp secrets: %w", err)
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		params := db_gen.RewrapUserTOTPParams{
+			KekID:            kekId,
+			UserIds:          make([]string, 0, len(rows)),
+			EncryptedSecrets: make([][]byte, 0, len(rows)),
+			Nonces:           make([][]byte, 0, len(rows)),
+		}
+
+		for _, row := range rows {
+			secret, err := s.decryptTOTPSecret(row.EncryptedSecret, row.Nonce, row.KekID)
+			if err != nil {
+				return fmt.Errorf("user %s: %w", row.UserID, err)
+			}
+
+			encryptedSecret, nonce, err := s.encryptor.Encrypt(secret, kek)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt totp secret of user %s: %w", row.UserID, err)
+			}
+
+			params.UserIds = append(params.UserIds, row.UserID)
+			params.EncryptedSecrets = append(params.EncryptedSecrets, encryptedSecret)
+			params.Nonces = append(params.Nonces, nonce)
+		}
+
+		rewrapped, err = db.RewrapUserTOTP(ctx, params)
+		if err != nil {
+			return fmt.Errorf("failed to rewrap totp secrets: %w", err)
+		}
+
+		if rewrapped != int64(len(rows)) {
+			return fmt.Errorf("rewrapped %d of %d totp secrets, nothing was changed", rewrapped, len(rows))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rewrapped), nil
+}
+
+func (s *UserService) decryptTOTPSecret(encryptedSecret []byte, nonce []byte, kekId string) ([]byte, error) {
+	key, ok := s.keks[kekId]
+	if !ok {
+		return nil, fmt.Errorf("totp secret is encrypted with unknown key encryption key %q", kekId)
+	}
+
+	secret, err := s.encryptor.Decrypt(encryptedSecret, key, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// authenticator apps show the issuer next to the account, the issuer host tells instances apart
+func (s *UserService) totpIssuer() string {
+	if issuer, err := url.Parse(s.jwtIssuer); err == nil && issuer.Hostname() != "" {
+		return issuer.Hostname()
+	}
+
+	return "Kuura"
+}
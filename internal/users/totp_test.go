@@ -0,0 +1,51 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kymppi/kuura/internal/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewrapTOTPSecrets(t *testing.T) {
+	ctx := context.Background()
+	queries := testdb.New(t)
+
+	oldKek, newKek := newTestKey(), newTestKey()
+	service := newTestUserService(queries, "old", map[string][]byte{"old": oldKek})
+
+	uids := []string{createTestUser(t, queries, "first"), createTestUser(t, queries, "second")}
+	secrets := make(map[string][]byte)
+	for _, uid := range uids {
+		_, err := service.BeginTOTPEnrollment(ctx, uid)
+		assert.NoError(t, err)
+
+		row, err := queries.GetUserTOTP(ctx, uid)
+		assert.NoError(t, err)
+		secrets[uid], err = service.decryptTOTPSecret(row.EncryptedSecret, row.Nonce, row.KekID)
+		assert.NoError(t, err)
+	}
+
+	t.Run("Id used by a different key", func(t *testing.T) {
+		_, err := service.RewrapTOTPSecrets(ctx, "old", newKek)
+		assert.Error(t, err)
+	})
+
+	rewrapped, err := service.RewrapTOTPSecrets(ctx, "new", newKek)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rewrapped)
+
+	// the old key encryption key is not needed anymore
+	rewrappedService := newTestUserService(queries, "new", map[string][]byte{"new": newKek})
+
+	for _, uid := range uids {
+		row, err := queries.GetUserTOTP(ctx, uid)
+		assert.NoError(t, err)
+		assert.Equal(t, "new", row.KekID)
+
+		secret, err := rewrappedService.decryptTOTPSecret(row.EncryptedSecret, row.Nonce, row.KekID)
+		assert.NoError(t, err)
+		assert.Equal(t, secrets[uid], secret)
+	}
+}
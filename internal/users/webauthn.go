@@ -0,0 +1,355 @@
+package users
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kymppi/kuura/internal/db_gen"
+	"github.com/kymppi/kuura/internal/errcode"
+	"github.com/kymppi/kuura/internal/errs"
+	"github.com/kymppi/kuura/internal/models"
+	"github.com/kymppi/kuura/internal/utils"
+	"github.com/kymppi/kuura/internal/webauthn"
+)
+
+const MFAMethodWebAuthn = "webauthn"
+
+const (
+	webauthnCeremonyRegistration = "registration"
+	webauthnCeremonyLogin        = "login" // passwordless
+	webauthnCeremonyMFA          = "mfa"   // second factor after SRP
+	webauthnCeremonyReauth       = "reauth"
+)
+
+// BeginWebAuthnRegistration returns the options for navigator.credentials.create
+func (s *UserService) BeginWebAuthnRegistration(ctx context.Context, uid string) (*webauthn.CreationOptions, error) {
+	user, err := s.GetUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.db.GetUserWebAuthnCredentials(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkeys: %w", err)
+	}
+
+	challenge, err := s.createWebAuthnChallenge(ctx, webauthnCeremonyRegistration, uid, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user handle is returned by discoverable credentials during passwordless logins
+	return s.relyingParty.CreationOptions(challenge, []byte(uid), user.Username, credentialDescriptors(existing)), nil
+}
+
+// FinishWebAuthnRegistration returns recovery codes when the passkey is the user's first second factor
+func (s *UserService) FinishWebAuthnRegistration(ctx context.Context, uid string, name string, response *webauthn.RegistrationResponse) (*models.WebAuthnCredential, []string, error) {
+	challenge, pending, err := s.useWebAuthnChallenge(ctx, response.Response.ClientDataJSON, webauthnCeremonyRegistration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pending.UserID.String != uid {
+		return nil, nil, errs.New(errcode.WebAuthnFailed, errors.New("registration was started by another user"))
+	}
+
+	credential, err := s.relyingParty.VerifyRegistration(response, challenge, false)
+	if err != nil {
+		return nil, nil, errs.New(errcode.WebAuthnFailed, err)
+	}
+
+	transports := credential.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	if err := s.db.CreateWebAuthnCredential(ctx, db_gen.CreateWebAuthnCredentialParams{
+		ID:         credential.ID,
+		UserID:     uid,
+		Name:       name,
+		PublicKey:  credential.PublicKey,
+		SignCount:  int64(credential.SignCount),
+		Transports: transports,
+	}); err != nil {
+		return nil, nil, fmt.Errorf("failed to store passkey: %w", err)
+	}
+
+	s.logger.Info("User registered a passkey", slog.String("uid", uid))
+
+	recoveryCodes, err := s.ensureRecoveryCodes(ctx, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &models.WebAuthnCredential{
+		Id:         base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:       name,
+		Transports: transports,
+		CreatedAt:  time.Now(),
+	}, recoveryCodes, nil
+}
+
+func (s *UserService) GetWebAuthnCredentials(ctx context.Context, uid string) ([]*models.WebAuthnCredential, error) {
+	rows, err := s.db.GetUserWebAuthnCredentials(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*models.WebAuthnCredential{}
+	for _, row := range rows {
+		credential := &models.WebAuthnCredential{
+			Id:         base64.RawURLEncoding.EncodeToString(row.ID),
+			Name:       row.Name,
+			Transports: row.Transports,
+			CreatedAt:  row.CreatedAt.Time,
+		}
+
+		if row.LastUsedAt.Valid {
+			credential.LastUsedAt = &row.LastUsedAt.Time
+		}
+
+		result = append(result, credential)
+	}
+
+	return result, nil
+}
+
+// DeleteWebAuthnCredential takes the base64url credential id
+func (s *UserService) DeleteWebAuthnCredential(ctx context.Context, uid string, credentialId string) error {
+	id, err := base64.RawURLEncoding.DecodeString(credentialId)
+	if err != nil {
+		return errs.New(errcode.WebAuthnCredentialNotFound, err)
+	}
+
+	deleted, err := s.db.DeleteWebAuthnCredential(ctx, db_gen.DeleteWebAuthnCredentialParams{
+		ID:     id,
+		UserID: uid,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	} else if deleted == 0 {
+		return errs.New(errcode.WebAuthnCredentialNotFound, errors.New("passkey not found"))
+	}
+
+	s.logger.Info("User removed a passkey", slog.String("uid", uid))
+
+	return s.deleteUnusableRecoveryCodes(ctx, uid)
+}
+
+// BeginWebAuthnLogin starts a passwordless login, the authenticator picks a discoverable credential
+func (s *UserService) BeginWebAuthnLogin(ctx context.Context, serviceId uuid.UUID) (*webauthn.RequestOptions, error) {
+	if _, err := s.services.GetService(ctx, serviceId); err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.createWebAuthnChallenge(ctx, webauthnCeremonyLogin, "", &serviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.relyingParty.RequestOptions(challenge, nil, webauthn.UserVerificationRequired), nil
+}
+
+// FinishWebAuthnLogin requires user verification, so the passkey stands in for both the password and the second factor
+func (s *UserService) FinishWebAuthnLogin(ctx context.Context, response *webauthn.AssertionResponse) (uid string, serviceId uuid.UUID, err error) {
+	challenge, pending, err := s.useWebAuthnChallenge(ctx, response.Response.ClientDataJSON, webauthnCeremonyLogin)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	uid, err = s.verifyWebAuthnAssertion(ctx, response, challenge, "", true)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	serviceId, err = utils.PgTypeUUIDToUUID(pending.ServiceID)
+	if err != nil {
+		return "", uuid.Nil, fmt.Errorf("failed to parse challenge's service id: %w", err)
+	}
+
+	s.logger.Info("User logged in with a passkey", slog.String("uid", uid))
+
+	return uid, serviceId, nil
+}
+
+// BeginMFAChallengeWebAuthn returns the options for using a passkey as the second factor of a pending login
+func (s *UserService) BeginMFAChallengeWebAuthn(ctx context.Context, token string) (*webauthn.RequestOptions, error) {
+	challenge, err := s.db.GetMFAChallenge(ctx, db_gen.GetMFAChallengeParams{
+		HashedToken: hashCodeHMAC(token, s.tokenCodeHashingSecret),
+		Attempts:    mfaChallengeMaxAttempts,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.New(errcode.MFAChallengeExpired, errors.New("mfa challenge not found, expired or out of attempts"))
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+
+	credentials, err := s.db.GetUserWebAuthnCredentials(ctx, challenge.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkeys: %w", err)
+	} else if len(credentials) == 0 {
+		return nil, errs.New(errcode.WebAuthnCredentialNotFound, errors.New("user has no passkeys"))
+	}
+
+	serviceId, err := utils.PgTypeUUIDToUUID(challenge.ServiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse challenge's service id: %w", err)
+	}
+
+	webauthnChallenge, err := s.createWebAuthnChallenge(ctx, webauthnCeremonyMFA, challenge.UserID, &serviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.relyingParty.RequestOptions(webauthnChallenge, credentialDescriptors(credentials), webauthn.UserVerificationPreferred), nil
+}
+
+// CompleteMFAChallengeWebAuthn verifies a passkey for a pending login and returns who logged in to which service
+func (s *UserService) CompleteMFAChallengeWebAuthn(ctx context.Context, token string, response *webauthn.AssertionResponse) (uid string, serviceId uuid.UUID, err error) {
+	hashedToken := hashCodeHMAC(token, s.tokenCodeHashingSecret)
+
+	challenge, err := s.attemptMFAChallenge(ctx, hashedToken)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	webauthnChallenge, pending, err := s.useWebAuthnChallenge(ctx, response.Response.ClientDataJSON, webauthnCeremonyMFA)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	if pending.UserID.String != challenge.UserID {
+		return "", uuid.Nil, errs.New(errcode.WebAuthnFailed, errors.New("passkey challenge belongs to another login"))
+	}
+
+	if _, err := s.verifyWebAuthnAssertion(ctx, response, webauthnChallenge, challenge.UserID, false); err != nil {
+		return "", uuid.Nil, err
+	}
+
+	return s.consumeMFAChallenge(ctx, hashedToken, challenge)
+}
+
+func (s *UserService) WebAuthnEnabled(ctx context.Context, uid string) (bool, error) {
+	return s.db.CheckUserHasWebAuthnCredentials(ctx, uid)
+}
+
+// verifies the assertion with the stored credential and returns its owner, expectedUid is empty for passwordless logins
+func (s *UserService) verifyWebAuthnAssertion(ctx context.Context, response *webauthn.AssertionResponse, challenge string, expectedUid string, requireUserVerification bool) (string, error) {
+	credentialId, err := response.CredentialID()
+	if err != nil {
+		return "", errs.New(errcode.WebAuthnFailed, err)
+	}
+
+	credential, err := s.db.GetWebAuthnCredential(ctx, credentialId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errs.New(errcode.WebAuthnFailed, errors.New("unknown passkey"))
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get passkey: %w", err)
+	}
+
+	if expectedUid != "" && credential.UserID != expectedUid {
+		return "", errs.New(errcode.WebAuthnFailed, errors.New("passkey belongs to another user"))
+	}
+
+	if response.Response.UserHandle != "" {
+		userHandle, err := response.UserHandle()
+		if err != nil || string(userHandle) != credential.UserID {
+			return "", errs.New(errcode.WebAuthnFailed, errors.New("user handle does not match the passkey"))
+		}
+	}
+
+	assertion, err := s.relyingParty.VerifyAssertion(response, challenge, credential.PublicKey, requireUserVerification)
+	if err != nil {
+		return "", errs.New(errcode.WebAuthnFailed, err)
+	}
+
+	storedSignCount := uint32(credential.SignCount)
+	if !webauthn.SignCountValid(storedSignCount, assertion.SignCount) {
+		s.logger.Warn("Passkey signature counter did not increase, the authenticator may be cloned",
+			slog.String("security_event", "webauthn_sign_count"),
+			slog.String("uid", credential.UserID),
+			slog.Int64("stored_sign_count", int64(storedSignCount)),
+			slog.Int64("received_sign_count", int64(assertion.SignCount)),
+		)
+		return "", errs.New(errcode.WebAuthnFailed, errors.New("signature counter did not increase"))
+	}
+
+	// the counter check makes a concurrent use of the same assertion fail
+	updated, err := s.db.UpdateWebAuthnCredentialSignCount(ctx, db_gen.UpdateWebAuthnCredentialSignCountParams{
+		ID:        credential.ID,
+		SignCount: int64(assertion.SignCount),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update passkey: %w", err)
+	} else if updated == 0 {
+		return "", errs.New(errcode.WebAuthnFailed, errors.New("signature counter did not increase"))
+	}
+
+	return credential.UserID, nil
+}
+
+func (s *UserService) createWebAuthnChallenge(ctx context.Context, ceremony string, uid string, serviceId *uuid.UUID) (string, error) {
+	challenge, err := webauthn.GenerateChallenge()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate webauthn challenge: %w", err)
+	}
+
+	params := db_gen.CreateWebAuthnChallengeParams{
+		HashedChallenge: hashCodeHMAC(challenge, s.tokenCodeHashingSecret),
+		Ceremony:        ceremony,
+		UserID: pgtype.Text{
+			String: uid,
+			Valid:  uid != "",
+		},
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(webauthn.Timeout),
+			Valid: true,
+		},
+	}
+
+	if serviceId != nil {
+		params.ServiceID = utils.UUIDToPgType(*serviceId)
+	}
+
+	if err := s.db.CreateWebAuthnChallenge(ctx, params); err != nil {
+		return "", fmt.Errorf("failed to store webauthn challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// challenges are single use, the one the client signed is looked up from clientDataJSON
+func (s *UserService) useWebAuthnChallenge(ctx context.Context, clientDataJSON string, ceremony string) (string, *db_gen.UseWebAuthnChallengeRow, error) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return "", nil, errs.New(errcode.WebAuthnFailed, err)
+	}
+
+	pending, err := s.db.UseWebAuthnChallenge(ctx, db_gen.UseWebAuthnChallengeParams{
+		HashedChallenge: hashCodeHMAC(challenge, s.tokenCodeHashingSecret),
+		Ceremony:        ceremony,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, errs.New(errcode.WebAuthnFailed, errors.New("webauthn challenge not found or expired"))
+	} else if err != nil {
+		return "", nil, fmt.Errorf("failed to get webauthn challenge: %w", err)
+	}
+
+	return challenge, &pending, nil
+}
+
+func credentialDescriptors(credentials []db_gen.UserWebauthnCredential) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, webauthn.NewCredentialDescriptor(credential.ID, credential.Transports))
+	}
+
+	return descriptors
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatRefreshToken prefixes an opaque refresh token with its rotation generation, "<generation>.<opaque>"
+func FormatRefreshToken(generation int32, opaque string) string {
+	return fmt.Sprintf("%d.%s", generation, opaque)
+}
+
+// ParseRefreshTokenGeneration returns false for tokens issued before generations were tracked
+func ParseRefreshTokenGeneration(token string) (int32, bool) {
+	prefix, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, false
+	}
+
+	generation, err := strconv.ParseInt(prefix, 10, 32)
+	if err != nil || generation < 0 {
+		return 0, false
+	}
+
+	return int32(generation), true
+}
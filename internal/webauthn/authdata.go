@@ -0,0 +1,83 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// authenticator data flags, WebAuthn Level 3 section 6.1
+const (
+	flagUserPresent            byte = 0x01
+	flagUserVerified           byte = 0x04
+	flagBackupEligible         byte = 0x08
+	flagBackedUp               byte = 0x10
+	flagAttestedCredentialData byte = 0x40
+	flagExtensionData          byte = 0x80
+)
+
+const maxCredentialIdLength = 1023
+
+type authenticatorData struct {
+	rpIdHash  []byte
+	flags     byte
+	signCount uint32
+
+	// only present in registrations
+	credentialId []byte
+	publicKey    []byte // COSE_Key
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+
+	result := &authenticatorData{
+		rpIdHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if result.flags&flagAttestedCredentialData != 0 {
+		// aaguid (16) and credential id length (2)
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data is too short")
+		}
+
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+
+		if idLength > maxCredentialIdLength || len(rest) < idLength {
+			return nil, errors.New("invalid credential id length")
+		}
+		result.credentialId = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		result.publicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if result.flags&flagExtensionData != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extension data: %w", err)
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after authenticator data")
+	}
+
+	return result, nil
+}
+
+func (a *authenticatorData) has(flag byte) bool {
+	return a.flags&flag != 0
+}
@@ -0,0 +1,165 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// WebAuthn only uses the CTAP2 canonical subset of CBOR (RFC 8949): definite lengths,
+// integer or text map keys and no floats, so that's all the decoder supports
+
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// decodeCBOR decodes the first item in data and returns the number of bytes it used.
+// Integers are int64, byte strings []byte, text strings string, arrays []any and maps map[any]any
+func decodeCBOR(data []byte) (item any, n int, err error) {
+	d := cborDecoder{data: data}
+
+	item, err = d.decode(0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return item, d.offset, nil
+}
+
+type cborDecoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *cborDecoder) decode(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, errors.New("cbor: nesting too deep")
+	}
+
+	if d.offset >= len(d.data) {
+		return nil, errCBORTruncated
+	}
+
+	initial := d.data[d.offset]
+	d.offset++
+
+	major := initial >> 5
+	info := initial & 0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+		}
+	}
+
+	argument, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if argument > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflows int64")
+		}
+		return int64(argument), nil
+	case 1:
+		if argument > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflows int64")
+		}
+		return -1 - int64(argument), nil
+	case 2, 3:
+		value, err := d.bytes(argument)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(value), nil
+		}
+		return value, nil
+	case 4:
+		if argument > uint64(len(d.data)-d.offset) {
+			return nil, errCBORTruncated
+		}
+
+		items := make([]any, 0, argument)
+		for range argument {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5:
+		if argument > uint64(len(d.data)-d.offset)/2 {
+			return nil, errCBORTruncated
+		}
+
+		items := make(map[any]any, argument)
+		for range argument {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+
+			if _, exists := items[key]; exists {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items[key] = value
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
+
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		value, err := d.bytes(uint64(size))
+		if err != nil {
+			return 0, err
+		}
+
+		var padded [8]byte
+		copy(padded[8-size:], value)
+		return binary.BigEndian.Uint64(padded[:]), nil
+	default:
+		return 0, errors.New("cbor: indefinite lengths are not supported")
+	}
+}
+
+func (d *cborDecoder) bytes(length uint64) ([]byte, error) {
+	if length > uint64(len(d.data)-d.offset) {
+		return nil, errCBORTruncated
+	}
+
+	end := d.offset + int(length)
+	value := d.data[d.offset:end:end]
+	d.offset = end
+
+	return value, nil
+}
@@ -0,0 +1,146 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053), in the order they are offered to authenticators
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgES384 int64 = -35
+	AlgRS256 int64 = -257
+)
+
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgES384, AlgRS256}
+
+// COSE_Key labels and values (RFC 9052 section 7, RFC 9053 section 7)
+const (
+	coseKeyType      int64 = 1
+	coseKeyAlgorithm int64 = 3
+	coseKeyCurve     int64 = -1
+	coseKeyX         int64 = -2
+	coseKeyY         int64 = -3
+	coseKeyRSAN      int64 = -1
+	coseKeyRSAE      int64 = -2
+
+	coseKeyTypeOKP int64 = 1
+	coseKeyTypeEC2 int64 = 2
+	coseKeyTypeRSA int64 = 3
+
+	coseCurveP256    int64 = 1
+	coseCurveP384    int64 = 2
+	coseCurveEd25519 int64 = 6
+)
+
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+func parsePublicKey(coseKey []byte) (*publicKey, error) {
+	item, n, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	} else if n != len(coseKey) {
+		return nil, errors.New("trailing data after public key")
+	}
+
+	key, ok := item.(map[any]any)
+	if !ok {
+		return nil, errors.New("public key is not a map")
+	}
+
+	keyType, _ := key[coseKeyType].(int64)
+	algorithm, _ := key[coseKeyAlgorithm].(int64)
+
+	switch algorithm {
+	case AlgES256, AlgES384:
+		curve, _ := key[coseKeyCurve].(int64)
+		x, _ := key[coseKeyX].([]byte)
+		y, _ := key[coseKeyY].([]byte)
+
+		var c elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch {
+		case algorithm == AlgES256 && curve == coseCurveP256:
+			c, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case algorithm == AlgES384 && curve == coseCurveP384:
+			c, ecdhCurve = elliptic.P384(), ecdh.P384()
+		default:
+			return nil, fmt.Errorf("curve %d does not match algorithm %d", curve, algorithm)
+		}
+
+		size := (c.Params().BitSize + 7) / 8
+		if keyType != coseKeyTypeEC2 || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC2 public key")
+		}
+
+		// crypto/ecdh rejects points that are not on the curve
+		point := make([]byte, 0, 1+2*size)
+		point = append(append(append(point, 0x04), x...), y...)
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid EC2 public key: %w", err)
+		}
+
+		return &publicKey{
+			algorithm: algorithm,
+			key:       &ecdsa.PublicKey{Curve: c, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)},
+		}, nil
+	case AlgEdDSA:
+		curve, _ := key[coseKeyCurve].(int64)
+		x, _ := key[coseKeyX].([]byte)
+		if keyType != coseKeyTypeOKP || curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid OKP public key")
+		}
+
+		return &publicKey{algorithm: algorithm, key: ed25519.PublicKey(x)}, nil
+	case AlgRS256:
+		n, _ := key[coseKeyRSAN].([]byte)
+		e, _ := key[coseKeyRSAE].([]byte)
+		if keyType != coseKeyTypeRSA || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA public key")
+		}
+
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+
+		return &publicKey{
+			algorithm: algorithm,
+			key:       &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %d", algorithm)
+	}
+}
+
+func (k *publicKey) verify(data []byte, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		if k.algorithm == AlgES384 {
+			digest := sha512.Sum384(data)
+			return ecdsa.VerifyASN1(key, digest[:], signature)
+		}
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
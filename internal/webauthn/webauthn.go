@@ -0,0 +1,257 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const ChallengeSize = 32
+
+// RelyingParty verifies registration and authentication ceremonies (WebAuthn Level 3 sections 7.1 and 7.2).
+// Attestation statements are not verified, kuura asks authenticators for "none"
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+func NewRelyingParty(id string, name string, origins []string) *RelyingParty {
+	return &RelyingParty{
+		ID:      id,
+		Name:    name,
+		Origins: origins,
+	}
+}
+
+// GenerateChallenge returns a random challenge, base64url encoded like it appears in clientDataJSON
+func GenerateChallenge() (string, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(challenge), nil
+}
+
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	SignCount      uint32
+	UserVerified   bool
+	BackupEligible bool
+	Transports     []string
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create
+func (rp *RelyingParty) VerifyRegistration(response *RegistrationResponse, challenge string, requireUserVerification bool) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, fmt.Errorf("unexpected credential type %q", response.Type)
+	}
+
+	clientDataJSON, err := decodeBase64URL(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clientDataJSON: %w", err)
+	}
+
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attestationObject, err := decodeBase64URL(response.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestationObject: %w", err)
+	}
+
+	item, n, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode attestation object: %w", err)
+	} else if n != len(attestationObject) {
+		return nil, errors.New("trailing data after attestation object")
+	}
+
+	attestation, ok := item.(map[any]any)
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authData")
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	if !authData.has(flagAttestedCredentialData) {
+		return nil, errors.New("registration has no attested credential data")
+	}
+
+	rawId, err := decodeBase64URL(response.RawID)
+	if err != nil || !bytes.Equal(rawId, authData.credentialId) {
+		return nil, errors.New("credential id does not match authenticator data")
+	}
+
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             bytes.Clone(authData.credentialId),
+		PublicKey:      bytes.Clone(authData.publicKey),
+		SignCount:      authData.signCount,
+		UserVerified:   authData.has(flagUserVerified),
+		BackupEligible: authData.has(flagBackupEligible),
+		Transports:     response.Response.Transports,
+	}, nil
+}
+
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get against a stored public key.
+// Callers must compare the returned sign count with the stored one
+func (rp *RelyingParty) VerifyAssertion(response *AssertionResponse, challenge string, publicKey []byte, requireUserVerification bool) (*Assertion, error) {
+	if response.Type != "public-key" {
+		return nil, fmt.Errorf("unexpected credential type %q", response.Type)
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataJSON, err := decodeBase64URL(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clientDataJSON: %w", err)
+	}
+
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := decodeBase64URL(response.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authenticatorData: %w", err)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := decodeBase64URL(response.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(bytes.Clone(rawAuthData), clientDataHash[:]...)
+
+	if !key.verify(signed, signature) {
+		return nil, errors.New("invalid assertion signature")
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.has(flagUserVerified),
+	}, nil
+}
+
+// SignCountValid implements the cloned authenticator check, authenticators that don't count always report 0
+func SignCountValid(stored uint32, received uint32) bool {
+	if stored == 0 && received == 0 {
+		return true
+	}
+
+	return received > stored
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Challenge returns the challenge the client signed, so the pending ceremony can be looked up before verifying
+func Challenge(clientDataJSON string) (string, error) {
+	raw, err := decodeBase64URL(clientDataJSON)
+	if err != nil {
+		return "", fmt.Errorf("invalid clientDataJSON: %w", err)
+	}
+
+	var clientData collectedClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return "", fmt.Errorf("failed to parse clientDataJSON: %w", err)
+	}
+
+	if clientData.Challenge == "" {
+		return "", errors.New("clientDataJSON has no challenge")
+	}
+
+	return clientData.Challenge, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge string) error {
+	var clientData collectedClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return fmt.Errorf("failed to parse clientDataJSON: %w", err)
+	}
+
+	if clientData.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony type %q", clientData.Type)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge)) != 1 {
+		return errors.New("challenge does not match")
+	}
+
+	if !slices.Contains(rp.Origins, clientData.Origin) {
+		return fmt.Errorf("origin %q is not allowed", clientData.Origin)
+	}
+
+	if clientData.CrossOrigin {
+		return errors.New("cross-origin ceremonies are not allowed")
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(raw []byte, requireUserVerification bool) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rpIdHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIdHash, rpIdHash[:]) != 1 {
+		return nil, errors.New("relying party id hash does not match")
+	}
+
+	if !authData.has(flagUserPresent) {
+		return nil, errors.New("user was not present")
+	}
+
+	if requireUserVerification && !authData.has(flagUserVerified) {
+		return nil, errors.New("user was not verified")
+	}
+
+	return authData, nil
+}
+
+// browsers encode binary fields as unpadded base64url, padding is tolerated for older polyfills
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
@@ -0,0 +1,282 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// minimal CBOR encoder for building authenticator responses
+func encodeCBOR(item any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		default:
+			b := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(n))
+			return b
+		}
+	}
+
+	switch v := item.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case int64:
+		return encodeCBOR(int(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case [][2]any: // ordered map
+		out := head(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair[0])...)
+			out = append(out, encodeCBOR(pair[1])...)
+		}
+		return out
+	default:
+		panic("unsupported")
+	}
+}
+
+type testAuthenticator struct {
+	rpId         string
+	credentialId []byte
+	ecdsa        *ecdsa.PrivateKey
+	ed25519      ed25519.PrivateKey
+	signCount    uint32
+}
+
+func newTestAuthenticator(t *testing.T, rpId string, useEd25519 bool) *testAuthenticator {
+	a := &testAuthenticator{rpId: rpId, credentialId: []byte("credential-1234")}
+
+	if useEd25519 {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+		a.ed25519 = key
+	} else {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		a.ecdsa = key
+	}
+
+	return a
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	if a.ed25519 != nil {
+		return encodeCBOR([][2]any{
+			{1, 1},
+			{3, -8},
+			{-1, 6},
+			{-2, []byte(a.ed25519.Public().(ed25519.PublicKey))},
+		})
+	}
+
+	x := a.ecdsa.X.FillBytes(make([]byte, 32))
+	y := a.ecdsa.Y.FillBytes(make([]byte, 32))
+	return encodeCBOR([][2]any{
+		{1, 2},
+		{3, -7},
+		{-1, 1},
+		{-2, x},
+		{-3, y},
+	})
+}
+
+func (a *testAuthenticator) authData(flags byte, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(a.rpId))
+	data := append([]byte{}, rpIdHash[:]...)
+
+	if attested {
+		flags |= flagAttestedCredentialData
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...) // aaguid
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialId)))
+		data = append(data, a.credentialId...)
+		data = append(data, a.coseKey()...)
+	}
+
+	return data
+}
+
+func clientData(ceremony, challenge, origin string) []byte {
+	raw, _ := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    origin,
+	})
+	return raw
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (a *testAuthenticator) create(challenge, origin string, flags byte) *RegistrationResponse {
+	attestationObject := encodeCBOR([][2]any{
+		{"fmt", "none"},
+		{"attStmt", [][2]any{}},
+		{"authData", a.authData(flags, true)},
+	})
+
+	response := &RegistrationResponse{ID: b64(a.credentialId), RawID: b64(a.credentialId), Type: "public-key"}
+	response.Response.ClientDataJSON = b64(clientData("webauthn.create", challenge, origin))
+	response.Response.AttestationObject = b64(attestationObject)
+
+	return response
+}
+
+func (a *testAuthenticator) get(t *testing.T, challenge, origin string, flags byte) *AssertionResponse {
+	a.signCount++
+	authData := a.authData(flags, false)
+	clientDataJSON := clientData("webauthn.get", challenge, origin)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	var signature []byte
+	if a.ed25519 != nil {
+		signature = ed25519.Sign(a.ed25519, signed)
+	} else {
+		digest := sha256.Sum256(signed)
+		var err error
+		signature, err = ecdsa.SignASN1(rand.Reader, a.ecdsa, digest[:])
+		assert.NoError(t, err)
+	}
+
+	response := &AssertionResponse{ID: b64(a.credentialId), RawID: b64(a.credentialId), Type: "public-key"}
+	response.Response.ClientDataJSON = b64(clientDataJSON)
+	response.Response.AuthenticatorData = b64(authData)
+	response.Response.Signature = b64(signature)
+
+	return response
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	// RFC 8949 Appendix A
+	vectors := []struct {
+		hex      string
+		expected any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3903e7", int64(-1000)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"f5", true},
+	}
+
+	for _, v := range vectors {
+		t.Run(v.hex, func(t *testing.T) {
+			data, _ := hex.DecodeString(v.hex)
+			item, n, err := decodeCBOR(data)
+			assert.NoError(t, err)
+			assert.Equal(t, len(data), n)
+			assert.Equal(t, v.expected, item)
+		})
+	}
+
+	t.Run("Rejects indefinite lengths", func(t *testing.T) {
+		_, _, err := decodeCBOR([]byte{0x9f, 0x01, 0xff})
+		assert.Error(t, err)
+	})
+
+	t.Run("Rejects truncated data", func(t *testing.T) {
+		_, _, err := decodeCBOR([]byte{0x44, 0x01})
+		assert.Error(t, err)
+	})
+}
+
+func TestCeremonies(t *testing.T) {
+	rp := NewRelyingParty("kuura.example.com", "Kuura", []string{"https://kuura.example.com"})
+	origin := "https://kuura.example.com"
+
+	for _, useEd25519 := range []bool{false, true} {
+		name := "ES256"
+		if useEd25519 {
+			name = "EdDSA"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			authenticator := newTestAuthenticator(t, rp.ID, useEd25519)
+
+			credential, err := rp.VerifyRegistration(authenticator.create("register", origin, flagUserPresent|flagUserVerified), "register", true)
+			assert.NoError(t, err)
+			assert.Equal(t, authenticator.credentialId, credential.ID)
+			assert.True(t, credential.UserVerified)
+
+			assertion, err := rp.VerifyAssertion(authenticator.get(t, "login", origin, flagUserPresent|flagUserVerified), "login", credential.PublicKey, true)
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(1), assertion.SignCount)
+
+			t.Run("Tampered signature", func(t *testing.T) {
+				response := authenticator.get(t, "login", origin, flagUserPresent)
+				response.Response.ClientDataJSON = b64(clientData("webauthn.get", "login", origin+"/"))
+				_, err := rp.VerifyAssertion(response, "login", credential.PublicKey, false)
+				assert.Error(t, err)
+			})
+		})
+	}
+
+	authenticator := newTestAuthenticator(t, rp.ID, false)
+
+	t.Run("Wrong challenge", func(t *testing.T) {
+		_, err := rp.VerifyRegistration(authenticator.create("other", origin, flagUserPresent), "register", false)
+		assert.Error(t, err)
+	})
+
+	t.Run("Wrong origin", func(t *testing.T) {
+		_, err := rp.VerifyRegistration(authenticator.create("register", "https://evil.example.com", flagUserPresent), "register", false)
+		assert.Error(t, err)
+	})
+
+	t.Run("Wrong relying party", func(t *testing.T) {
+		other := newTestAuthenticator(t, "evil.example.com", false)
+		_, err := rp.VerifyRegistration(other.create("register", origin, flagUserPresent), "register", false)
+		assert.Error(t, err)
+	})
+
+	t.Run("User verification required", func(t *testing.T) {
+		_, err := rp.VerifyRegistration(authenticator.create("register", origin, flagUserPresent), "register", true)
+		assert.Error(t, err)
+	})
+
+	t.Run("Challenge from client data", func(t *testing.T) {
+		challenge, err := Challenge(authenticator.create("register", origin, flagUserPresent).Response.ClientDataJSON)
+		assert.NoError(t, err)
+		assert.Equal(t, "register", challenge)
+	})
+}
+
+func TestSignCountValid(t *testing.T) {
+	assert.True(t, SignCountValid(0, 0))
+	assert.True(t, SignCountValid(0, 1))
+	assert.True(t, SignCountValid(5, 6))
+	assert.False(t, SignCountValid(5, 5))
+	assert.False(t, SignCountValid(5, 0))
+}
@@ -0,0 +1,130 @@
+package kuuram2m
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Credentials of an M2M session, the refresh token changes on every refresh
+type Credentials struct {
+	SessionId    string `json:"session_id"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// CredentialStore persists credentials, Save must replace them atomically
+// because a lost refresh token means a lost session
+type CredentialStore interface {
+	Load(ctx context.Context) (Credentials, error)
+	Save(ctx context.Context, credentials Credentials) error
+}
+
+type MemoryStore struct {
+	mu          sync.Mutex
+	credentials Credentials
+}
+
+func NewMemoryStore(credentials Credentials) *MemoryStore {
+	return &MemoryStore{credentials: credentials}
+}
+
+func (s *MemoryStore) Load(ctx context.Context) (Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.credentials, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, credentials Credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.credentials = credentials
+	return nil
+}
+
+// FileStore keeps credentials as JSON, readable only by the owner
+type FileStore struct {
+	Path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+func (s *FileStore) Load(ctx context.Context) (Credentials, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read credentials: %w", err)
+	}
+
+	var credentials Credentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return Credentials{}, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+
+	return credentials, nil
+}
+
+// Save writes a temporary file next to Path and renames it over Path,
+// readers see either the old or the new credentials
+func (s *FileStore) Save(ctx context.Context, credentials Credentials) (err error) {
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(s.Path), "."+filepath.Base(s.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary credentials file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(file.Name())
+		}
+	}()
+
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), s.Path); err != nil {
+		return fmt.Errorf("failed to replace credentials: %w", err)
+	}
+
+	return syncDir(filepath.Dir(s.Path))
+}
+
+// the rename is only durable once the directory is synced
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+
+	return nil
+}
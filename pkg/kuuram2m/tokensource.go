@@ -0,0 +1,240 @@
+// Package kuuram2m keeps an access token of a Kuura M2M session fresh.
+//
+//	source, err := kuuram2m.NewTokenSource(kuuram2m.Config{
+//		BaseURL: "https://kuura.example.com",
+//		Store:   kuuram2m.NewFileStore("/var/lib/worker/kuura.json"),
+//	})
+//
+//	client := &http.Client{Transport: &kuuram2m.Transport{Source: source}}
+package kuuram2m
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const accessPath = "/v1/m2m/access"
+
+// ErrNotPersisted is returned when the session was refreshed but the new credentials could not be saved.
+// The token source keeps using the new credentials and retries saving them on the next refresh.
+var ErrNotPersisted = errors.New("refreshed credentials were not persisted")
+
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+// Valid reports whether the token is usable for at least delta
+func (t *Token) Valid(delta time.Duration) bool {
+	return t != nil && t.AccessToken != "" && time.Now().Add(delta).Before(t.Expiry)
+}
+
+// Error is returned by Kuura for rejected refreshes
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("kuura responded %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+type Config struct {
+	// BaseURL of the Kuura instance, e.g. https://kuura.example.com
+	BaseURL string
+	Store   CredentialStore
+
+	// ExpiryDelta refreshes tokens this long before they expire, defaults to 30 seconds
+	ExpiryDelta time.Duration
+	HTTPClient  *http.Client
+}
+
+type TokenSource struct {
+	config Config
+
+	refreshing chan struct{} // holds one value while a refresh is running
+
+	mu          sync.Mutex
+	token       *Token
+	credentials *Credentials // set once the store could not be written
+}
+
+func NewTokenSource(config Config) (*TokenSource, error) {
+	if config.BaseURL == "" || config.Store == nil {
+		return nil, errors.New("kuuram2m: BaseURL and Store are required")
+	}
+
+	if config.ExpiryDelta <= 0 {
+		config.ExpiryDelta = 30 * time.Second
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	return &TokenSource{
+		config:     config,
+		refreshing: make(chan struct{}, 1),
+	}, nil
+}
+
+// Token returns the cached access token or refreshes it, concurrent callers share a single refresh
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	if token := s.cachedToken(); token != nil {
+		return token, nil
+	}
+
+	select {
+	case s.refreshing <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.refreshing }()
+
+	// another caller may have refreshed while this one waited
+	if token := s.cachedToken(); token != nil {
+		return token, nil
+	}
+
+	return s.refresh(ctx)
+}
+
+func (s *TokenSource) cachedToken() *Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Valid(s.config.ExpiryDelta) {
+		return s.token
+	}
+
+	return nil
+}
+
+// callers must hold s.refreshing
+func (s *TokenSource) refresh(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	pending := s.credentials
+	s.mu.Unlock()
+
+	var credentials Credentials
+	if pending != nil {
+		credentials = *pending
+	} else {
+		loaded, err := s.config.Store.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		credentials = loaded
+	}
+
+	accessToken, refreshToken, err := s.exchange(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{AccessToken: accessToken}
+	if parsed, err := jwt.ParseInsecure([]byte(accessToken)); err == nil {
+		token.Expiry = parsed.Expiration()
+	}
+
+	rotated := Credentials{SessionId: credentials.SessionId, RefreshToken: refreshToken}
+
+	// the old refresh token is already unusable, keep the new one even if it can't be saved
+	saveErr := s.config.Store.Save(ctx, rotated)
+
+	s.mu.Lock()
+	s.token = token
+	if saveErr != nil {
+		s.credentials = &rotated
+	} else {
+		s.credentials = nil
+	}
+	s.mu.Unlock()
+
+	if saveErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotPersisted, saveErr)
+	}
+
+	return token, nil
+}
+
+func (s *TokenSource) exchange(ctx context.Context, credentials Credentials) (accessToken string, refreshToken string, err error) {
+	body, err := json.Marshal(map[string]string{
+		"session_id":    credentials.SessionId,
+		"refresh_token": credentials.RefreshToken,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.BaseURL+accessPath, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("refresh request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		kuuraErr := &Error{StatusCode: res.StatusCode}
+		json.NewDecoder(res.Body).Decode(kuuraErr)
+		return "", "", kuuraErr
+	}
+
+	var response struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", "", fmt.Errorf("failed to decode refresh response: %w", err)
+	}
+
+	if response.AccessToken == "" || response.RefreshToken == "" {
+		return "", "", errors.New("refresh response is missing tokens")
+	}
+
+	return response.AccessToken, response.RefreshToken, nil
+}
+
+// Transport adds the access token of Source to every request
+type Transport struct {
+	Source *TokenSource
+	// Base defaults to http.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.Token(req.Context())
+	if err != nil && !errors.Is(err, ErrNotPersisted) {
+		return nil, err
+	} else if token == nil {
+		token = t.Source.cachedToken()
+		if token == nil {
+			return nil, err
+		}
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	return base.RoundTrip(authorized)
+}
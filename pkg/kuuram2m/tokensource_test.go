@@ -0,0 +1,207 @@
+package kuuram2m
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestKuura rotates the refresh token on every call like V1M2MRefreshAccessToken
+func newTestKuura(t *testing.T, tokenLifetime time.Duration) (*httptest.Server, *atomic.Int32) {
+	var (
+		mu         sync.Mutex
+		generation int
+		calls      atomic.Int32
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, accessPath, r.URL.Path)
+		calls.Add(1)
+
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if body["session_id"] != "session" || body["refresh_token"] != fmt.Sprintf("refresh-%d", generation) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"code": "K0603", "message": "The provided grant is invalid, expired or revoked."})
+			return
+		}
+		generation++
+
+		token, err := jwt.NewBuilder().Subject("worker").Expiration(time.Now().Add(tokenLifetime)).Build()
+		assert.NoError(t, err)
+		signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte("secret")))
+		assert.NoError(t, err)
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token":  string(signed),
+			"refresh_token": fmt.Sprintf("refresh-%d", generation),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+type failingStore struct {
+	*MemoryStore
+	fail bool
+}
+
+func (s *failingStore) Save(ctx context.Context, credentials Credentials) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.Save(ctx, credentials)
+}
+
+func TestTokenSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Caches until near expiry", func(t *testing.T) {
+		server, calls := newTestKuura(t, time.Hour)
+		store := NewMemoryStore(Credentials{SessionId: "session", RefreshToken: "refresh-0"})
+		source, err := NewTokenSource(Config{BaseURL: server.URL, Store: store})
+		assert.NoError(t, err)
+
+		first, err := source.Token(ctx)
+		assert.NoError(t, err)
+		second, err := source.Token(ctx)
+		assert.NoError(t, err)
+
+		assert.Equal(t, first, second)
+		assert.Equal(t, int32(1), calls.Load())
+
+		credentials, _ := store.Load(ctx)
+		assert.Equal(t, "refresh-1", credentials.RefreshToken, "Rotated refresh token should be persisted")
+	})
+
+	t.Run("Refreshes expiring tokens", func(t *testing.T) {
+		server, calls := newTestKuura(t, 10*time.Second)
+		store := NewMemoryStore(Credentials{SessionId: "session", RefreshToken: "refresh-0"})
+		source, err := NewTokenSource(Config{BaseURL: server.URL, Store: store, ExpiryDelta: time.Minute})
+		assert.NoError(t, err)
+
+		for range 3 {
+			_, err := source.Token(ctx)
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("Concurrent callers share a refresh", func(t *testing.T) {
+		server, calls := newTestKuura(t, time.Hour)
+		store := NewMemoryStore(Credentials{SessionId: "session", RefreshToken: "refresh-0"})
+		source, err := NewTokenSource(Config{BaseURL: server.URL, Store: store})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := source.Token(ctx)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("Unsaved credentials are kept", func(t *testing.T) {
+		server, _ := newTestKuura(t, 10*time.Second)
+		store := &failingStore{MemoryStore: NewMemoryStore(Credentials{SessionId: "session", RefreshToken: "refresh-0"}), fail: true}
+		source, err := NewTokenSource(Config{BaseURL: server.URL, Store: store, ExpiryDelta: time.Minute})
+		assert.NoError(t, err)
+
+		_, err = source.Token(ctx)
+		assert.ErrorIs(t, err, ErrNotPersisted)
+
+		store.fail = false
+		_, err = source.Token(ctx)
+		assert.NoError(t, err, "Next refresh should use the unsaved refresh token")
+
+		credentials, _ := store.Load(ctx)
+		assert.Equal(t, "refresh-2", credentials.RefreshToken)
+	})
+
+	t.Run("Rejected refresh", func(t *testing.T) {
+		server, _ := newTestKuura(t, time.Hour)
+		store := NewMemoryStore(Credentials{SessionId: "session", RefreshToken: "stolen"})
+		source, err := NewTokenSource(Config{BaseURL: server.URL, Store: store})
+		assert.NoError(t, err)
+
+		_, err = source.Token(ctx)
+
+		var kuuraErr *Error
+		assert.ErrorAs(t, err, &kuuraErr)
+		assert.Equal(t, http.StatusBadRequest, kuuraErr.StatusCode)
+		assert.Equal(t, "K0603", kuuraErr.Code)
+	})
+
+	t.Run("Transport", func(t *testing.T) {
+		server, _ := newTestKuura(t, time.Hour)
+		store := NewMemoryStore(Credentials{SessionId: "session", RefreshToken: "refresh-0"})
+		source, err := NewTokenSource(Config{BaseURL: server.URL, Store: store})
+		assert.NoError(t, err)
+
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Header.Get("Authorization")))
+		}))
+		defer api.Close()
+
+		client := &http.Client{Transport: &Transport{Source: source}}
+		res, err := client.Get(api.URL)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		token, _ := source.Token(ctx)
+		var body [2048]byte
+		n, _ := res.Body.Read(body[:])
+		assert.Equal(t, "Bearer "+token.AccessToken, string(body[:n]))
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	store := NewFileStore(path)
+
+	credentials := Credentials{SessionId: "session", RefreshToken: "refresh-0"}
+	assert.NoError(t, store.Save(ctx, credentials))
+
+	loaded, err := store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, credentials, loaded)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Credentials must only be readable by the owner")
+
+	assert.NoError(t, store.Save(ctx, Credentials{SessionId: "session", RefreshToken: "refresh-1"}))
+	loaded, err = store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "refresh-1", loaded.RefreshToken)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "Temporary files should not be left behind")
+}
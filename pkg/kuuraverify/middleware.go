@@ -0,0 +1,66 @@
+package kuuraverify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// ClientFromContext returns the client authenticated by Middleware
+func ClientFromContext(ctx context.Context) (*Client, bool) {
+	client, ok := ctx.Value(contextKey{}).(*Client)
+	return client, ok
+}
+
+// Middleware requires a valid bearer token with every role in requiredRoles.
+// Invalid or missing tokens get 401 and missing roles 403, both with an RFC 6750 WWW-Authenticate header.
+func (v *Verifier) Middleware(requiredRoles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				unauthorized(w, ErrMissingToken)
+				return
+			}
+
+			client, err := v.Verify(r.Context(), token)
+			if err != nil {
+				unauthorized(w, err)
+				return
+			}
+
+			for _, role := range requiredRoles {
+				if !client.HasRole(role) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", error_description="missing role %s"`, role))
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, client)))
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrMissingToken) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
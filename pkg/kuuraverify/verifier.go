@@ -0,0 +1,315 @@
+// Package kuuraverify validates access tokens issued by Kuura.
+//
+//	verifier, err := kuuraverify.New(ctx, kuuraverify.Config{
+//		JWKSURL:   "https://kuura.example.com/v1/service/<service-id>/jwks.json",
+//		Issuer:    "kuura.example.com",
+//		Audience:  "api.example.com",
+//		ServiceId: "<service-id>",
+//	})
+//
+//	mux.Handle("GET /admin", verifier.Middleware("admin")(adminHandler))
+package kuuraverify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	ClientTypeUser    = "user"
+	ClientTypeMachine = "machine"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Client holds the claims of a verified access token
+type Client struct {
+	Id             string
+	Roles          []string
+	ClientType     string // machine | user
+	TokenExpiresAt time.Time
+	ServiceId      string
+	SessionId      string // empty for client_credentials tokens
+	ClientId       string // only set for client_credentials tokens
+}
+
+func (c *Client) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Config struct {
+	// JWKSURL of the service, https://<kuura>/v1/service/<service-id>/jwks.json
+	JWKSURL string
+	// Issuer is JWT_ISSUER of the Kuura instance
+	Issuer string
+	// Audience is the JWT audience of the service, not checked when empty
+	Audience string
+	// ServiceId is compared to the service_id claim, not checked when empty
+	ServiceId string
+
+	// RefreshInterval is how often the key set is refetched in the background, defaults to 5 minutes
+	RefreshInterval time.Duration
+	// MinRefetchInterval limits refetches caused by tokens signed with unknown keys, defaults to 30 seconds
+	MinRefetchInterval time.Duration
+	// AcceptableSkew is the allowed clock difference when checking exp, nbf and iat
+	AcceptableSkew time.Duration
+
+	HTTPClient *http.Client
+}
+
+type Verifier struct {
+	config Config
+
+	mu          sync.RWMutex
+	keys        jwk.Set
+	etag        string
+	lastFetchAt time.Time
+
+	fetchMu sync.Mutex // serializes fetches
+}
+
+// New fetches the key set and keeps it fresh in the background until ctx is cancelled
+func New(ctx context.Context, config Config) (*Verifier, error) {
+	if config.JWKSURL == "" || config.Issuer == "" {
+		return nil, errors.New("kuuraverify: JWKSURL and Issuer are required")
+	}
+
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 5 * time.Minute
+	}
+	if config.MinRefetchInterval <= 0 {
+		config.MinRefetchInterval = 30 * time.Second
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	v := &Verifier{
+		config: config,
+		keys:   jwk.NewSet(),
+	}
+
+	if err := v.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("kuuraverify: initial key set fetch failed: %w", err)
+	}
+
+	go v.refreshLoop(ctx)
+
+	return v, nil
+}
+
+// Verify validates the signature, issuer, audience, service and expiry of an access token
+func (v *Verifier) Verify(ctx context.Context, token string) (*Client, error) {
+	keys := v.keySet()
+
+	kid, err := keyId(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if _, ok := keys.LookupKeyID(kid); !ok {
+		// the key may have been created after the last refresh
+		if err := v.refetch(ctx); err != nil {
+			return nil, fmt.Errorf("%w: unknown key %s and refetch failed: %w", ErrInvalidToken, kid, err)
+		}
+		keys = v.keySet()
+	}
+
+	options := []jwt.ParseOption{
+		jwt.WithKeySet(keys),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(v.config.Issuer),
+		jwt.WithAcceptableSkew(v.config.AcceptableSkew),
+		jwt.WithRequiredClaim("exp"),
+		jwt.WithRequiredClaim("sub"),
+		jwt.WithRequiredClaim("roles"),
+		jwt.WithRequiredClaim("client_type"),
+	}
+	if v.config.Audience != "" {
+		options = append(options, jwt.WithAudience(v.config.Audience))
+	}
+	if v.config.ServiceId != "" {
+		options = append(options, jwt.WithClaimValue("service_id", v.config.ServiceId))
+	}
+
+	parsed, err := jwt.Parse([]byte(token), options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return clientFromToken(parsed)
+}
+
+func clientFromToken(token jwt.Token) (*Client, error) {
+	rolesClaim, _ := token.Get("roles")
+	rolesSlice, ok := rolesClaim.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid roles format", ErrInvalidToken)
+	}
+
+	roles := make([]string, len(rolesSlice))
+	for i, value := range rolesSlice {
+		role, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid role type", ErrInvalidToken)
+		}
+		roles[i] = role
+	}
+
+	clientType := stringClaim(token, "client_type")
+	if clientType != ClientTypeUser && clientType != ClientTypeMachine {
+		return nil, fmt.Errorf("%w: unknown client type %q", ErrInvalidToken, clientType)
+	}
+
+	return &Client{
+		Id:             token.Subject(),
+		Roles:          roles,
+		ClientType:     clientType,
+		TokenExpiresAt: token.Expiration(),
+		ServiceId:      stringClaim(token, "service_id"),
+		SessionId:      stringClaim(token, "session_id"),
+		ClientId:       stringClaim(token, "client_id"),
+	}, nil
+}
+
+func stringClaim(token jwt.Token, name string) string {
+	value, ok := token.Get(name)
+	if !ok {
+		return ""
+	}
+
+	str, _ := value.(string)
+	return str
+}
+
+func keyId(token string) (string, error) {
+	message, err := jws.Parse([]byte(token))
+	if err != nil {
+		return "", err
+	}
+
+	signatures := message.Signatures()
+	if len(signatures) != 1 {
+		return "", fmt.Errorf("expected one signature, got %d", len(signatures))
+	}
+
+	kid := signatures[0].ProtectedHeaders().KeyID()
+	if kid == "" {
+		return "", errors.New("token has no key id")
+	}
+
+	return kid, nil
+}
+
+func (v *Verifier) keySet() jwk.Set {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return v.keys
+}
+
+func (v *Verifier) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(v.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// a failed refresh keeps the previous keys, the next tick or an unknown kid retries
+			v.refresh(ctx)
+		}
+	}
+}
+
+// refetch refreshes unless the key set was fetched within MinRefetchInterval
+func (v *Verifier) refetch(ctx context.Context) error {
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+
+	v.mu.RLock()
+	recent := time.Since(v.lastFetchAt) < v.config.MinRefetchInterval
+	v.mu.RUnlock()
+
+	if recent {
+		return nil
+	}
+
+	return v.fetch(ctx)
+}
+
+func (v *Verifier) refresh(ctx context.Context) error {
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+
+	return v.fetch(ctx)
+}
+
+// callers must hold v.fetchMu
+func (v *Verifier) fetch(ctx context.Context) error {
+	v.mu.RLock()
+	etag := v.etag
+	v.mu.RUnlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.config.JWKSURL, nil)
+	if err != nil {
+		return err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := v.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		v.mu.Lock()
+		v.lastFetchAt = time.Now()
+		v.mu.Unlock()
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("unexpected status %d from %s", res.StatusCode, v.config.JWKSURL)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	keys, err := jwk.Parse(body)
+	if err != nil {
+		return fmt.Errorf("invalid key set: %w", err)
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.etag = res.Header.Get("ETag")
+	v.lastFetchAt = time.Now()
+	v.mu.Unlock()
+
+	return nil
+}
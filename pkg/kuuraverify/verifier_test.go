@@ -0,0 +1,220 @@
+package kuuraverify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testIssuer    = "kuura.example.com"
+	testAudience  = "api.example.com"
+	testServiceId = "0193c6dd-d680-7011-91c6-6b8a280eaf25"
+)
+
+// testKuura publishes a key set like the JWKS endpoint of Kuura, with ETag support
+type testKuura struct {
+	t       *testing.T
+	server  *httptest.Server
+	mu      sync.Mutex
+	private map[string]jwk.Key
+	fetches atomic.Int32
+}
+
+func newTestKuura(t *testing.T) *testKuura {
+	kuura := &testKuura{t: t, private: map[string]jwk.Key{}}
+
+	kuura.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kuura.fetches.Add(1)
+
+		kuura.mu.Lock()
+		set := jwk.NewSet()
+		for _, key := range kuura.private {
+			public, err := key.PublicKey()
+			assert.NoError(t, err)
+			set.AddKey(public)
+		}
+		etag := `W/"` + string(rune('a'+len(kuura.private))) + `"`
+		kuura.mu.Unlock()
+
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(kuura.server.Close)
+
+	return kuura
+}
+
+func (k *testKuura) addKey(kid string) {
+	raw, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(k.t, err)
+
+	key, err := jwk.FromRaw(raw)
+	assert.NoError(k.t, err)
+	key.Set(jwk.KeyIDKey, kid)
+	key.Set(jwk.AlgorithmKey, jwa.ES384)
+
+	k.mu.Lock()
+	k.private[kid] = key
+	k.mu.Unlock()
+}
+
+func (k *testKuura) sign(kid string, modify func(*jwt.Builder) *jwt.Builder) string {
+	builder := jwt.NewBuilder().
+		Issuer(testIssuer).
+		Audience([]string{testAudience}).
+		Subject("user-id").
+		Expiration(time.Now().Add(time.Minute)).
+		Claim("roles", []string{"reader"}).
+		Claim("client_type", ClientTypeUser).
+		Claim("service_id", testServiceId).
+		Claim("session_id", "session-id")
+	if modify != nil {
+		builder = modify(builder)
+	}
+
+	token, err := builder.Build()
+	assert.NoError(k.t, err)
+
+	k.mu.Lock()
+	key := k.private[kid]
+	k.mu.Unlock()
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.ES384, key))
+	assert.NoError(k.t, err)
+
+	return string(signed)
+}
+
+func (k *testKuura) verifier(ctx context.Context) *Verifier {
+	verifier, err := New(ctx, Config{
+		JWKSURL:            k.server.URL,
+		Issuer:             testIssuer,
+		Audience:           testAudience,
+		ServiceId:          testServiceId,
+		MinRefetchInterval: time.Nanosecond,
+	})
+	assert.NoError(k.t, err)
+
+	return verifier
+}
+
+func TestVerify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kuura := newTestKuura(t)
+	kuura.addKey("first")
+	verifier := kuura.verifier(ctx)
+
+	t.Run("Valid token", func(t *testing.T) {
+		client, err := verifier.Verify(ctx, kuura.sign("first", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, &Client{
+			Id:             "user-id",
+			Roles:          []string{"reader"},
+			ClientType:     ClientTypeUser,
+			TokenExpiresAt: client.TokenExpiresAt,
+			ServiceId:      testServiceId,
+			SessionId:      "session-id",
+		}, client)
+	})
+
+	invalid := map[string]func(*jwt.Builder) *jwt.Builder{
+		"Wrong issuer":      func(b *jwt.Builder) *jwt.Builder { return b.Issuer("someone.else") },
+		"Wrong audience":    func(b *jwt.Builder) *jwt.Builder { return b.Audience([]string{"other.example.com"}) },
+		"Other service":     func(b *jwt.Builder) *jwt.Builder { return b.Claim("service_id", "other") },
+		"Expired":           func(b *jwt.Builder) *jwt.Builder { return b.Expiration(time.Now().Add(-time.Minute)) },
+		"Unknown role type": func(b *jwt.Builder) *jwt.Builder { return b.Claim("roles", []int{1}) },
+		"Unknown client":    func(b *jwt.Builder) *jwt.Builder { return b.Claim("client_type", "robot") },
+	}
+	for name, modify := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifier.Verify(ctx, kuura.sign("first", modify))
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+
+	t.Run("Unknown key is refetched", func(t *testing.T) {
+		kuura.addKey("second")
+
+		_, err := verifier.Verify(ctx, kuura.sign("second", nil))
+		assert.NoError(t, err, "Key created after the last refresh should be fetched")
+	})
+
+	t.Run("Unchanged key set is not re-downloaded", func(t *testing.T) {
+		before := kuura.fetches.Load()
+		assert.NoError(t, verifier.refresh(ctx))
+		assert.Equal(t, before+1, kuura.fetches.Load())
+		assert.NotEmpty(t, verifier.etag)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kuura := newTestKuura(t)
+	kuura.addKey("first")
+	verifier := kuura.verifier(ctx)
+
+	handler := func(roles ...string) http.Handler {
+		return verifier.Middleware(roles...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, ok := ClientFromContext(r.Context())
+			assert.True(t, ok)
+			w.Write([]byte(client.Id))
+		}))
+	}
+
+	request := func(h http.Handler, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Authorized", func(t *testing.T) {
+		rec := request(handler("reader"), "Bearer "+kuura.sign("first", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user-id", rec.Body.String())
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		rec := request(handler(), "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		rec := request(handler(), "Bearer not-a-token")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "invalid_token")
+	})
+
+	t.Run("Missing role", func(t *testing.T) {
+		rec := request(handler("reader", "admin"), "Bearer "+kuura.sign("first", nil))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "insufficient_scope")
+	})
+}